@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"pubsub-ckg-tb/internal/app"
+	"pubsub-ckg-tb/internal/app/ckg"
+	"pubsub-ckg-tb/internal/repository"
+	"strings"
+	"syscall"
+)
+
+func main() {
+	if err := run(); err != nil {
+		slog.Error("Backfill gagal", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run menjalankan backfill, os.Exit hanya dipanggil di main agar defer (menutup koneksi) tetap berjalan
+func run() error {
+	start := flag.String("start", "", "updated_at mulai (RFC3339 atau YYYY-MM-DD)")
+	end := flag.String("end", "", "updated_at sampai (RFC3339 atau YYYY-MM-DD, kosong = saat job pertama kali dijalankan)")
+	faskes := flag.String("faskes", "", "kode faskes, pisahkan dengan koma untuk lebih dari satu")
+	provinsi := flag.String("provinsi", "", "provinsi faskes, pisahkan dengan koma untuk lebih dari satu")
+	limit := flag.Int64("limit", 0, "jumlah maksimal data skrining (0 = semua)")
+	batch := flag.Int("batch", 0, "jumlah data skrining per halaman/message (0 = PRODUCER_BATCH_SIZE)")
+	throttle := flag.Duration("throttle", 0, "jeda antar halaman, contoh 500ms atau 2s")
+	job := flag.String("job", "", "nama job untuk checkpoint (kosong = dihitung dari filter)")
+	restart := flag.Bool("restart", false, "abaikan checkpoint dan mulai job dari awal")
+	skipUnchanged := flag.Bool("skip-unchanged", false, "lewati data yang tidak berubah sejak terakhir dikirim (PRODUCER_DEDUP_ENABLED)")
+	flag.Parse()
+
+	app, err := app.InitApp()
+	if err != nil {
+		return fmt.Errorf("failed to initialize application: %w", err)
+	}
+	defer app.Close()
+
+	if !app.PubSub.EnsureTopicExists(app.Context) {
+		return errors.New("topic tidak ditemukan")
+	}
+
+	if *batch > 0 {
+		app.Configurations.Producer.BatchSize = *batch
+	}
+
+	// Job yang dihentikan (Ctrl+C / SIGTERM) dilanjutkan dari checkpoint saat dijalankan ulang
+	ctx, stop := signal.NotifyContext(app.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	transmitter := ckg.NewCkgTransmitter(app.Context, app.Configurations, app.Database, app.PubSub.Broker)
+	err = transmitter.RunBackfill(ctx, ckg.BackfillJob{
+		ID: *job,
+		Filter: repository.SkriningFilter{
+			Start:          *start,
+			End:            *end,
+			KodeFaskes:     splitList(*faskes),
+			ProvinsiFaskes: splitList(*provinsi),
+		},
+		Limit:         *limit,
+		Throttle:      *throttle,
+		Restart:       *restart,
+		SkipUnchanged: *skipUnchanged,
+	})
+	if errors.Is(err, context.Canceled) {
+		slog.Info("Backfill dihentikan, jalankan ulang perintah yang sama untuk melanjutkan")
+		return nil
+	}
+	return err
+}
+
+func splitList(value string) []string {
+	items := []string{}
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
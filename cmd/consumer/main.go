@@ -1,13 +1,21 @@
 package main
 
 import (
+	"flag"
 	"log/slog"
 	"os"
 	"pubsub-ckg-tb/internal/app"
 	"pubsub-ckg-tb/internal/app/ckg"
+	"time"
 )
 
 func main() {
+	dryRun := flag.Bool("dry-run", false, "proses message tanpa menulis ke database, keputusan ditulis sebagai JSON lines")
+	dryRunOutput := flag.String("dry-run-output", "-", "file output dry-run, \"-\" = stdout")
+	dryRunLimit := flag.Int("dry-run-limit", 100, "jumlah message yang diproses dry-run sebelum berhenti")
+	dryRunIdle := flag.Duration("dry-run-idle", 30*time.Second, "dry-run berhenti bila tidak ada message baru selama durasi ini")
+	flag.Parse()
+
 	app, err := app.InitApp()
 	if err != nil {
 		slog.Error("Failed to initialize application", "error", err)
@@ -21,9 +29,37 @@ func main() {
 	defer app.Close()
 
 	slog.Info("Application initialized successfully")
-	app.RunPubSubConsumer(ckg.NewCkgReceiver(
+	receiver := ckg.NewCkgReceiver(
 		app.Context,
 		app.Configurations,
 		app.Database,
-	))
+		app.PubSub.Broker,
+	)
+
+	// Dry-run menahan message tanpa ack lalu me-nack semuanya saat berhenti,
+	// sehingga message tetap tersedia untuk consumer sebenarnya
+	if *dryRun {
+		output, err := ckg.NewDryRunOutput(*dryRunOutput)
+		if err != nil {
+			slog.Error("Gagal membuka output dry-run", "output", *dryRunOutput, "error", err)
+			os.Exit(1)
+		}
+		defer output.Close()
+
+		// Flow control harus mengizinkan seluruh message yang ditahan tetap outstanding
+		consumerCfg := &app.Configurations.Consumer
+		consumerCfg.MaxMessagesPerPull = max(consumerCfg.MaxMessagesPerPull, *dryRunLimit)
+		consumerCfg.FlowControl.MaxOutstandingMessages = max(consumerCfg.FlowControl.MaxOutstandingMessages, *dryRunLimit)
+
+		receiver.SetDryRunOutput(output, *dryRunLimit, *dryRunIdle)
+		slog.Info("Menjalankan consumer dry-run", "output", *dryRunOutput, "limit", *dryRunLimit, "idle", *dryRunIdle)
+	}
+
+	// Retention log berjalan di background, tidak dijalankan pada dry-run
+	if app.Configurations.Retention.Enabled && !*dryRun {
+		retention := ckg.NewCkgRetention(app.Context, app.Configurations, app.Database)
+		go retention.Run(app.Context)
+	}
+
+	app.RunPubSubConsumer(receiver)
 }
@@ -1,13 +1,31 @@
 package main
 
 import (
+	"flag"
 	"log/slog"
 	"os"
+	"os/signal"
 	"pubsub-ckg-tb/internal/app"
 	"pubsub-ckg-tb/internal/app/ckg"
+	"pubsub-ckg-tb/internal/config"
+	"syscall"
 )
 
 func main() {
+	// Rentang data untuk mode one-time, mengganti PRODUCER_WINDOW_*
+	start := flag.String("start", "", "updated_at mulai (RFC3339 atau YYYY-MM-DD, \"last\" = sejak outgoing terakhir)")
+	end := flag.String("end", "", "updated_at sampai (RFC3339 atau YYYY-MM-DD)")
+	limit := flag.Int64("limit", -1, "jumlah maksimal data skrining (0 = semua)")
+	force := flag.Bool("force", false, "kirim ulang data walaupun tidak berubah sejak terakhir dikirim")
+	dryRun := flag.Bool("dry-run", false, "tulis message sebagai JSON lines tanpa mengirim ke Pub/Sub (mode one-time)")
+	dryRunOutput := flag.String("dry-run-output", "-", "file output dry-run, \"-\" = stdout")
+	flag.Parse()
+
+	if *dryRun {
+		runDryRun(*dryRunOutput, *start, *end, *limit, *force)
+		return
+	}
+
 	app, err := app.InitApp()
 	if err != nil {
 		slog.Error("Failed to initialize application", "error", err)
@@ -21,15 +39,67 @@ func main() {
 	defer app.Close()
 
 	slog.Info("Application initialized successfully")
-	watchMode := false
-	if app.Database.GetName() == "MongoDB" {
-		watchMode = true
+	// Mode watch: change stream untuk MongoDB, polling untuk MySQL/PostgreSQL
+	watchMode := app.Configurations.Producer.Watch.Enabled
+
+	// Rentang data dari flag menjalankan mode one-time, misalnya untuk backfill terarah
+	if applyWindowFlags(app.Configurations, *start, *end, *limit, *force) {
+		watchMode = false
 	}
 
 	app.RunPubSubProducer(ckg.NewCkgTransmitter(
 		app.Context,
 		app.Configurations,
 		app.Database,
-		app.PubSub,
+		app.PubSub.Broker,
 	), watchMode)
 }
+
+// applyWindowFlags mengganti konfigurasi window dan dedup dari flag, mengembalikan true jika
+// salah satu flag rentang data diisi
+func applyWindowFlags(cfg *config.Configurations, start, end string, limit int64, force bool) bool {
+	window := &cfg.Producer.Window
+	windowSet := false
+	if start != "" {
+		window.Start = start
+		windowSet = true
+	}
+	if end != "" {
+		window.End = end
+		windowSet = true
+	}
+	if limit >= 0 {
+		window.Limit = limit
+		windowSet = true
+	}
+	if force {
+		cfg.Producer.Dedup.Enabled = false
+	}
+	return windowSet
+}
+
+// runDryRun menjalankan producer one-time tanpa Pub/Sub dan menulis setiap message ke output
+func runDryRun(output string, start, end string, limit int64, force bool) {
+	app := app.InitDatabaseApp()
+	defer app.Close()
+
+	applyWindowFlags(app.Configurations, start, end, limit, force)
+
+	dryRunOutput, err := ckg.NewDryRunOutput(output)
+	if err != nil {
+		slog.Error("Gagal membuka output dry-run", "output", output, "error", err)
+		return
+	}
+	defer dryRunOutput.Close()
+
+	ctx, stop := signal.NotifyContext(app.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	transmitter := ckg.NewCkgTransmitter(app.Context, app.Configurations, app.Database, nil)
+	transmitter.SetDryRun(dryRunOutput)
+
+	slog.Info("Menjalankan producer dry-run", "output", output)
+	if err := transmitter.Produce(ctx); err != nil {
+		slog.Error("Producer dry-run gagal", "error", err)
+	}
+}
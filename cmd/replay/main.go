@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"pubsub-ckg-tb/internal/app"
+	"pubsub-ckg-tb/internal/app/ckg"
+	"pubsub-ckg-tb/internal/models"
+	"pubsub-ckg-tb/internal/repository"
+	"strings"
+	"text/tabwriter"
+)
+
+const usage = `Penggunaan: replay <perintah> [opsi]
+
+Perintah:
+  list      menampilkan daftar message pada log incoming
+  show      menampilkan payload message
+  run       menjalankan ulang message melalui proses consumer
+  items     menampilkan hasil proses per status pasien berdasarkan -nik atau -terduga
+  outgoing  menampilkan data pasien yang sudah dikirim ke SITB berdasarkan -ckg atau -nik
+  history   menampilkan riwayat perubahan status pasien berdasarkan -ckg atau -nik
+
+Tambahkan -quarantine pada list, show dan run untuk membaca tabel karantina, termasuk
+message yang gagal diparsing dan tidak pernah masuk log incoming.
+
+Gunakan "replay <perintah> -h" untuk melihat opsi tiap perintah.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	from := flags.String("from", "", "received_at mulai (RFC3339, contoh 2025-01-01T00:00:00Z)")
+	to := flags.String("to", "", "received_at sampai (RFC3339)")
+	status := flags.String("status", "all", "status proses: all, processed, unprocessed, received, processing, succeeded, partially_failed, failed")
+	nik := flags.String("nik", "", "filter NIK pasien (payload pada list/show/run)")
+	terduga := flags.String("terduga", "", "filter terduga_id pada payload")
+	pasienCkgID := flags.String("ckg", "", "outgoing, history: filter pasien_ckg_id")
+	ids := flags.String("id", "", "message ID, pisahkan dengan koma untuk lebih dari satu")
+	limit := flags.Int("limit", 100, "jumlah maksimal message (0 = tanpa batas)")
+	dryRun := flags.Bool("dry-run", false, "run: jalankan tanpa menulis ke database")
+	failedOnly := flags.Bool("failed", false, "items: hanya tampilkan status pasien yang ditolak")
+	quarantine := flags.Bool("quarantine", false, "list, show, run: baca message dari tabel karantina, -from/-to berlaku untuk quarantined_at")
+	reason := flags.String("reason", "", "alasan karantina: parse_error, permanent_error, retry_exhausted (hanya dengan -quarantine)")
+
+	switch command {
+	case "list", "show", "run", "items", "outgoing", "history":
+		flags.Parse(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	filter, err := buildFilter(*from, *to, *status, *nik, *terduga, *ids)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if command == "show" && len(filter.IDs) == 0 {
+		fmt.Fprintln(os.Stderr, "show membutuhkan -id")
+		os.Exit(2)
+	}
+	if (command == "items" || command == "outgoing" || command == "history") && *quarantine {
+		fmt.Fprintf(os.Stderr, "%s tidak mendukung -quarantine\n", command)
+		os.Exit(2)
+	}
+	if *reason != "" && !*quarantine {
+		fmt.Fprintln(os.Stderr, "-reason membutuhkan -quarantine")
+		os.Exit(2)
+	}
+	if command == "items" && *nik == "" && *terduga == "" {
+		fmt.Fprintln(os.Stderr, "items membutuhkan -nik atau -terduga")
+		os.Exit(2)
+	}
+
+	if (command == "outgoing" || command == "history") && *pasienCkgID == "" && *nik == "" {
+		fmt.Fprintf(os.Stderr, "%s membutuhkan -ckg atau -nik\n", command)
+		os.Exit(2)
+	}
+
+	app := app.InitDatabaseApp()
+	defer app.Close()
+
+	receiver := ckg.NewCkgReceiver(app.Context, app.Configurations, app.Database, nil)
+	receiver.SetDryRun(*dryRun)
+
+	if command == "items" {
+		items, err := receiver.PubSubRepo.FindIncomingItems(repository.IncomingItemFilter{
+			PasienNIK:  *nik,
+			TerdugaID:  *terduga,
+			FailedOnly: *failedOnly,
+		}, int64(*limit))
+		if err != nil {
+			slog.Error("Gagal membaca hasil proses incoming", "error", err)
+			os.Exit(1)
+		}
+		printItems(items)
+		return
+	}
+
+	if command == "outgoing" {
+		records, err := receiver.PubSubRepo.FindOutgoingByPatient(*pasienCkgID, *nik, int64(*limit))
+		if err != nil {
+			slog.Error("Gagal membaca log outgoing", "error", err)
+			os.Exit(1)
+		}
+		printOutgoing(records)
+		return
+	}
+
+	if command == "history" {
+		history, err := receiver.CkgRepo.FindStatusHistory(*pasienCkgID, *nik, int64(*limit))
+		if err != nil {
+			slog.Error("Gagal membaca riwayat status pasien", "error", err)
+			os.Exit(1)
+		}
+		printHistory(history)
+		return
+	}
+
+	var entries []ckg.ReplayEntry
+	if *quarantine {
+		entries, err = receiver.FindQuarantineEntries(ckg.QuarantineReplayFilter{
+			QuarantineFilter: repository.QuarantineFilter{
+				IDs:    filter.IDs,
+				Start:  filter.Start,
+				End:    filter.End,
+				Reason: *reason,
+			},
+			NIK:       filter.NIK,
+			TerdugaID: filter.TerdugaID,
+		}, *limit)
+	} else {
+		entries, err = receiver.FindReplayEntries(filter, *limit)
+	}
+	if err != nil {
+		slog.Error("Gagal membaca message", "quarantine", *quarantine, "error", err)
+		os.Exit(1)
+	}
+
+	switch command {
+	case "list":
+		if *quarantine {
+			printQuarantineList(entries)
+			return
+		}
+		printList(entries)
+	case "show":
+		printPayload(entries)
+	case "run":
+		results := make([]ckg.ReplayResult, 0, len(entries))
+		for _, entry := range entries {
+			results = append(results, receiver.Replay(app.Context, entry))
+		}
+		printJSON(results)
+	}
+}
+
+func buildFilter(from, to, status, nik, terduga, ids string) (ckg.ReplayFilter, error) {
+	filter := ckg.ReplayFilter{
+		NIK:       nik,
+		TerdugaID: terduga,
+	}
+	filter.Start = from
+	filter.End = to
+
+	switch status {
+	case "all", "":
+	case models.IncomingStateReceived, models.IncomingStateProcessing, models.IncomingStateSucceeded,
+		models.IncomingStatePartiallyFailed, models.IncomingStateFailed:
+		filter.State = status
+	case "processed":
+		processed := true
+		filter.Processed = &processed
+	case "unprocessed":
+		processed := false
+		filter.Processed = &processed
+	default:
+		return filter, fmt.Errorf("status tidak dikenal: %s", status)
+	}
+
+	for id := range strings.SplitSeq(ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			filter.IDs = append(filter.IDs, id)
+		}
+	}
+
+	return filter, nil
+}
+
+func printList(entries []ckg.ReplayEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATE\tATTEMPTS\tRECEIVED_AT\tPROCESSED_AT\tITEMS\tNIK\tTERDUGA_ID")
+	for _, entry := range entries {
+		processedAt := "-"
+		if entry.Incoming.ProcessedAt != nil {
+			processedAt = *entry.Incoming.ProcessedAt
+		}
+
+		niks := []string{}
+		terdugaIDs := []string{}
+		for _, item := range entry.StatusPasien {
+			if item.PasienNIK != nil {
+				niks = append(niks, *item.PasienNIK)
+			}
+			if item.TerdugaID != nil {
+				terdugaIDs = append(terdugaIDs, *item.TerdugaID)
+			}
+		}
+
+		items := fmt.Sprint(len(entry.StatusPasien))
+		if entry.ParseError != nil {
+			items = "invalid"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Incoming.ID,
+			entry.Incoming.State,
+			entry.Incoming.Attempts,
+			entry.Incoming.ReceivedAt,
+			processedAt,
+			items,
+			strings.Join(niks, ","),
+			strings.Join(terdugaIDs, ","))
+	}
+	w.Flush()
+}
+
+func printQuarantineList(entries []ckg.ReplayEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tREASON\tATTEMPTS\tQUARANTINED_AT\tDEAD_LETTER_ID\tITEMS\tNIK\tERROR")
+	for _, entry := range entries {
+		niks := []string{}
+		for _, item := range entry.StatusPasien {
+			if item.PasienNIK != nil {
+				niks = append(niks, *item.PasienNIK)
+			}
+		}
+
+		items := fmt.Sprint(len(entry.StatusPasien))
+		if entry.ParseError != nil {
+			items = "invalid"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Quarantine.ID,
+			entry.Quarantine.Reason,
+			entry.Quarantine.Attempts,
+			entry.Quarantine.QuarantinedAt,
+			valueOrDash(entry.Quarantine.DeadLetterID),
+			items,
+			strings.Join(niks, ","),
+			entry.Quarantine.Error)
+	}
+	w.Flush()
+}
+
+func printItems(items []models.IncomingItemStatusTB) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MESSAGE_ID\tITEM\tPROCESSED_AT\tATTEMPT\tNIK\tTERDUGA_ID\tPASIEN_CKG_ID\tERROR\tRESPONS")
+	for _, item := range items {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%s\t%s\t%s\t%t\t%s\n",
+			item.MessageID,
+			item.ItemIndex,
+			item.ProcessedAt,
+			item.Attempt,
+			valueOrDash(item.PasienNIK),
+			valueOrDash(item.TerdugaID),
+			valueOrDash(item.PasienCkgID),
+			item.IsError,
+			item.Respons)
+	}
+	w.Flush()
+}
+
+func printOutgoing(records []models.OutgoingRecordSkriningTB) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MESSAGE_ID\tPUBLISHED_AT\tATTEMPT\tPASIEN_CKG_ID\tNIK\tTERDUGA\tRECORD_HASH")
+	for _, record := range records {
+		terduga := "-"
+		if record.Terduga != nil {
+			terduga = fmt.Sprint(*record.Terduga)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			record.MessageID,
+			record.PublishedAt,
+			record.Attempt,
+			record.PasienCkgID,
+			record.PasienNIK,
+			terduga,
+			record.RecordHash)
+	}
+	w.Flush()
+}
+
+func printHistory(history []models.StatusPasienHistory) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANGED_AT\tPASIEN_CKG_ID\tNIK\tTERDUGA_ID\tFIELD\tPREVIOUS_VALUE\tNEW_VALUE\tMESSAGE_ID")
+	for _, entry := range history {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.ChangedAt,
+			valueOrDash(entry.PasienCkgID),
+			valueOrDash(entry.PasienNIK),
+			valueOrDash(entry.TerdugaID),
+			entry.Field,
+			valueOrDash(entry.PreviousValue),
+			valueOrDash(entry.NewValue),
+			entry.MessageID)
+	}
+	w.Flush()
+}
+
+func valueOrDash(value *string) string {
+	if value == nil || *value == "" {
+		return "-"
+	}
+	return *value
+}
+
+func printPayload(entries []ckg.ReplayEntry) {
+	for _, entry := range entries {
+		fmt.Printf("# %s (received_at %s)\n", entry.Incoming.ID, entry.Incoming.ReceivedAt)
+		if entry.Incoming.Data == nil {
+			fmt.Println("null")
+			continue
+		}
+
+		var payload any
+		if err := json.Unmarshal([]byte(*entry.Incoming.Data), &payload); err != nil {
+			// Payload tidak valid tetap ditampilkan apa adanya
+			fmt.Println(*entry.Incoming.Data)
+			continue
+		}
+		printJSON(payload)
+	}
+}
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		slog.Error("Gagal menulis output", "error", err)
+	}
+}
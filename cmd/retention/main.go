@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"pubsub-ckg-tb/internal/app"
+	"pubsub-ckg-tb/internal/app/ckg"
+	"syscall"
+)
+
+func main() {
+	once := flag.Bool("once", false, "jalankan satu kali lalu keluar (untuk cron), tanpa flag berjalan setiap RETENTION_INTERVAL")
+	archive := flag.Bool("archive", false, "simpan baris yang dihapus ke RETENTION_ARCHIVE_DIR (RETENTION_ARCHIVE_ENABLED)")
+	flag.Parse()
+
+	app := app.InitDatabaseApp()
+	defer app.Close()
+
+	if *archive {
+		app.Configurations.Retention.Archive.Enabled = true
+	}
+
+	ctx, stop := signal.NotifyContext(app.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	retention := ckg.NewCkgRetention(app.Context, app.Configurations, app.Database)
+	if !*once {
+		retention.Run(ctx)
+		return
+	}
+
+	results, err := retention.Purge(ctx)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if errEnc := enc.Encode(results); errEnc != nil {
+		slog.Error("Gagal menulis output", "error", errEnc)
+	}
+	if errors.Is(err, context.Canceled) {
+		slog.Info("Retention dihentikan")
+		return
+	}
+	if err != nil {
+		slog.Error("Retention gagal", "error", err)
+		os.Exit(1)
+	}
+}
@@ -18,6 +18,21 @@ type App struct {
 }
 
 func InitApp() (*App, error) {
+	app := InitDatabaseApp()
+
+	// Initialize PubSub client
+	pubsubClient, err := pubsubInternal.NewClient(app.Context, app.Configurations)
+	if err != nil {
+		return nil, err
+	}
+	app.PubSub = pubsubClient
+
+	return app, nil
+}
+
+// InitDatabaseApp menginisialisasi aplikasi hanya dengan koneksi database,
+// untuk tools yang tidak membutuhkan PubSub (misalnya replay)
+func InitDatabaseApp() *App {
 	// Load env variables dari file .env
 	cfg := config.GetConfig()
 
@@ -35,18 +50,11 @@ func InitApp() (*App, error) {
 	dbConn := database.GetConnection(&cfg.Database)
 	dbConn.Connect(ctx)
 
-	// Initialize PubSub client
-	pubsubClient, err := pubsubInternal.NewClient(ctx, cfg)
-	if err != nil {
-		return nil, err
-	}
-
 	return &App{
 		Configurations: cfg,
 		Context:        ctx,
 		Database:       dbConn,
-		PubSub:         pubsubClient,
-	}, nil
+	}
 }
 
 func (a *App) RunPubSubConsumer(receiver pubsubInternal.Receiver) {
@@ -61,6 +69,16 @@ func (a *App) RunPubSubConsumer(receiver pubsubInternal.Receiver) {
 		return
 	}
 
+	if a.Configurations.Consumer.DeadLetterPolicy.Enabled && !a.PubSub.Broker.TopicExists(a.Context, a.Configurations.DeadLetterTopic()) {
+		slog.Error("Dead-letter topic tidak ditemukan", "topic", a.Configurations.DeadLetterTopic())
+		return
+	}
+
+	if a.Configurations.Consumer.Reply.Enabled && !a.PubSub.Broker.TopicExists(a.Context, a.Configurations.ReplyTopic()) {
+		slog.Error("Reply topic tidak ditemukan", "topic", a.Configurations.ReplyTopic())
+		return
+	}
+
 	// Start consuming messages in a loop
 	a.PubSub.StartConsumer(a.Context, receiver)
 }
@@ -73,5 +91,7 @@ func (a *App) RunPubSubProducer(transmitter pubsubInternal.Transmitter, watchMod
 func (a *App) Close() {
 	slog.Info("Closing application resources...")
 	database.CloseConnection(a.Context)
-	a.PubSub.Close()
+	if a.PubSub != nil {
+		a.PubSub.Close()
+	}
 }
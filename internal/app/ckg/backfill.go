@@ -0,0 +1,166 @@
+package ckg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"pubsub-ckg-tb/internal/models"
+	"pubsub-ckg-tb/internal/repository"
+)
+
+// BackfillJob adalah pengiriman ulang data skrining sesuai filter. Progres disimpan ke checkpoint
+// "backfill:<ID>" setelah setiap halaman terkirim, sehingga job yang terhenti dilanjutkan dari
+// halaman berikutnya ketika dijalankan ulang dengan ID (atau filter) yang sama.
+type BackfillJob struct {
+	ID            string // nama job, kosong = dihitung dari filter dan limit
+	Filter        repository.SkriningFilter
+	Limit         int64         // jumlah maksimal data skrining (0 = semua)
+	Throttle      time.Duration // jeda antar halaman
+	Restart       bool          // abaikan checkpoint dan mulai dari awal
+	SkipUnchanged bool          // lewati data yang tidak berubah sejak terakhir dikirim
+}
+
+// backfillPosition adalah isi checkpoint backfill
+type backfillPosition struct {
+	Filter repository.SkriningFilter `json:"filter"`
+	Limit  int64                     `json:"limit"`
+	Cursor pendingCursor             `json:"cursor"`
+	Done   bool                      `json:"done"`
+}
+
+// RunBackfill mengirim ulang data skrining sesuai job per halaman: halaman disimpan ke outbox,
+// outbox dikirim ke broker, lalu posisi halaman disimpan ke checkpoint
+func (t *CkgTransmitter) RunBackfill(ctx context.Context, job BackfillJob) error {
+	job.Filter.Start = windowTime(job.Filter.Start, false)
+	job.Filter.End = windowTime(job.Filter.End, true)
+
+	if job.ID == "" {
+		id, err := backfillJobID(job.Filter, job.Limit)
+		if err != nil {
+			return err
+		}
+		job.ID = id
+	}
+	checkpointID := "backfill:" + job.ID
+
+	position, err := t.loadBackfillPosition(checkpointID, job)
+	if err != nil {
+		return err
+	}
+	if position.Done {
+		slog.Info("Backfill sudah selesai, gunakan restart untuk mengulang", "job", job.ID, "total", position.Cursor.Total)
+		return nil
+	}
+
+	// Kirim dulu sisa outbox dari proses sebelumnya yang terhenti
+	if err := t.DrainOutbox(ctx); err != nil {
+		return err
+	}
+
+	slog.Info("Memulai backfill data skrining",
+		"job", job.ID,
+		"start", position.Filter.Start,
+		"end", position.Filter.End,
+		"kode_faskes", position.Filter.KodeFaskes,
+		"provinsi_faskes", position.Filter.ProvinsiFaskes,
+		"limit", position.Limit,
+		"resume_from", position.Cursor.UpdatedAt,
+		"sent", position.Cursor.Total)
+
+	err = t.forEachPendingPage(ctx, position.Filter, position.Limit, position.Cursor, func(page []*models.SkriningCKGResult, next pendingCursor) error {
+		if job.SkipUnchanged {
+			page = t.skipUnchanged(page)
+		}
+		if err := t.enqueueBatches(page); err != nil {
+			return err
+		}
+		if err := t.DrainOutbox(ctx); err != nil {
+			return err
+		}
+
+		position.Cursor = next
+		if err := t.saveBackfillPosition(checkpointID, position); err != nil {
+			return err
+		}
+		slog.Info("Backfill halaman terkirim", "job", job.ID, "page", len(page), "total", next.Total, "updated_at", next.UpdatedAt)
+
+		sleepContext(ctx, job.Throttle)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	position.Done = true
+	if err := t.saveBackfillPosition(checkpointID, position); err != nil {
+		return err
+	}
+
+	slog.Info("Backfill selesai", "job", job.ID, "total", position.Cursor.Total)
+	return nil
+}
+
+// loadBackfillPosition membaca progres job dari checkpoint. Job yang dilanjutkan memakai filter
+// dari checkpoint, sehingga rentang data tidak berubah di tengah jalan.
+func (t *CkgTransmitter) loadBackfillPosition(checkpointID string, job BackfillJob) (backfillPosition, error) {
+	position := backfillPosition{
+		Filter: job.Filter,
+		Limit:  job.Limit,
+	}
+
+	// Tanpa batas akhir, data yang berubah setelah job dimulai tidak ikut dikirim
+	if position.Filter.End == "" {
+		position.Filter.End = time.Now().Format(time.RFC3339)
+	}
+
+	if job.Restart {
+		return position, nil
+	}
+
+	checkpoint, err := t.CheckpointRepo.GetCheckpoint(checkpointID)
+	if err != nil {
+		return position, err
+	}
+	if checkpoint == nil || checkpoint.Position == "" {
+		return position, nil
+	}
+
+	saved := backfillPosition{}
+	if err := json.Unmarshal([]byte(checkpoint.Position), &saved); err != nil {
+		return position, fmt.Errorf("checkpoint backfill tidak valid: %w", err)
+	}
+
+	slog.Info("Melanjutkan backfill dari checkpoint", "checkpoint", checkpointID, "updated_at", saved.Cursor.UpdatedAt, "sent", saved.Cursor.Total)
+	return saved, nil
+}
+
+func (t *CkgTransmitter) saveBackfillPosition(checkpointID string, position backfillPosition) error {
+	data, err := json.Marshal(position)
+	if err != nil {
+		return err
+	}
+
+	return t.CheckpointRepo.SaveCheckpoint(models.Checkpoint{
+		ID:           checkpointID,
+		Position:     string(data),
+		CheckpointAt: position.Cursor.UpdatedAt,
+		UpdatedAt:    time.Now().Format(time.RFC3339),
+	})
+}
+
+// backfillJobID menghasilkan nama job dari filter dan limit, sehingga perintah yang sama
+// melanjutkan job yang sama
+func backfillJobID(filter repository.SkriningFilter, limit int64) (string, error) {
+	data, err := json.Marshal(backfillPosition{Filter: filter, Limit: limit})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12], nil
+}
@@ -0,0 +1,144 @@
+package ckg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"pubsub-ckg-tb/internal/db/sql"
+	"pubsub-ckg-tb/internal/db/utils"
+	"pubsub-ckg-tb/internal/models"
+)
+
+// watchBinlog memantau tabel skrining MySQL dengan membaca binlog (row event) seperti replica.
+// Posisi file/pos disimpan ke checkpoint di akhir setiap transaksi, sehingga setelah restart
+// pembacaan dilanjutkan dari transaksi berikutnya.
+func (t *CkgTransmitter) watchBinlog(ctx context.Context) {
+	sqlDB, ok := t.Database.(*sql.SQLConnection)
+	if !ok {
+		slog.Error("Koneksi database bukan SQL, binlog tidak bisa dibaca")
+		return
+	}
+
+	cfg := t.Configurations.Producer.Watch
+	checkpointID := "binlog:" + t.Configurations.CKG.TableSkrining
+
+	slog.Info("Memulai pembacaan binlog pada tabel",
+		"table", t.Configurations.CKG.TableSkrining,
+		"server_id", cfg.ServerID)
+
+	// Perubahan yang terdeteksi masuk ke outbox, relay yang mengirimkan ke broker
+	go t.RunOutboxRelay(ctx)
+
+	for ctx.Err() == nil {
+		err := t.streamBinlog(ctx, sqlDB, checkpointID)
+		if ctx.Err() != nil {
+			break
+		}
+
+		// Stream dibuka ulang dari checkpoint terakhir
+		slog.Error("Binlog terputus, membuka ulang", "error", err)
+		sleepContext(ctx, cfg.PollInterval)
+	}
+
+	slog.Info("Context cancelled, stopping binlog reader...")
+}
+
+func (t *CkgTransmitter) streamBinlog(ctx context.Context, sqlDB *sql.SQLConnection, checkpointID string) error {
+	cfg := t.Configurations.Producer.Watch
+
+	position, err := t.loadBinlogPosition(ctx, sqlDB, checkpointID)
+	if err != nil {
+		return err
+	}
+
+	reader, err := sqlDB.OpenBinlog(ctx, cfg.ServerID, position, t.Configurations.CKG.TableSkrining)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// Checkpoint disimpan setelah transaksi yang berisi perubahan skrining, transaksi lain
+	// (termasuk tulisan outbox dan checkpoint sendiri) cukup disimpan berkala
+	dirty := false
+	lastSaved := time.Now()
+	for {
+		event, err := reader.Next(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, change := range event.Changes {
+			if err := t.processRowChange(change.Operation, change.Data); err != nil {
+				if utils.IsTransientError(err) {
+					// Transaksi ini dibaca ulang dari checkpoint sebelumnya
+					return fmt.Errorf("binlog berhenti di %s: %w", event.Position.String(), err)
+				}
+				slog.Error("Gagal memproses perubahan", "position", event.Position.String(), "error", err)
+			}
+			dirty = true
+		}
+
+		if !event.Commit {
+			continue
+		}
+		if !dirty && time.Since(lastSaved) < cfg.PollInterval {
+			continue
+		}
+
+		if err := t.saveBinlogPosition(checkpointID, event.Position); err != nil {
+			return err
+		}
+		dirty = false
+		lastSaved = time.Now()
+	}
+}
+
+// loadBinlogPosition membaca posisi dari checkpoint. Tanpa checkpoint, data sejak outgoing terakhir
+// di-backfill lalu pembacaan dimulai dari posisi binlog saat ini.
+func (t *CkgTransmitter) loadBinlogPosition(ctx context.Context, sqlDB *sql.SQLConnection, checkpointID string) (sql.BinlogPosition, error) {
+	position := sql.BinlogPosition{}
+
+	checkpoint, err := t.CheckpointRepo.GetCheckpoint(checkpointID)
+	if err != nil {
+		return position, err
+	}
+
+	if checkpoint != nil && checkpoint.Position != "" {
+		if err := json.Unmarshal([]byte(checkpoint.Position), &position); err != nil {
+			return position, fmt.Errorf("posisi binlog tidak valid: %w", err)
+		}
+		return position, nil
+	}
+
+	// Posisi diambil sebelum backfill agar perubahan selama backfill tetap terbaca dari binlog
+	position, err = sqlDB.CurrentBinlogPosition(ctx)
+	if err != nil {
+		return position, err
+	}
+	slog.Info("Checkpoint binlog belum ada, backfill lalu mulai dari posisi saat ini", "position", position.String())
+
+	start, _ := t.PubSubRepo.GetLastOutgoingTimestamp()
+	if err := t.Backfill(ctx, start, time.Now().Format(time.RFC3339)); err != nil {
+		return position, err
+	}
+
+	return position, t.saveBinlogPosition(checkpointID, position)
+}
+
+func (t *CkgTransmitter) saveBinlogPosition(checkpointID string, position sql.BinlogPosition) error {
+	data, err := json.Marshal(position)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	return t.CheckpointRepo.SaveCheckpoint(models.Checkpoint{
+		ID:           checkpointID,
+		Position:     string(data),
+		CheckpointAt: now,
+		UpdatedAt:    now,
+	})
+}
@@ -0,0 +1,85 @@
+package ckg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"pubsub-ckg-tb/internal/models"
+	"pubsub-ckg-tb/internal/pubsub/broker"
+)
+
+// Alasan message dikarantina
+const (
+	QuarantineReasonParse          = "parse_error"
+	QuarantineReasonPermanent      = "permanent_error"
+	QuarantineReasonRetryExhausted = "retry_exhausted"
+)
+
+// DeadLetter mengirim message ke dead-letter topic dan mencatatnya di tabel karantina.
+// Jika dead-letter policy tidak aktif tidak ada yang dilakukan. Error dikembalikan agar
+// message di-nack dan tidak hilang.
+func (r *CkgReceiver) DeadLetter(ctx context.Context, msg *broker.Message, reason string, cause error, attempts int) error {
+	policy := r.Configurations.Consumer.DeadLetterPolicy
+	if !policy.Enabled {
+		return nil
+	}
+
+	errMessage := ""
+	if cause != nil {
+		errMessage = cause.Error()
+	}
+
+	// Simpan atribut asli dan tambahkan informasi penyebab
+	attributes := make(map[string]string, len(msg.Attributes)+4)
+	for k, v := range msg.Attributes {
+		attributes[k] = v
+	}
+	attributes["dead_letter_reason"] = reason
+	attributes["dead_letter_error"] = errMessage
+	attributes["original_message_id"] = msg.ID
+	attributes["attempts"] = strconv.Itoa(attempts)
+
+	topic := r.Configurations.DeadLetterTopic()
+	deadLetterID, err := r.Broker.Publish(ctx, topic, &broker.Message{
+		Data:       msg.Data,
+		Attributes: attributes,
+	})
+	if err != nil {
+		return fmt.Errorf("gagal publish ke dead-letter topic %s: %v", topic, err)
+	}
+
+	data := string(msg.Data)
+	originalAttributes, _ := json.Marshal(msg.Attributes)
+	attributesStr := string(originalAttributes)
+	quarantine := models.QuarantineMessage{
+		ID:              msg.ID,
+		Data:            &data,
+		Attributes:      &attributesStr,
+		Reason:          reason,
+		Error:           errMessage,
+		Attempts:        attempts,
+		DeliveryAttempt: msg.DeliveryAttempt,
+		DeadLetterID:    &deadLetterID,
+		QuarantinedAt:   time.Now().Format(time.RFC3339),
+	}
+	if err := r.PubSubRepo.SaveQuarantine(quarantine); err != nil {
+		return fmt.Errorf("gagal menyimpan message ke karantina: %v", err)
+	}
+
+	slog.Warn("Message dipindahkan ke dead-letter", "id", msg.ID, "reason", reason, "topic", topic, "error", errMessage)
+	return nil
+}
+
+// deliveryExhausted memeriksa apakah message sudah mencapai batas pengiriman ulang dari broker.
+// Jika broker tidak memberikan jumlah pengiriman, cukup batas retry internal yang berlaku.
+func (r *CkgReceiver) deliveryExhausted(msg *broker.Message) bool {
+	maxDelivery := r.Configurations.Consumer.DeadLetterPolicy.MaxDeliveryAttempts
+	if maxDelivery <= 0 || msg.DeliveryAttempt == nil {
+		return true
+	}
+	return *msg.DeliveryAttempt >= maxDelivery
+}
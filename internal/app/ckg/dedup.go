@@ -0,0 +1,179 @@
+package ckg
+
+import (
+	"log/slog"
+
+	"pubsub-ckg-tb/internal/models"
+)
+
+// recordHash menghitung hash data skrining dari field yang relevan untuk SITB
+// (ProducerConfig.Dedup.Fields), atau dari semua field jika tidak dikonfigurasi
+func (t *CkgTransmitter) recordHash(skrining *models.SkriningCKGResult) (string, error) {
+	data := skrining.ToMap()
+
+	fields := t.Configurations.Producer.Dedup.Fields
+	if len(fields) > 0 {
+		relevant := make(map[string]any, len(fields))
+		for _, field := range fields {
+			relevant[field] = data[field]
+		}
+		data = relevant
+	}
+
+	return models.ContentHash(data)
+}
+
+// retractionHash adalah hash yang dicatat di log outgoing saat retraksi terkirim, sehingga
+// data skrining berikutnya untuk pasien yang sama selalu dianggap berubah
+func retractionHash(pasienCkgID string) (string, error) {
+	return models.ContentHash(map[string]any{"retraksi": pasienCkgID})
+}
+
+// sentAsTerduga memeriksa apakah data terakhir yang terkirim atau menunggu di outbox untuk
+// pasien_ckg_id adalah data skrining terduga TB
+func (t *CkgTransmitter) sentAsTerduga(pasienCkgID string) (bool, error) {
+	latest, err := t.findLatest([]string{pasienCkgID})
+	if err != nil {
+		return false, err
+	}
+	last, ok := latest[pasienCkgID]
+	if !ok {
+		return false, nil
+	}
+	if last.Terduga != nil {
+		return *last.Terduga, nil
+	}
+
+	// Data yang tercatat sebelum flag terduga disimpan: selain retraksi dianggap terduga
+	hash, err := retractionHash(pasienCkgID)
+	if err != nil {
+		return false, err
+	}
+	return last.RecordHash != hash, nil
+}
+
+// findLatest mengembalikan data terakhir per pasien_ckg_id yang sudah terkirim atau menunggu di outbox.
+// Pasien yang belum ada di cache dibaca sekaligus dari tabel data terakhir per pasien.
+func (t *CkgTransmitter) findLatest(pasienCkgIDs []string) (map[string]models.OutgoingLatestSkriningTB, error) {
+	result := map[string]models.OutgoingLatestSkriningTB{}
+	missing := []string{}
+	for _, id := range pasienCkgIDs {
+		if latest, found := t.latest.Get(id); found {
+			if latest != nil {
+				result[id] = *latest
+			}
+			continue
+		}
+		missing = append(missing, id)
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	stored, err := t.PubSubRepo.FindLatestOutgoing(missing)
+	if err != nil {
+		return result, err
+	}
+	for _, id := range missing {
+		latest, ok := stored[id]
+		if !ok {
+			t.latest.Put(id, nil)
+			continue
+		}
+		t.latest.Put(id, &latest)
+		result[id] = latest
+	}
+
+	return result, nil
+}
+
+// queueLatest mencatat data yang baru masuk outbox sebagai data terakhir per pasien, sehingga
+// perubahan berikutnya dibandingkan dengan data ini walaupun outbox belum dikirim relay
+func (t *CkgTransmitter) queueLatest(outboxID string, records []models.OutgoingRecordSkriningTB, queuedAt string) {
+	latest := make([]models.OutgoingLatestSkriningTB, 0, len(records))
+	for _, record := range records {
+		if record.PasienCkgID == "" {
+			continue
+		}
+		latest = append(latest, models.OutgoingLatestSkriningTB{
+			PasienCkgID: record.PasienCkgID,
+			OutboxID:    &outboxID,
+			PasienNIK:   record.PasienNIK,
+			RecordHash:  record.RecordHash,
+			Terduga:     record.Terduga,
+			QueuedAt:    &queuedAt,
+		})
+	}
+
+	if err := t.PubSubRepo.QueueLatestOutgoing(latest); err != nil {
+		slog.Warn("Gagal mencatat data terakhir per pasien", "outbox_id", outboxID, "error", err)
+	}
+	for i := range latest {
+		t.latest.Put(latest[i].PasienCkgID, &latest[i])
+	}
+}
+
+// releaseLatest membuang data terakhir yang dicatat outbox yang tidak akan dikirim lagi, sehingga
+// pasien tersebut kembali dibandingkan dengan data terakhir yang benar-benar terkirim
+func (t *CkgTransmitter) releaseLatest(outbox models.OutboxMessage) {
+	if err := t.PubSubRepo.ReleaseLatestOutgoing(outbox.ID); err != nil {
+		slog.Warn("Gagal menghapus data terakhir per pasien", "outbox_id", outbox.ID, "error", err)
+	}
+	for _, record := range outboxRecords(outbox) {
+		t.latest.Remove(record.PasienCkgID)
+	}
+}
+
+// markSent membuang entri cache yang lebih lama dari data yang baru terkirim, yaitu pasien yang tercatat
+// belum pernah dikirim atau data yang tercatat sebelum outbox id disimpan
+func (t *CkgTransmitter) markSent(records []models.OutgoingRecordSkriningTB) {
+	for _, record := range records {
+		if latest, found := t.latest.Get(record.PasienCkgID); found && (latest == nil || latest.OutboxID == nil) {
+			t.latest.Remove(record.PasienCkgID)
+		}
+	}
+}
+
+// skipUnchanged membuang data skrining yang isinya sama dengan data terakhir yang terkirim atau
+// menunggu di outbox untuk pasien_ckg_id yang sama
+func (t *CkgTransmitter) skipUnchanged(output []*models.SkriningCKGResult) []*models.SkriningCKGResult {
+	if !t.Configurations.Producer.Dedup.Enabled {
+		return output
+	}
+
+	ids := make([]string, 0, len(output))
+	for _, skrining := range output {
+		if skrining.PasienCKGID != "" {
+			ids = append(ids, skrining.PasienCKGID)
+		}
+	}
+	latest, err := t.findLatest(ids)
+	if err != nil {
+		slog.Warn("Gagal membaca data terakhir per pasien", "error", err)
+	}
+
+	result := make([]*models.SkriningCKGResult, 0, len(output))
+	for _, skrining := range output {
+		if skrining.PasienCKGID == "" {
+			result = append(result, skrining)
+			continue
+		}
+
+		hash, err := t.recordHash(skrining)
+		if err != nil {
+			result = append(result, skrining)
+			continue
+		}
+
+		if last, ok := latest[skrining.PasienCKGID]; ok && last.RecordHash == hash {
+			slog.Debug("Skip data skrining yang tidak berubah", "pasien_ckg_id", skrining.PasienCKGID)
+			continue
+		}
+
+		// Data yang sama untuk pasien ini di halaman yang sama dibandingkan dengan data ini
+		latest[skrining.PasienCKGID] = models.OutgoingLatestSkriningTB{PasienCkgID: skrining.PasienCKGID, RecordHash: hash}
+		result = append(result, skrining)
+	}
+
+	return result
+}
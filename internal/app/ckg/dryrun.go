@@ -0,0 +1,141 @@
+package ckg
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"pubsub-ckg-tb/internal/models"
+	"pubsub-ckg-tb/internal/pubsub/broker"
+)
+
+// DryRunOutput menulis hasil dry-run producer dan consumer sebagai JSON lines
+type DryRunOutput struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	file    *os.File
+}
+
+// NewDryRunOutput membuka file output dry-run, path kosong atau "-" berarti stdout
+func NewDryRunOutput(path string) (*DryRunOutput, error) {
+	if path == "" || path == "-" {
+		return newDryRunOutput(os.Stdout, nil), nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return newDryRunOutput(file, file), nil
+}
+
+func newDryRunOutput(w io.Writer, file *os.File) *DryRunOutput {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return &DryRunOutput{encoder: encoder, file: file}
+}
+
+// Write menulis satu baris JSON
+func (o *DryRunOutput) Write(v any) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.encoder.Encode(v)
+}
+
+// Close menutup file output, stdout tidak ditutup
+func (o *DryRunOutput) Close() error {
+	if o.file == nil {
+		return nil
+	}
+	return o.file.Close()
+}
+
+// dryRunMessage adalah message yang akan dikirim producer
+type dryRunMessage struct {
+	Topic      string            `json:"topic"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Count      int               `json:"count"`
+	Data       json.RawMessage   `json:"data"`
+}
+
+// dryRunDecision adalah hasil UpdateTbPatientStatus untuk satu message pada consumer
+type dryRunDecision struct {
+	ID      string                      `json:"id"`
+	Results []models.StatusPasienResult `json:"results,omitempty"`
+	Error   string                      `json:"error,omitempty"`
+}
+
+// dryRunHold menahan message consumer dry-run tanpa ack maupun nack. Message yang ditahan tidak
+// dikirim ulang broker sehingga setiap message hanya diproses sekali, dan flow control broker
+// menghentikan pengiriman message baru saat jumlah message yang ditahan mencapai batas outstanding.
+// Setelah limit message atau tidak ada message baru selama idle, semua message di-nack sekaligus
+// agar segera tersedia untuk consumer sebenarnya, lalu Done ditutup untuk menghentikan consumer.
+type dryRunHold struct {
+	mu       sync.Mutex
+	limit    int
+	idle     time.Duration
+	held     []*broker.Message
+	timer    *time.Timer
+	done     chan struct{}
+	released bool
+}
+
+func newDryRunHold(limit int, idle time.Duration) *dryRunHold {
+	h := &dryRunHold{
+		limit: limit,
+		idle:  idle,
+		done:  make(chan struct{}),
+	}
+	h.timer = time.AfterFunc(idle, func() {
+		slog.Info("Tidak ada message baru pada dry-run, menghentikan consumer", "idle", idle)
+		h.release()
+	})
+	return h
+}
+
+// Hold menahan messages, message yang datang setelah release langsung di-nack
+func (h *dryRunHold) Hold(messages []*broker.Message) {
+	h.mu.Lock()
+	if h.released {
+		h.mu.Unlock()
+		for _, msg := range messages {
+			msg.Nack()
+		}
+		return
+	}
+
+	h.held = append(h.held, messages...)
+	h.timer.Reset(h.idle)
+	full := h.limit > 0 && len(h.held) >= h.limit
+	h.mu.Unlock()
+
+	if full {
+		slog.Info("Batas message dry-run tercapai, menghentikan consumer", "limit", h.limit)
+		h.release()
+	}
+}
+
+// release me-nack semua message yang ditahan lalu menutup Done
+func (h *dryRunHold) release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.released {
+		return
+	}
+
+	h.released = true
+	h.timer.Stop()
+	for _, msg := range h.held {
+		msg.Nack()
+	}
+	h.held = nil
+	close(h.done)
+}
+
+// Done ditutup setelah message yang ditahan dilepas
+func (h *dryRunHold) Done() <-chan struct{} {
+	return h.done
+}
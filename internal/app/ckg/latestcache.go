@@ -0,0 +1,79 @@
+package ckg
+
+import (
+	"container/list"
+	"sync"
+
+	"pubsub-ckg-tb/internal/models"
+)
+
+// latestCache menyimpan data terakhir per pasien_ckg_id dengan jumlah entri terbatas. Jika penuh,
+// entri yang paling lama tidak dipakai dibuang (LRU). Entri nil berarti pasien belum pernah dikirim,
+// sehingga pasien tersebut tidak dibaca ulang dari database.
+type latestCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type latestCacheEntry struct {
+	pasienCkgID string
+	latest      *models.OutgoingLatestSkriningTB
+}
+
+// newLatestCache membuat cache dengan maksimal size entri, size <= 0 berarti tanpa cache
+func newLatestCache(size int) *latestCache {
+	return &latestCache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Get mengembalikan data terakhir pasien dan apakah pasien ada di cache
+func (c *latestCache) Get(pasienCkgID string) (*models.OutgoingLatestSkriningTB, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[pasienCkgID]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*latestCacheEntry).latest, true
+}
+
+// Put menyimpan data terakhir pasien, nil untuk pasien yang belum pernah dikirim
+func (c *latestCache) Put(pasienCkgID string, latest *models.OutgoingLatestSkriningTB) {
+	if c.size <= 0 || pasienCkgID == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[pasienCkgID]; ok {
+		elem.Value.(*latestCacheEntry).latest = latest
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[pasienCkgID] = c.order.PushFront(&latestCacheEntry{pasienCkgID: pasienCkgID, latest: latest})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*latestCacheEntry).pasienCkgID)
+	}
+}
+
+// Remove membuang pasien dari cache sehingga dibaca ulang dari database
+func (c *latestCache) Remove(pasienCkgID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[pasienCkgID]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, pasienCkgID)
+	}
+}
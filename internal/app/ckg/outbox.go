@@ -0,0 +1,344 @@
+package ckg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"pubsub-ckg-tb/internal/models"
+	"pubsub-ckg-tb/internal/pubsub/broker"
+
+	"github.com/google/uuid"
+)
+
+// Enqueue menyimpan batch hasil skrining ke outbox dengan status pending.
+// Pengiriman ke broker dilakukan oleh relay sehingga tidak ada batch yang hilang
+// jika producer berhenti di tengah jalan.
+func (t *CkgTransmitter) Enqueue(batch []*models.SkriningCKGResult, attributes map[string]string) (*models.OutboxMessage, error) {
+	pubsubObjectWrapper := models.NewPubSubProducerWrapper(batch)
+	jsonStr, err := pubsubObjectWrapper.ToJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	// Catat data skrining yang dibawa message untuk log outgoing per pasien
+	records := make([]models.OutgoingRecordSkriningTB, 0, len(batch))
+	for _, skrining := range batch {
+		hash, err := t.recordHash(skrining)
+		if err != nil {
+			return nil, err
+		}
+		// Batch mode juga mengirim data yang bukan terduga, flag ini menentukan perlu tidaknya retraksi
+		terduga := skrining.TerdugaTb != nil && *skrining.TerdugaTb == "Ya"
+		records = append(records, models.OutgoingRecordSkriningTB{
+			PasienCkgID: skrining.PasienCKGID,
+			PasienNIK:   skrining.PasienNIK,
+			RecordHash:  hash,
+			Terduga:     &terduga,
+		})
+	}
+
+	return t.saveOutbox(jsonStr, records, attributes)
+}
+
+// EnqueueRetraction menyimpan retraksi data skrining ke outbox, dikirim relay seperti batch skrining
+func (t *CkgTransmitter) EnqueueRetraction(batch []*models.RetraksiSkriningCKG, attributes map[string]string) (*models.OutboxMessage, error) {
+	pubsubObjectWrapper := models.NewPubSubRetractionWrapper(batch)
+	jsonStr, err := pubsubObjectWrapper.ToJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]models.OutgoingRecordSkriningTB, 0, len(batch))
+	for _, retraksi := range batch {
+		hash, err := retractionHash(retraksi.PasienCKGID)
+		if err != nil {
+			return nil, err
+		}
+		terduga := false
+		record := models.OutgoingRecordSkriningTB{
+			PasienCkgID: retraksi.PasienCKGID,
+			RecordHash:  hash,
+			Terduga:     &terduga,
+		}
+		if retraksi.PasienNIK != nil {
+			record.PasienNIK = *retraksi.PasienNIK
+		}
+		records = append(records, record)
+	}
+
+	return t.saveOutbox(jsonStr, records, attributes)
+}
+
+func (t *CkgTransmitter) saveOutbox(jsonStr string, records []models.OutgoingRecordSkriningTB, attributes map[string]string) (*models.OutboxMessage, error) {
+	now := time.Now().Format(time.RFC3339)
+	outbox := models.OutboxMessage{
+		ID:        uuid.NewString(),
+		Topic:     t.Configurations.PubSub.Topic,
+		Data:      jsonStr,
+		State:     models.OutboxStatePending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	recordBytes, err := json.Marshal(records)
+	if err != nil {
+		return nil, err
+	}
+	recordStr := string(recordBytes)
+	outbox.Records = &recordStr
+
+	if len(attributes) > 0 {
+		attrBytes, err := json.Marshal(attributes)
+		if err != nil {
+			return nil, err
+		}
+		attrStr := string(attrBytes)
+		outbox.Attributes = &attrStr
+	}
+
+	if err := t.OutboxRepo.SaveOutbox(outbox); err != nil {
+		return nil, fmt.Errorf("gagal menyimpan outbox: %w", err)
+	}
+	t.queueLatest(outbox.ID, records, now)
+
+	return &outbox, nil
+}
+
+// RunOutboxRelay mengirim isi outbox secara berkala sampai ctx selesai
+func (t *CkgTransmitter) RunOutboxRelay(ctx context.Context) {
+	interval := t.Configurations.Producer.Outbox.RelayInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	slog.Info("Memulai outbox relay", "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, _, err := t.RelayOutbox(ctx); err != nil {
+			slog.Error("Gagal menjalankan outbox relay", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Context cancelled, stopping outbox relay...")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DrainOutbox menjalankan relay sampai tidak ada lagi message yang bisa dikirim.
+// Message yang gagal dicoba ulang setelah RelayInterval sampai batas MaxAttempts.
+func (t *CkgTransmitter) DrainOutbox(ctx context.Context) error {
+	for ctx.Err() == nil {
+		published, failed, err := t.RelayOutbox(ctx)
+		if err != nil {
+			return err
+		}
+		if published == 0 && failed == 0 {
+			return nil
+		}
+
+		if failed > 0 {
+			sleepContext(ctx, t.Configurations.Producer.Outbox.RelayInterval)
+		}
+	}
+
+	return ctx.Err()
+}
+
+// RelayOutbox mengirim satu batch message dari outbox dan mengembalikan jumlah yang
+// berhasil dan gagal dikirim. Setiap message diklaim (publishing) sebelum dikirim,
+// sehingga jika proses berhenti message tetap tercatat dan dikirim ulang (at-least-once).
+func (t *CkgTransmitter) RelayOutbox(ctx context.Context) (int, int, error) {
+	cfg := t.Configurations.Producer.Outbox
+	staleBefore := time.Now().Add(-cfg.PublishingTimeout).Format(time.RFC3339)
+
+	pending, err := t.OutboxRepo.GetRelayableOutbox(cfg.MaxAttempts, staleBefore, int64(cfg.BatchSize))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	published, failed := 0, 0
+	countResult := func(ok bool) {
+		if ok {
+			published++
+		} else {
+			failed++
+		}
+	}
+
+	// Klaim semua message lalu kirim per topic secara bersamaan melalui bulk publish
+	claimed := map[string][]models.OutboxMessage{}
+	messages := map[string][]*broker.Message{}
+	for _, outbox := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+
+		ok, err := t.OutboxRepo.ClaimOutbox(outbox, time.Now().Format(time.RFC3339))
+		if err != nil {
+			return published, failed, err
+		}
+		if !ok {
+			// Sudah diambil relay lain
+			continue
+		}
+
+		msg, err := t.outboxMessage(outbox)
+		if err != nil {
+			countResult(t.recordPublishResult(outbox, msg, "", err))
+			continue
+		}
+
+		// Publish yang gagal menahan ordering key-nya, dilanjutkan saat message tersebut dikirim ulang
+		topic := t.outboxTopic(outbox)
+		if outbox.Attempts > 0 && msg.OrderingKey != "" {
+			t.Broker.ResumePublish(topic, msg.OrderingKey)
+		}
+		claimed[topic] = append(claimed[topic], outbox)
+		messages[topic] = append(messages[topic], msg)
+	}
+
+	for topic, msgs := range messages {
+		outcomes := broker.PublishAll(ctx, t.Broker, topic, msgs, t.Configurations.Producer.Publish.MaxInFlight)
+		for i, outcome := range outcomes {
+			countResult(t.recordPublishResult(claimed[topic][i], msgs[i], outcome.ID, outcome.Err))
+		}
+	}
+
+	if published > 0 || failed > 0 {
+		slog.Info("Outbox relay selesai", "published", published, "failed", failed)
+	}
+
+	return published, failed, nil
+}
+
+// outboxTopic mengembalikan topic tujuan outbox, topic utama jika tidak diisi
+func (t *CkgTransmitter) outboxTopic(outbox models.OutboxMessage) string {
+	if outbox.Topic == "" {
+		return t.Configurations.PubSub.Topic
+	}
+	return outbox.Topic
+}
+
+// outboxMessage menyusun message dari outbox. Dengan message ordering aktif, message yang hanya
+// membawa data satu pasien diberi ordering key pasien_ckg_id agar perubahan data pasien tersebut
+// diterima berurutan.
+func (t *CkgTransmitter) outboxMessage(outbox models.OutboxMessage) (*broker.Message, error) {
+	msg := &broker.Message{
+		Data:       []byte(outbox.Data),
+		Attributes: map[string]string{},
+	}
+
+	if outbox.Attributes != nil {
+		if err := json.Unmarshal([]byte(*outbox.Attributes), &msg.Attributes); err != nil {
+			return msg, fmt.Errorf("attributes outbox tidak valid: %w", err)
+		}
+	}
+	msg.Attributes["outbox_id"] = outbox.ID
+
+	// Payload disimpan di outbox tanpa kompresi, kompresi dilakukan saat publish
+	if compression := t.Configurations.Producer.Compression; compression.Enabled {
+		data, err := broker.Compress(compression.Algorithm, msg.Data)
+		if err != nil {
+			return msg, fmt.Errorf("gagal mengompresi payload: %w", err)
+		}
+		msg.Data = data
+		msg.Attributes[broker.ContentEncodingAttribute] = compression.Algorithm
+	}
+
+	if t.Configurations.MessageOrdering() {
+		msg.OrderingKey = orderingKey(outboxRecords(outbox))
+	}
+
+	slog.Debug("Publish Message", "outbox_id", outbox.ID, "message", outbox.Data, "size", len(msg.Data), "attributes", msg.Attributes, "ordering_key", msg.OrderingKey)
+	return msg, nil
+}
+
+// orderingKey mengembalikan pasien_ckg_id jika semua data di dalam message milik pasien yang sama
+func orderingKey(records []models.OutgoingRecordSkriningTB) string {
+	key := ""
+	for _, record := range records {
+		if key != "" && record.PasienCkgID != key {
+			return ""
+		}
+		key = record.PasienCkgID
+	}
+	return key
+}
+
+func outboxRecords(outbox models.OutboxMessage) []models.OutgoingRecordSkriningTB {
+	records := []models.OutgoingRecordSkriningTB{}
+	if outbox.Records != nil {
+		if err := json.Unmarshal([]byte(*outbox.Records), &records); err != nil {
+			slog.Warn("Records outbox tidak valid", "id", outbox.ID, "error", err)
+		}
+	}
+	return records
+}
+
+// recordPublishResult mencatat hasil publish ke outbox dan log outgoing, mengembalikan true jika berhasil
+func (t *CkgTransmitter) recordPublishResult(outbox models.OutboxMessage, msg *broker.Message, msgID string, err error) bool {
+	now := time.Now().Format(time.RFC3339)
+	attempt := outbox.Attempts + 1
+	outgoing := models.OutgoingMessageSkriningTB{
+		ID:          msgID,
+		OutboxID:    outbox.ID,
+		PayloadHash: models.PayloadHash([]byte(outbox.Data)),
+		OrderingKey: msg.OrderingKey,
+		Status:      models.OutgoingStatusPublished,
+		Attempt:     attempt,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err != nil {
+		slog.Warn("Gagal mengirim message outbox", "id", outbox.ID, "attempt", attempt, "error", err)
+		if errMark := t.OutboxRepo.MarkOutboxFailed(outbox.ID, err.Error(), now); errMark != nil {
+			slog.Error("Gagal menandai outbox gagal", "id", outbox.ID, "error", errMark)
+		}
+
+		errMessage := err.Error()
+		outgoing.ID = fmt.Sprintf("%s/%d", outbox.ID, attempt)
+		outgoing.Status = models.OutgoingStatusFailed
+		outgoing.Error = &errMessage
+		if errSave := t.PubSubRepo.SaveOutgoing(outgoing, nil); errSave != nil {
+			slog.Error("Gagal menyimpan log outgoing", "id", outgoing.ID, "error", errSave)
+		}
+
+		// Relay tidak mencoba lagi, data ini tidak lagi dihitung sebagai data terakhir pasien dan
+		// ordering key dilanjutkan agar message berikutnya untuk pasien ini tetap terkirim
+		if attempt >= t.Configurations.Producer.Outbox.MaxAttempts {
+			t.releaseLatest(outbox)
+			if msg.OrderingKey != "" {
+				t.Broker.ResumePublish(t.outboxTopic(outbox), msg.OrderingKey)
+			}
+		}
+		return false
+	}
+
+	// Message sudah terkirim, kegagalan pencatatan di bawah tidak mengulang publish
+	if err := t.OutboxRepo.MarkOutboxPublished(outbox.ID, msgID, now); err != nil {
+		slog.Error("Gagal menandai outbox terkirim", "id", outbox.ID, "message_id", msgID, "error", err)
+	}
+
+	records := outboxRecords(outbox)
+	for i := range records {
+		records[i].Attempt = attempt
+		records[i].PublishedAt = now
+	}
+
+	outgoing.RecordCount = len(records)
+	if err := t.PubSubRepo.SaveOutgoing(outgoing, records); err != nil {
+		slog.Error("Gagal menyimpan log outgoing", "id", msgID, "error", err)
+	}
+	t.markSent(records)
+
+	return true
+}
@@ -0,0 +1,163 @@
+package ckg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"pubsub-ckg-tb/internal/db/sql"
+	"pubsub-ckg-tb/internal/db/utils"
+	"pubsub-ckg-tb/internal/models"
+)
+
+// pollCursor adalah high-water mark polling yang disimpan sebagai posisi checkpoint
+type pollCursor struct {
+	Timestamp string `json:"timestamp"`
+	Key       string `json:"key"`
+}
+
+// watchPolling memantau tabel skrining MySQL/PostgreSQL dengan polling berkala.
+// Baris diambil berurutan berdasarkan kolom timestamp lalu primary key, posisi terakhir
+// disimpan ke checkpoint agar polling berlanjut setelah restart.
+func (t *CkgTransmitter) watchPolling(ctx context.Context) {
+	sqlDB, ok := t.Database.(*sql.SQLConnection)
+	if !ok {
+		slog.Error("Koneksi database bukan SQL, polling tidak bisa dijalankan")
+		return
+	}
+
+	cfg := t.Configurations.Producer.Watch
+	checkpointID := "poll:" + t.Configurations.CKG.TableSkrining
+
+	slog.Info("Memulai polling perubahan pada tabel",
+		"table", t.Configurations.CKG.TableSkrining,
+		"interval", cfg.PollInterval,
+		"timestamp_column", cfg.TimestampColumn,
+		"key_column", cfg.KeyColumn)
+
+	// Perubahan yang terdeteksi masuk ke outbox, relay yang mengirimkan ke broker
+	go t.RunOutboxRelay(ctx)
+
+	for ctx.Err() == nil {
+		count, err := t.pollChanges(ctx, sqlDB, checkpointID)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Gagal polling perubahan data", "error", err)
+		}
+
+		// Batch penuh berarti masih ada baris berikutnya, langsung lanjutkan
+		if err != nil || count < cfg.PollBatchSize {
+			sleepContext(ctx, cfg.PollInterval)
+		}
+	}
+
+	slog.Info("Context cancelled, stopping polling...")
+}
+
+// pollChanges memproses satu batch baris setelah cursor terakhir dan mengembalikan jumlah baris yang dibaca
+func (t *CkgTransmitter) pollChanges(ctx context.Context, sqlDB *sql.SQLConnection, checkpointID string) (int, error) {
+	cfg := t.Configurations.Producer.Watch
+
+	cursor, err := t.loadPollCursor(checkpointID)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := sqlDB.Poll(ctx, t.Configurations.CKG.TableSkrining, cfg.TimestampColumn, cfg.KeyColumn,
+		cursorValue(cursor.Timestamp), cursorValue(cursor.Key), int64(cfg.PollBatchSize))
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for _, row := range rows {
+		if err := t.processRowChange("poll", row); err != nil {
+			if utils.IsTransientError(err) {
+				// Berhenti di baris ini, polling berikutnya mengulang dari cursor terakhir
+				break
+			}
+			slog.Error("Gagal memproses perubahan", "key", row[cfg.KeyColumn], "error", err)
+		}
+
+		cursor.Timestamp = formatCursorValue(row[cfg.TimestampColumn])
+		cursor.Key = formatCursorValue(row[cfg.KeyColumn])
+		processed++
+	}
+
+	if processed > 0 {
+		if err := t.savePollCursor(checkpointID, cursor); err != nil {
+			return processed, err
+		}
+		slog.Debug("Polling selesai", "rows", processed, "timestamp", cursor.Timestamp, "key", cursor.Key)
+	}
+
+	if processed < len(rows) {
+		return processed, fmt.Errorf("polling berhenti di baris %d dari %d karena error transient", processed+1, len(rows))
+	}
+
+	return len(rows), nil
+}
+
+// loadPollCursor membaca cursor dari checkpoint. Tanpa checkpoint, polling dimulai dari
+// waktu outgoing terakhir atau 48 jam yang lalu seperti Produce.
+func (t *CkgTransmitter) loadPollCursor(checkpointID string) (pollCursor, error) {
+	cursor := pollCursor{}
+
+	checkpoint, err := t.CheckpointRepo.GetCheckpoint(checkpointID)
+	if err != nil {
+		return cursor, err
+	}
+
+	if checkpoint != nil && checkpoint.Position != "" {
+		if err := json.Unmarshal([]byte(checkpoint.Position), &cursor); err != nil {
+			return cursor, fmt.Errorf("cursor polling tidak valid: %w", err)
+		}
+		return cursor, nil
+	}
+
+	cursor.Timestamp, _ = t.PubSubRepo.GetLastOutgoingTimestamp()
+	if cursor.Timestamp == "" {
+		cursor.Timestamp = time.Now().Add(-48 * time.Hour).Format(time.RFC3339)
+	}
+
+	return cursor, nil
+}
+
+func (t *CkgTransmitter) savePollCursor(checkpointID string, cursor pollCursor) error {
+	position, err := json.Marshal(cursor)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	return t.CheckpointRepo.SaveCheckpoint(models.Checkpoint{
+		ID:           checkpointID,
+		Position:     string(position),
+		CheckpointAt: now,
+		UpdatedAt:    now,
+	})
+}
+
+// formatCursorValue menyimpan nilai kolom sebagai string, waktu disimpan dalam RFC3339Nano
+func formatCursorValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// cursorValue mengubah nilai cursor menjadi argumen query, string waktu RFC3339 dikirim sebagai time.Time
+func cursorValue(value string) any {
+	if value == "" {
+		return nil
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return ts
+	}
+	return value
+}
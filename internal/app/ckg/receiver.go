@@ -6,34 +6,74 @@ import (
 	"log/slog"
 	"pubsub-ckg-tb/internal/config"
 	"pubsub-ckg-tb/internal/db/connection"
+	"pubsub-ckg-tb/internal/db/utils"
 	"pubsub-ckg-tb/internal/models"
+	"pubsub-ckg-tb/internal/pubsub/broker"
 	"pubsub-ckg-tb/internal/repository"
 	"slices"
-
-	"cloud.google.com/go/pubsub/v2"
+	"time"
 )
 
 type CkgReceiver struct {
 	Configurations *config.Configurations
 	Database       connection.DatabaseConnection
+	Broker         broker.Broker
 	PubSubRepo     repository.PubSub
 	CkgRepo        repository.CKGTB
+
+	// DryRun menjalankan proses tanpa menulis status pasien maupun log incoming
+	DryRun bool
+
+	// dryRunOutput menerima keputusan UpdateTbPatientStatus setiap message pada mode dry-run
+	dryRunOutput *DryRunOutput
+	// dryRunHold menahan message consumer dry-run agar tidak dikirim ulang selama dry-run berjalan
+	dryRunHold *dryRunHold
 }
 
-func NewCkgReceiver(ctx context.Context, config *config.Configurations, db connection.DatabaseConnection) *CkgReceiver {
+func NewCkgReceiver(ctx context.Context, config *config.Configurations, db connection.DatabaseConnection, broker broker.Broker) *CkgReceiver {
 	pubsubRepo := repository.NewPubSubRepository(ctx, config, db)
 	ckgRepo := repository.NewCKGTBRepository(ctx, config, db)
 
 	return &CkgReceiver{
 		Configurations: config,
 		Database:       db,
+		Broker:         broker,
 		PubSubRepo:     pubsubRepo,
 		CkgRepo:        ckgRepo,
 	}
 }
 
-func (r *CkgReceiver) Prepare(ctx context.Context, messages []*pubsub.Message) map[string][]any {
+// SetDryRun mengaktifkan mode dry-run pada receiver dan repository status pasien
+func (r *CkgReceiver) SetDryRun(dryRun bool) {
+	r.DryRun = dryRun
+	r.CkgRepo.SetDryRun(dryRun)
+}
+
+// SetDryRunOutput mengaktifkan mode dry-run dan menulis keputusan UpdateTbPatientStatus setiap
+// message ke output sebagai JSON lines. Consumer berhenti setelah limit message (0 = tanpa batas)
+// atau setelah tidak ada message baru selama idle.
+func (r *CkgReceiver) SetDryRunOutput(output *DryRunOutput, limit int, idle time.Duration) {
+	r.SetDryRun(output != nil)
+	r.dryRunOutput = output
+	r.dryRunHold = nil
+	if output != nil {
+		r.dryRunHold = newDryRunHold(limit, idle)
+	}
+}
+
+// Done ditutup saat consumer dry-run selesai, receiver di luar dry-run tidak pernah selesai
+func (r *CkgReceiver) Done() <-chan struct{} {
+	if r.dryRunHold == nil {
+		return nil
+	}
+	return r.dryRunHold.Done()
+}
+
+// Prepare memfilter message yang valid untuk diproses. Message yang sudah diselesaikan
+// di tahap ini (misalnya gagal parsing lalu dikarantina) dikembalikan pada settled.
+func (r *CkgReceiver) Prepare(ctx context.Context, messages []*broker.Message) (map[string][]any, map[string]bool) {
 	validMessages := make(map[string][]any)
+	settled := make(map[string]bool)
 
 	// Extract message IDs
 	messageIDs := make([]string, 0, len(messages))
@@ -47,24 +87,38 @@ func (r *CkgReceiver) Prepare(ctx context.Context, messages []*pubsub.Message) m
 		slog.Debug("Gagal mengambil daftar message ID existing", "error", err)
 		existingIDs = []string{}
 	}
+	processedIDs, err := r.PubSubRepo.GetProcessedIncomingIDs(messageIDs)
+	if err != nil {
+		slog.Debug("Gagal mengambil daftar message ID yang sudah diproses", "error", err)
+		processedIDs = []string{}
+	}
 
-	// Process semua message satu-satu
+	// Process semua message satu-satu.
+	// Ack/nack dilakukan oleh consumer berdasarkan hasil Consume.
 	for _, msg := range messages {
-		// Acknowledge terlebih dahulu
-		msg.Ack()
-
-		// Skip jika message ID sudah diproses sebelumnya
-		if slices.Contains(existingIDs, msg.ID) {
+		// Skip jika message ID sudah berhasil diproses sebelumnya
+		if slices.Contains(processedIDs, msg.ID) {
 			slog.Debug("Skip message", "id", msg.ID)
 			continue
 		}
 
-		// Parse message data
-		dataStr := string(msg.Data)
+		// Parse message data, payload dikompresi sesuai attribute content-encoding
+		data, err := broker.Decompress(msg.Attributes[broker.ContentEncodingAttribute], msg.Data)
+		dataStr := string(data)
 		pubsubObjectWrapper := models.NewPubSubConsumerWrapper[*models.StatusPasien]()
-		err := pubsubObjectWrapper.FromJSON(dataStr)
+		if err == nil {
+			err = pubsubObjectWrapper.FromJSON(dataStr)
+		}
 		if err != nil {
 			slog.Debug("Gagal parsing", "id", msg.ID, "error", err)
+			if r.DryRun {
+				r.reportDryRun(msg.ID, nil, err)
+				continue
+			}
+			if errDL := r.DeadLetter(ctx, msg, QuarantineReasonParse, err, 1); errDL != nil {
+				slog.Error("Gagal memindahkan message ke dead-letter", "id", msg.ID, "error", errDL)
+				settled[msg.ID] = false
+			}
 			continue
 		}
 
@@ -74,56 +128,208 @@ func (r *CkgReceiver) Prepare(ctx context.Context, messages []*pubsub.Message) m
 			continue
 		}
 
-		// Simpan incomming message agar tidak diproses berulang kali
+		// Simpan incomming message agar tidak diproses berulang kali.
+		// Message yang dikirim ulang oleh broker sudah tersimpan sebelumnya.
 		incoming := models.IncomingMessageStatusTB{
 			ID:          msg.ID,
 			Data:        &dataStr,
-			ReceivedAt:  msg.PublishTime.String(),
+			State:       models.IncomingStateReceived,
+			ReceivedAt:  msg.PublishTime.Format(time.RFC3339),
 			ProcessedAt: nil,
 		}
-		if err := r.PubSubRepo.SaveNewIncoming(incoming); err != nil {
-			slog.Info("Gagal menyimpan incoming message", "id", msg.ID, "error", err)
+		if !r.DryRun && !slices.Contains(existingIDs, msg.ID) {
+			if err := r.PubSubRepo.SaveNewIncoming(incoming); err != nil {
+				slog.Info("Gagal menyimpan incoming message", "id", msg.ID, "error", err)
+			}
 		}
 
 		// register ke validMessages
 		validMessages[msg.ID] = []any{incoming, msg, pubsubObjectWrapper.Data}
 	}
 
-	return validMessages
+	return validMessages, settled
 }
 
-func (r *CkgReceiver) Consume(ctx context.Context, messages []*pubsub.Message) (map[string]bool, error) {
-	results := make(map[string]bool)
-
+func (r *CkgReceiver) Consume(ctx context.Context, messages []*broker.Message) (map[string]bool, error) {
 	// Filter message hanya yang belum diproses saja
-	validMessages := r.Prepare(ctx, messages)
+	validMessages, results := r.Prepare(ctx, messages)
 
 	// Process each valid message
 	for msgID, data := range validMessages {
 		// incoming := data[0].(*models.IncomingMessageStatusTB)
-		msg := data[1].(*pubsub.Message)
-		statusPasien := data[2].([]models.StatusPasien)
+		msg := data[1].(*broker.Message)
+		statusPasien := make([]models.StatusPasien, 0)
+		for _, item := range data[2].([]*models.StatusPasien) {
+			statusPasien = append(statusPasien, *item)
+		}
 
-		// Process the message
-		err := r.Process(ctx, statusPasien, msg)
-		if err != nil {
-			slog.Info("Saat memproses message", "id", msgID, "error", err)
+		// Process the message, error transient di-retry dengan exponential backoff
+		statusResults, attempt, err := r.ProcessWithRetry(ctx, statusPasien, msg)
+
+		// Dry-run hanya melaporkan hasil percobaan terakhir, message diselesaikan di bawah
+		if r.DryRun {
+			r.reportDryRun(msgID, statusResults, err)
+			continue
+		}
+
+		if err == nil {
+			r.Reply(ctx, msg, statusResults, nil)
+			results[msgID] = true
+			continue
+		}
+
+		reason := QuarantineReasonPermanent
+		if utils.IsTransientError(err) {
+			// Kembalikan ke broker agar dikirim ulang selama batas pengiriman belum tercapai
+			if ctx.Err() != nil || !r.deliveryExhausted(msg) {
+				slog.Info("Saat memproses message", "id", msgID, "attempt", attempt, "error", err)
+				results[msgID] = false
+				continue
+			}
+			reason = QuarantineReasonRetryExhausted
+		} else {
+			// Error database permanen (misalnya pelanggaran constraint) tidak akan berhasil walaupun dikirim ulang
+			slog.Warn("Message gagal diproses secara permanen", "id", msgID, "attempt", attempt, "error", err)
+		}
+
+		if errDL := r.DeadLetter(ctx, msg, reason, err, attempt); errDL != nil {
+			slog.Error("Gagal memindahkan message ke dead-letter", "id", msgID, "error", errDL)
 			results[msgID] = false
 			continue
 		}
 
-		results[msgID] = true
+		// Tanpa dead-letter policy, message yang gagal karena error transient tetap dikirim ulang broker
+		results[msgID] = reason != QuarantineReasonRetryExhausted || r.Configurations.Consumer.DeadLetterPolicy.Enabled
+		if results[msgID] {
+			r.Reply(ctx, msg, statusResults, err)
+		}
+	}
+
+	// Dry-run tidak meng-ack message agar tetap tersedia untuk consumer sebenarnya. Message ditahan
+	// sampai dry-run selesai karena nack langsung membuat broker mengirim ulang message yang sama terus-menerus.
+	if r.DryRun {
+		if r.dryRunHold == nil {
+			for _, msg := range messages {
+				results[msg.ID] = false
+			}
+			return results, nil
+		}
+		r.dryRunHold.Hold(messages)
+		return nil, broker.ErrUnsettled
 	}
 
 	return results, nil
 }
 
-func (r *CkgReceiver) Process(ctx context.Context, statusPasien []models.StatusPasien, msg *pubsub.Message) error {
+// ProcessWithRetry menjalankan Process dengan retry sesuai ConsumerConfig.RetryCount/RetryDelay dan
+// mengembalikan hasil percobaan terakhir, seluruh percobaan dibatasi oleh AcknowledgeTimeout
+func (r *CkgReceiver) ProcessWithRetry(ctx context.Context, statusPasien []models.StatusPasien, msg *broker.Message) ([]models.StatusPasienResult, int, error) {
+	cfg := r.Configurations.Consumer
+
+	if cfg.AcknowledgeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.AcknowledgeTimeout)
+		defer cancel()
+	}
+
+	var results []models.StatusPasienResult
+	attempt, err := withRetry(ctx, cfg.RetryCount, cfg.RetryDelay, msg.ID, func(ctx context.Context) error {
+		var err error
+		results, err = r.Process(ctx, statusPasien, msg)
+		return err
+	})
+	return results, attempt, err
+}
+
+func (r *CkgReceiver) Process(ctx context.Context, statusPasien []models.StatusPasien, msg *broker.Message) ([]models.StatusPasienResult, error) {
 	slog.Debug(fmt.Sprintf("Received valid CKG SkriningCKG object [%s].\n Data: %s\n Attributes: %v", msg.ID, string(msg.Data), msg.Attributes))
 
+	// Dry-run tidak mengubah log incoming
+	attempt := 0
+	if !r.DryRun {
+		var errStart error
+		attempt, errStart = r.PubSubRepo.StartIncomingAttempt(msg.ID)
+		if errStart != nil {
+			slog.Info("Gagal menandai incoming message sedang diproses", "id", msg.ID, "error", errStart)
+		}
+	}
+
 	// Save to database
-	_, err := r.CkgRepo.UpdateTbPatientStatus(statusPasien)
-	r.PubSubRepo.UpdateIncoming(msg.ID, nil)
+	results, err := r.CkgRepo.UpdateTbPatientStatus(msg.ID, statusPasien)
+	if utils.IsTransientError(err) {
+		// processed_at tetap kosong agar message diproses ulang saat dikirim ulang broker
+		if !r.DryRun {
+			r.finishIncoming(msg.ID, models.IncomingStateFailed, nil, attempt, results, err)
+		}
+		return results, err
+	}
+
+	// Dry-run tidak menandai message sebagai sudah diproses
+	if r.DryRun {
+		return results, err
+	}
 
-	return err
+	// Tandai sudah diproses agar redelivery berikutnya diabaikan,
+	// item yang gagal validasi dan error permanen tetap dianggap selesai diproses
+	processedAt := time.Now().Format(time.RFC3339)
+	r.finishIncoming(msg.ID, incomingState(results, err), &processedAt, attempt, results, err)
+
+	return results, err
+}
+
+// finishIncoming mencatat state akhir percobaan beserta hasil per item ke log incoming
+func (r *CkgReceiver) finishIncoming(messageID string, state string, processedAt *string, attempt int, results []models.StatusPasienResult, cause error) {
+	var lastError *string
+	if cause != nil {
+		message := cause.Error()
+		lastError = &message
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	items := make([]models.IncomingItemStatusTB, 0, len(results))
+	for i, result := range results {
+		items = append(items, models.NewIncomingItemStatusTB(messageID, i, result, attempt, now))
+	}
+
+	if errUpdate := r.PubSubRepo.FinishIncoming(messageID, state, processedAt, lastError, items); errUpdate != nil {
+		slog.Info("Gagal memperbarui incoming message", "id", messageID, "state", state, "error", errUpdate)
+	}
+}
+
+// incomingState menentukan state message dari hasil UpdateTbPatientStatus
+func incomingState(results []models.StatusPasienResult, err error) string {
+	if err != nil {
+		return models.IncomingStateFailed
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.IsError {
+			failed++
+		}
+	}
+
+	switch {
+	case failed == 0:
+		return models.IncomingStateSucceeded
+	case failed < len(results):
+		return models.IncomingStatePartiallyFailed
+	default:
+		return models.IncomingStateFailed
+	}
+}
+
+// reportDryRun menulis keputusan untuk satu message ke output dry-run
+func (r *CkgReceiver) reportDryRun(id string, results []models.StatusPasienResult, err error) {
+	if r.dryRunOutput == nil {
+		return
+	}
+
+	decision := dryRunDecision{ID: id, Results: results}
+	if err != nil {
+		decision.Error = err.Error()
+	}
+	if errWrite := r.dryRunOutput.Write(decision); errWrite != nil {
+		slog.Error("Gagal menulis output dry-run", "id", id, "error", errWrite)
+	}
 }
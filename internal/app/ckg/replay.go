@@ -0,0 +1,243 @@
+package ckg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"pubsub-ckg-tb/internal/models"
+	"pubsub-ckg-tb/internal/pubsub/broker"
+	"pubsub-ckg-tb/internal/repository"
+	"time"
+)
+
+// replayPageSize adalah jumlah baris log incoming yang dibaca per halaman saat memfilter payload
+const replayPageSize = 200
+
+// ReplayFilter memilih message dari log incoming. NIK dan TerdugaID dicocokkan
+// terhadap isi payload sehingga dievaluasi setelah data dibaca dari database.
+type ReplayFilter struct {
+	repository.IncomingFilter
+	NIK       string
+	TerdugaID string
+}
+
+// QuarantineReplayFilter memilih message dari tabel karantina. NIK dan TerdugaID dicocokkan
+// terhadap isi payload seperti pada ReplayFilter.
+type QuarantineReplayFilter struct {
+	repository.QuarantineFilter
+	NIK       string
+	TerdugaID string
+}
+
+// ReplayEntry adalah satu message dari log incoming beserta payload yang sudah diparsing.
+// Quarantine terisi jika message dibaca dari tabel karantina.
+type ReplayEntry struct {
+	Incoming     models.IncomingMessageStatusTB
+	Quarantine   *models.QuarantineMessage
+	StatusPasien []models.StatusPasien
+	ParseError   error
+}
+
+// ReplayResult adalah hasil menjalankan ulang satu message
+type ReplayResult struct {
+	ID      string                      `json:"id"`
+	DryRun  bool                        `json:"dry_run"`
+	Results []models.StatusPasienResult `json:"results,omitempty"`
+	Error   string                      `json:"error,omitempty"`
+}
+
+// FindReplayEntries mengambil message dari log incoming sesuai filter, maksimal limit entry (0 = semua)
+func (r *CkgReceiver) FindReplayEntries(filter ReplayFilter, limit int) ([]ReplayEntry, error) {
+	entries := []ReplayEntry{}
+
+	for skip := int64(0); ; skip += replayPageSize {
+		page, err := r.PubSubRepo.FindIncoming(filter.IncomingFilter, replayPageSize, skip)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, incoming := range page {
+			entry := newReplayEntry(incoming)
+			if !filter.matches(entry) {
+				continue
+			}
+
+			entries = append(entries, entry)
+			if limit > 0 && len(entries) >= limit {
+				return entries, nil
+			}
+		}
+
+		if len(page) < replayPageSize {
+			return entries, nil
+		}
+	}
+}
+
+// FindQuarantineEntries mengambil message dari tabel karantina sesuai filter, maksimal limit entry (0 = semua).
+// Message yang gagal diparsing dikarantina sebelum masuk log incoming sehingga hanya ada di tabel ini.
+func (r *CkgReceiver) FindQuarantineEntries(filter QuarantineReplayFilter, limit int) ([]ReplayEntry, error) {
+	entries := []ReplayEntry{}
+	match := ReplayFilter{NIK: filter.NIK, TerdugaID: filter.TerdugaID}
+
+	for skip := int64(0); ; skip += replayPageSize {
+		page, err := r.PubSubRepo.GetQuarantine(filter.QuarantineFilter, replayPageSize, skip)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, quarantine := range page {
+			entry := newQuarantineEntry(quarantine)
+			if !match.matches(entry) {
+				continue
+			}
+
+			entries = append(entries, entry)
+			if limit > 0 && len(entries) >= limit {
+				return entries, nil
+			}
+		}
+
+		if len(page) < replayPageSize {
+			return entries, nil
+		}
+	}
+}
+
+// Replay menjalankan ulang payload dari log incoming melalui Process.
+// Message dari karantina yang belum ada di log incoming disimpan terlebih dahulu agar hasilnya tercatat.
+// Pada mode dry-run tidak ada status pasien maupun log incoming yang ditulis.
+func (r *CkgReceiver) Replay(ctx context.Context, entry ReplayEntry) ReplayResult {
+	result := ReplayResult{
+		ID:     entry.Incoming.ID,
+		DryRun: r.DryRun,
+	}
+
+	if entry.ParseError != nil {
+		result.Error = entry.ParseError.Error()
+		return result
+	}
+
+	msg := &broker.Message{
+		ID: entry.Incoming.ID,
+	}
+	if entry.Incoming.Data != nil {
+		msg.Data = []byte(*entry.Incoming.Data)
+	}
+	if receivedAt, err := time.Parse(time.RFC3339, entry.Incoming.ReceivedAt); err == nil {
+		msg.PublishTime = receivedAt
+	}
+
+	if entry.Quarantine != nil && !r.DryRun {
+		if err := r.saveQuarantinedIncoming(entry.Incoming); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+
+	results, err := r.Process(ctx, entry.StatusPasien, msg)
+	result.Results = results
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// saveQuarantinedIncoming menyimpan message dari karantina ke log incoming jika belum ada
+func (r *CkgReceiver) saveQuarantinedIncoming(incoming models.IncomingMessageStatusTB) error {
+	existingIDs, err := r.PubSubRepo.GetIncomingIDs([]string{incoming.ID})
+	if err != nil {
+		return fmt.Errorf("gagal memeriksa log incoming: %v", err)
+	}
+	if len(existingIDs) > 0 {
+		return nil
+	}
+
+	if err := r.PubSubRepo.SaveNewIncoming(incoming); err != nil {
+		return fmt.Errorf("gagal menyimpan incoming message: %v", err)
+	}
+	slog.Info("Message dari karantina disimpan ke log incoming", "id", incoming.ID)
+	return nil
+}
+
+func newReplayEntry(incoming models.IncomingMessageStatusTB) ReplayEntry {
+	entry := ReplayEntry{
+		Incoming: incoming,
+	}
+	entry.parse()
+	return entry
+}
+
+// newQuarantineEntry membuat entry dari tabel karantina. Data karantina disimpan apa adanya dari broker,
+// sehingga didekompresi sesuai attribute content-encoding sebelum diparsing.
+func newQuarantineEntry(quarantine models.QuarantineMessage) ReplayEntry {
+	entry := ReplayEntry{
+		Incoming: models.IncomingMessageStatusTB{
+			ID:         quarantine.ID,
+			State:      models.IncomingStateReceived,
+			ReceivedAt: quarantine.QuarantinedAt,
+		},
+		Quarantine: &quarantine,
+	}
+
+	if quarantine.Data == nil {
+		entry.ParseError = fmt.Errorf("payload kosong")
+		return entry
+	}
+
+	attributes := map[string]string{}
+	if quarantine.Attributes != nil {
+		_ = json.Unmarshal([]byte(*quarantine.Attributes), &attributes)
+	}
+	data, err := broker.Decompress(attributes[broker.ContentEncodingAttribute], []byte(*quarantine.Data))
+	if err != nil {
+		entry.ParseError = err
+		return entry
+	}
+
+	dataStr := string(data)
+	entry.Incoming.Data = &dataStr
+	entry.parse()
+	return entry
+}
+
+// parse mengisi StatusPasien dari payload incoming, atau ParseError jika payload tidak valid
+func (e *ReplayEntry) parse() {
+	if e.Incoming.Data == nil {
+		e.ParseError = fmt.Errorf("payload kosong")
+		return
+	}
+
+	wrapper := models.NewPubSubConsumerWrapper[*models.StatusPasien]()
+	if err := wrapper.FromJSON(*e.Incoming.Data); err != nil {
+		e.ParseError = err
+		return
+	}
+
+	for _, item := range wrapper.Data {
+		if item != nil {
+			e.StatusPasien = append(e.StatusPasien, *item)
+		}
+	}
+}
+
+// matches memeriksa apakah salah satu status pasien pada entry cocok dengan filter NIK/TerdugaID
+func (f ReplayFilter) matches(entry ReplayEntry) bool {
+	if f.NIK == "" && f.TerdugaID == "" {
+		return true
+	}
+
+	for _, item := range entry.StatusPasien {
+		if f.NIK != "" && (item.PasienNIK == nil || *item.PasienNIK != f.NIK) {
+			continue
+		}
+		if f.TerdugaID != "" && (item.TerdugaID == nil || *item.TerdugaID != f.TerdugaID) {
+			continue
+		}
+		return true
+	}
+
+	return false
+}
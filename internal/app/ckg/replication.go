@@ -0,0 +1,134 @@
+package ckg
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"pubsub-ckg-tb/internal/db/sql"
+	"pubsub-ckg-tb/internal/db/utils"
+	"pubsub-ckg-tb/internal/models"
+)
+
+// watchLogical memantau tabel skrining PostgreSQL melalui logical replication slot (pgoutput).
+// LSN terakhir yang selesai diproses disimpan ke checkpoint, lalu slot di-advance ke posisi tersebut
+// agar WAL lama bisa dibuang server.
+func (t *CkgTransmitter) watchLogical(ctx context.Context) {
+	sqlDB, ok := t.Database.(*sql.SQLConnection)
+	if !ok {
+		slog.Error("Koneksi database bukan SQL, logical replication tidak bisa dijalankan")
+		return
+	}
+
+	cfg := t.Configurations.Producer.Watch
+	table := t.Configurations.CKG.TableSkrining
+	checkpointID := "logical:" + table
+
+	replicated, err := sqlDB.EnsureReplicationSlot(ctx, cfg.Slot, cfg.Publication, table)
+	if err != nil {
+		slog.Error("Gagal menyiapkan replication slot", "slot", cfg.Slot, "publication", cfg.Publication, "error", err)
+		return
+	}
+	if !replicated.FullIdentity() {
+		// Tanpa REPLICA IDENTITY FULL data lama pada delete hanya berisi kolom primary key,
+		// pasien_id tidak diketahui sehingga retraksi tidak bisa dikirim
+		slog.Warn("Tabel skrining tidak memakai REPLICA IDENTITY FULL, retraksi untuk data yang dihapus tidak dikirim",
+			"table", replicated.Schema+"."+replicated.Name,
+			"replica_identity", replicated.ReplicaIdentity)
+	}
+
+	slog.Info("Memulai logical replication pada tabel",
+		"table", table,
+		"slot", cfg.Slot,
+		"publication", cfg.Publication,
+		"interval", cfg.PollInterval)
+
+	// Perubahan yang terdeteksi masuk ke outbox, relay yang mengirimkan ke broker
+	go t.RunOutboxRelay(ctx)
+
+	for ctx.Err() == nil {
+		count, err := t.consumeReplication(ctx, sqlDB, replicated, checkpointID)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Gagal membaca logical replication", "error", err)
+		}
+
+		if err != nil || count == 0 {
+			sleepContext(ctx, cfg.PollInterval)
+		}
+	}
+
+	slog.Info("Context cancelled, stopping logical replication...")
+}
+
+// consumeReplication memproses satu batch perubahan dari slot dan mengembalikan jumlah perubahan yang dibaca
+func (t *CkgTransmitter) consumeReplication(ctx context.Context, sqlDB *sql.SQLConnection, table sql.ReplicationTable, checkpointID string) (int, error) {
+	cfg := t.Configurations.Producer.Watch
+
+	checkpoint, err := t.CheckpointRepo.GetCheckpoint(checkpointID)
+	if err != nil {
+		return 0, err
+	}
+
+	var checkpointLSN uint64
+	if checkpoint != nil && checkpoint.Position != "" {
+		checkpointLSN, err = sql.ParseLSN(checkpoint.Position)
+		if err != nil {
+			return 0, fmt.Errorf("checkpoint LSN tidak valid: %w", err)
+		}
+	}
+
+	events, lastLSN, err := sqlDB.PeekChanges(ctx, cfg.Slot, cfg.Publication, cfg.PollBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	if lastLSN == "" {
+		return 0, nil
+	}
+
+	for _, event := range events {
+		// Publication bisa berisi tabel lain, termasuk tabel dengan nama sama di schema lain
+		if !table.Matches(event) {
+			continue
+		}
+
+		// Perubahan sampai LSN checkpoint sudah diproses, slot belum sempat di-advance
+		lsn, err := sql.ParseLSN(event.LSN)
+		if err != nil {
+			return 0, err
+		}
+		if lsn <= checkpointLSN {
+			continue
+		}
+
+		// Data lama pada delete hanya berisi kolom replica identity, pasien_id perlu REPLICA IDENTITY FULL
+		if event.Operation == "delete" && event.Data["pasien_id"] == nil {
+			slog.Warn("Delete tanpa pasien_id, retraksi tidak dikirim", "lsn", event.LSN, "data", event.Data)
+		}
+		if err := t.processRowChange(event.Operation, event.Data); err != nil {
+			if utils.IsTransientError(err) {
+				// Slot tidak di-advance, batch berikutnya membaca ulang dari posisi yang sama
+				return 0, fmt.Errorf("logical replication berhenti di LSN %s: %w", event.LSN, err)
+			}
+			slog.Error("Gagal memproses perubahan", "lsn", event.LSN, "error", err)
+		}
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	err = t.CheckpointRepo.SaveCheckpoint(models.Checkpoint{
+		ID:           checkpointID,
+		Position:     lastLSN,
+		CheckpointAt: now,
+		UpdatedAt:    now,
+	})
+	if err != nil {
+		return len(events), err
+	}
+
+	if err := sqlDB.AdvanceReplicationSlot(ctx, cfg.Slot, lastLSN); err != nil {
+		return len(events), err
+	}
+
+	slog.Debug("Logical replication selesai", "changes", len(events), "lsn", lastLSN)
+	return len(events), nil
+}
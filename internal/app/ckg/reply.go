@@ -0,0 +1,63 @@
+package ckg
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"pubsub-ckg-tb/internal/models"
+	"pubsub-ckg-tb/internal/pubsub/broker"
+)
+
+// Reply mengirim message respon ke reply topic berisi hasil UpdateTbPatientStatus per item dari msg,
+// sehingga SITB mengetahui status mana yang ditolak beserta alasannya. Respon dikorelasikan dengan
+// message asal melalui field message_id pada payload dan attribute original_message_id.
+// Kegagalan publish hanya dicatat di log karena message asal sudah selesai diproses.
+func (r *CkgReceiver) Reply(ctx context.Context, msg *broker.Message, results []models.StatusPasienResult, cause error) {
+	if !r.Configurations.Consumer.Reply.Enabled || r.DryRun {
+		return
+	}
+
+	items := make([]*models.StatusPasienResult, 0, len(results))
+	for i := range results {
+		items = append(items, &results[i])
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	var errMessage *string
+	if cause != nil {
+		message := cause.Error()
+		errMessage = &message
+	}
+
+	pubsubObjectWrapper := models.NewPubSubResponseWrapper(items)
+	pubsubObjectWrapper.Fields = map[string]any{
+		"message_id":   msg.ID,
+		"processed_at": now,
+		"error":        errMessage,
+	}
+	jsonStr, err := pubsubObjectWrapper.ToJSON()
+	if err != nil {
+		slog.Error("Gagal menyusun message respon", "id", msg.ID, "error", err)
+		return
+	}
+
+	topic := r.Configurations.ReplyTopic()
+	replyID, err := r.Broker.Publish(ctx, topic, &broker.Message{
+		Data: []byte(jsonStr),
+		Attributes: map[string]string{
+			"original_message_id": msg.ID,
+			"environment":         r.Configurations.App.Environment,
+			"timestamp":           now,
+		},
+		OrderingKey: msg.OrderingKey,
+	})
+	if err != nil {
+		slog.Error("Gagal mengirim message respon", "id", msg.ID, "topic", topic, "error", err)
+		// Respon tidak dikirim ulang, ordering key dilanjutkan agar respon berikutnya tetap terkirim
+		r.Broker.ResumePublish(topic, msg.OrderingKey)
+		return
+	}
+
+	slog.Debug("Message respon terkirim", "id", msg.ID, "reply_id", replyID, "topic", topic, "items", len(items))
+}
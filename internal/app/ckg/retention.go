@@ -0,0 +1,278 @@
+package ckg
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"pubsub-ckg-tb/internal/config"
+	"pubsub-ckg-tb/internal/db/connection"
+	"pubsub-ckg-tb/internal/db/dbtypes"
+	"pubsub-ckg-tb/internal/repository"
+	"time"
+)
+
+// retentionTable adalah tabel log yang dihapus setelah masa retensi. Baris pada ItemTable
+// (dikaitkan melalui kolom message_id) ikut dihapus bersama baris induknya, ItemTable kosong
+// berarti tabel tanpa item.
+type retentionTable struct {
+	Table      string
+	TimeColumn string
+	ItemTable  string
+	Retention  time.Duration
+}
+
+// RetentionResult adalah hasil penghapusan satu tabel log
+type RetentionResult struct {
+	Table        string `json:"table"`
+	Before       string `json:"before"`
+	Deleted      int64  `json:"deleted"`
+	ItemsDeleted int64  `json:"items_deleted"`
+}
+
+type CkgRetention struct {
+	Configurations *config.Configurations
+	Database       connection.DatabaseConnection
+	RetentionRepo  repository.Retention
+}
+
+func NewCkgRetention(ctx context.Context, config *config.Configurations, db connection.DatabaseConnection) *CkgRetention {
+	return &CkgRetention{
+		Configurations: config,
+		Database:       db,
+		RetentionRepo:  repository.NewRetentionRepository(ctx, config, db),
+	}
+}
+
+// Run menjalankan Purge setiap RetentionConfig.Interval sampai ctx selesai
+func (r *CkgRetention) Run(ctx context.Context) {
+	interval := r.Configurations.Retention.Interval
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	slog.Info("Memulai retention log", "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Purge(ctx); err != nil {
+			slog.Error("Gagal menjalankan retention log", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Context cancelled, stopping retention...")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge menghapus log incoming dan outgoing serta outbox yang sudah terkirim yang melewati masa retensi
+func (r *CkgRetention) Purge(ctx context.Context) ([]RetentionResult, error) {
+	cfg := r.Configurations
+	tables := []retentionTable{
+		{
+			Table:      cfg.CKG.TableIncoming,
+			TimeColumn: "received_at",
+			ItemTable:  cfg.CKG.TableIncomingItem,
+			Retention:  cfg.Retention.Incoming,
+		},
+		{
+			Table:      cfg.CKG.TableOutgoing,
+			TimeColumn: "created_at",
+			ItemTable:  cfg.CKG.TableOutgoingItem,
+			Retention:  cfg.Retention.Outgoing,
+		},
+		{
+			// published_at hanya terisi untuk outbox yang sudah terkirim, outbox yang belum
+			// terkirim atau gagal tidak pernah dihapus
+			Table:      cfg.CKG.TableOutbox,
+			TimeColumn: "published_at",
+			Retention:  cfg.Retention.Outbox,
+		},
+	}
+
+	var archive *retentionArchive
+	if cfg.Retention.Archive.Enabled {
+		archive = newRetentionArchive(cfg.Retention.Archive.Dir, time.Now())
+		defer func() {
+			if err := archive.Close(); err != nil {
+				slog.Error("Gagal menutup file arsip retention", "error", err)
+			}
+		}()
+	}
+
+	results := []RetentionResult{}
+	for _, table := range tables {
+		if table.Retention <= 0 {
+			continue
+		}
+
+		result, err := r.purgeTable(ctx, table, archive)
+		results = append(results, result)
+		if err != nil {
+			return results, fmt.Errorf("retention %s: %w", table.Table, err)
+		}
+		if result.Deleted > 0 {
+			slog.Info("Retention log selesai", "table", result.Table, "before", result.Before, "deleted", result.Deleted, "items_deleted", result.ItemsDeleted)
+		}
+	}
+
+	return results, nil
+}
+
+// purgeTable menghapus baris table yang lebih lama dari masa retensi per BatchSize baris.
+// Item dihapus sebelum induknya agar tidak ada item yang tertinggal tanpa induk bila proses terhenti.
+func (r *CkgRetention) purgeTable(ctx context.Context, table retentionTable, archive *retentionArchive) (RetentionResult, error) {
+	batchSize := r.Configurations.Retention.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	result := RetentionResult{
+		Table:  table.Table,
+		Before: time.Now().Add(-table.Retention).Format(time.RFC3339),
+	}
+
+	for ctx.Err() == nil {
+		rows, err := r.RetentionRepo.FindExpired(table.Table, table.TimeColumn, result.Before, batchSize)
+		if err != nil {
+			return result, err
+		}
+
+		ids := make([]string, 0, len(rows))
+		for _, row := range rows {
+			if id, ok := row["id"].(string); ok {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			return result, nil
+		}
+
+		if archive != nil {
+			if err := archive.Write(table.Table, rows); err != nil {
+				return result, fmt.Errorf("gagal menulis arsip: %w", err)
+			}
+		}
+
+		if table.ItemTable != "" {
+			if archive != nil {
+				items, err := r.RetentionRepo.FindByKeys(table.ItemTable, "message_id", ids)
+				if err != nil {
+					return result, err
+				}
+				if err := archive.Write(table.ItemTable, items); err != nil {
+					return result, fmt.Errorf("gagal menulis arsip: %w", err)
+				}
+			}
+
+			itemsDeleted, err := r.RetentionRepo.DeleteByKeys(table.ItemTable, "message_id", ids)
+			if err != nil {
+				return result, err
+			}
+			result.ItemsDeleted += itemsDeleted
+		}
+
+		deleted, err := r.RetentionRepo.DeleteByKeys(table.Table, "id", ids)
+		if err != nil {
+			return result, err
+		}
+		result.Deleted += deleted
+
+		if int64(len(rows)) < batchSize {
+			return result, nil
+		}
+	}
+
+	return result, ctx.Err()
+}
+
+// retentionArchive menulis baris yang akan dihapus ke file <table>-<waktu>.jsonl.gz, satu file per tabel
+type retentionArchive struct {
+	dir   string
+	stamp string
+	files map[string]*archiveFile
+}
+
+type archiveFile struct {
+	file    *os.File
+	gzip    *gzip.Writer
+	encoder *json.Encoder
+}
+
+func newRetentionArchive(dir string, now time.Time) *retentionArchive {
+	return &retentionArchive{
+		dir:   dir,
+		stamp: now.Format("20060102T150405"),
+		files: map[string]*archiveFile{},
+	}
+}
+
+// Write menambahkan rows ke arsip table. Data di-flush ke disk sebelum kembali
+// sehingga baris sudah tersimpan saat dihapus dari database.
+func (a *retentionArchive) Write(table string, rows []dbtypes.M) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	f, err := a.open(table)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if err := f.encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	if err := f.gzip.Flush(); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+func (a *retentionArchive) open(table string) (*archiveFile, error) {
+	if f, ok := a.files[table]; ok {
+		return f, nil
+	}
+
+	if err := os.MkdirAll(a.dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(a.dir, fmt.Sprintf("%s-%s.jsonl.gz", table, a.stamp))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(file)
+	encoder := json.NewEncoder(gz)
+	encoder.SetEscapeHTML(false)
+
+	f := &archiveFile{file: file, gzip: gz, encoder: encoder}
+	a.files[table] = f
+	slog.Info("Menulis arsip retention", "table", table, "file", path)
+	return f, nil
+}
+
+// Close menutup semua file arsip
+func (a *retentionArchive) Close() error {
+	var firstErr error
+	for table, f := range a.files {
+		if err := f.gzip.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err := f.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(a.files, table)
+	}
+	return firstErr
+}
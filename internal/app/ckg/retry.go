@@ -0,0 +1,68 @@
+package ckg
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"pubsub-ckg-tb/internal/db/utils"
+)
+
+// maxRetryDelay membatasi backoff agar tidak melebihi batas wajar ack deadline
+const maxRetryDelay = 30 * time.Second
+
+// retryBackoff menghitung delay exponential (base * 2^attempt) dengan jitter antara 50%-100%
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+
+	delay := base << attempt
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// withRetry menjalankan fn dan mengulanginya hanya untuk error transient (koneksi database, timeout),
+// maksimal retryCount kali. Error permanen langsung dikembalikan tanpa retry.
+func withRetry(ctx context.Context, retryCount int, retryDelay time.Duration, name string, fn func(ctx context.Context) error) (int, error) {
+	attempt := 0
+	for {
+		attempt++
+		err := fn(ctx)
+		if err == nil {
+			return attempt, nil
+		}
+
+		if !utils.IsTransientError(err) {
+			slog.Debug("Error permanen, tidak di-retry", "name", name, "error", err)
+			return attempt, err
+		}
+
+		if attempt > retryCount {
+			slog.Warn("Batas retry tercapai", "name", name, "attempt", attempt, "error", err)
+			return attempt, err
+		}
+
+		delay := retryBackoff(retryDelay, attempt-1)
+		slog.Info("Error transient, mencoba ulang", "name", name, "attempt", attempt, "delay", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// sleepContext menunggu selama delay atau sampai ctx selesai
+func sleepContext(ctx context.Context, delay time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(delay):
+	}
+}
@@ -2,16 +2,18 @@ package ckg
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"log"
 	"log/slog"
+	"maps"
 	"time"
 
 	"pubsub-ckg-tb/internal/config"
 	"pubsub-ckg-tb/internal/db/connection"
 	"pubsub-ckg-tb/internal/db/mongo"
+	"pubsub-ckg-tb/internal/db/utils"
 	"pubsub-ckg-tb/internal/models"
-	"pubsub-ckg-tb/internal/pubsub"
+	"pubsub-ckg-tb/internal/pubsub/broker"
 	"pubsub-ckg-tb/internal/repository"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -20,131 +22,219 @@ import (
 type CkgTransmitter struct {
 	Configurations *config.Configurations
 	Database       connection.DatabaseConnection
-	PubSub         *pubsub.Client
+	Broker         broker.Broker
 	PubSubRepo     repository.PubSub
+	OutboxRepo     repository.Outbox
+	CheckpointRepo repository.Checkpoint
 	CkgRepo        repository.CKGTB
+
+	// latest menyimpan data terakhir per pasien_ckg_id yang terkirim atau menunggu di outbox
+	latest *latestCache
+
+	// dryRun menulis message ke output alih-alih menyimpan ke outbox dan mengirim ke broker
+	dryRun *DryRunOutput
 }
 
-func NewCkgTransmitter(ctx context.Context, config *config.Configurations, db connection.DatabaseConnection, pubsub *pubsub.Client) *CkgTransmitter {
+func NewCkgTransmitter(ctx context.Context, config *config.Configurations, db connection.DatabaseConnection, broker broker.Broker) *CkgTransmitter {
 	pubsubRepo := repository.NewPubSubRepository(ctx, config, db)
+	outboxRepo := repository.NewOutboxRepository(ctx, config, db)
+	checkpointRepo := repository.NewCheckpointRepository(ctx, config, db)
 	ckgRepo := repository.NewCKGTBRepository(ctx, config, db)
 
 	return &CkgTransmitter{
 		Configurations: config,
 		Database:       db,
-		PubSub:         pubsub,
+		Broker:         broker,
 		PubSubRepo:     pubsubRepo,
+		OutboxRepo:     outboxRepo,
+		CheckpointRepo: checkpointRepo,
 		CkgRepo:        ckgRepo,
+		latest:         newLatestCache(config.Producer.Dedup.CacheSize),
 	}
 }
 
-func (t *CkgTransmitter) Watch(ctx context.Context) {
-	// Get database and collection names from config
-	// databaseName := t.Configurations.Database.Database
-	// collectionName := t.Configurations.CKG.TableSkrining
+// SetDryRun mengaktifkan mode dry-run: Produce menulis setiap message ke output sebagai JSON lines
+// tanpa menulis outbox/log outgoing dan tanpa mengirim ke broker
+func (t *CkgTransmitter) SetDryRun(output *DryRunOutput) {
+	t.dryRun = output
+}
 
-	// Only support MongoDB for now
-	if t.Database.GetDriver() != "mongodb" {
-		slog.Error("Only MongoDB is supported for change streams")
-		return
+// Watch memantau perubahan data skrining: change stream untuk MongoDB, polling untuk MySQL/PostgreSQL,
+// atau logical replication (PostgreSQL) / binlog (MySQL) sesuai PRODUCER_WATCH_SOURCE
+func (t *CkgTransmitter) Watch(ctx context.Context) {
+	switch t.Database.GetDriver() {
+	case "mongodb":
+		t.watchMongo(ctx)
+	case "postgres":
+		if t.Configurations.Producer.Watch.Source == "logical" {
+			t.watchLogical(ctx)
+			return
+		}
+		t.watchPolling(ctx)
+	case "mysql":
+		if t.Configurations.Producer.Watch.Source == "binlog" {
+			t.watchBinlog(ctx)
+			return
+		}
+		t.watchPolling(ctx)
+	default:
+		slog.Error("Driver database tidak mendukung mode watch", "driver", t.Database.GetDriver())
 	}
+}
 
-	// mongoConn := t.Database.GetMongoConnection()
-	// db := mongoConn.Database(databaseName)
-	// collection := db.Collection(collectionName)
+func (t *CkgTransmitter) watchMongo(ctx context.Context) {
 	mongoDB := t.Database.(*mongo.MongoDBConnection)
-	// collection := mongoDB.GetCollection(collectionName)
+	checkpointID := "watch:" + t.Configurations.CKG.TableSkrining
+
+	slog.Info("Memulai watch untuk perubahan pada collection", "database", t.Configurations.Database.Database, "collection", t.Configurations.CKG.TableSkrining)
+
+	// Perubahan yang terdeteksi masuk ke outbox, relay yang mengirimkan ke broker
+	go t.RunOutboxRelay(ctx)
+
+	for ctx.Err() == nil {
+		err := t.watchChangeStream(ctx, mongoDB, checkpointID)
+		if ctx.Err() != nil {
+			break
+		}
+
+		if utils.IsChangeStreamHistoryLost(err) {
+			// Resume token sudah hilang dari oplog, kirim ulang perubahan sejak checkpoint lalu mulai stream baru
+			slog.Warn("Resume token change stream kedaluwarsa, menjalankan backfill", "error", err)
+			if err := t.backfillFromCheckpoint(ctx, checkpointID); err != nil {
+				slog.Error("Gagal menjalankan backfill", "error", err)
+				sleepContext(ctx, 5*time.Second)
+			}
+			continue
+		}
 
-	// // Create change stream options
-	// changeStreamOptions := options.ChangeStream()
-	// changeStreamOptions.SetFullDocument(options.UpdateLookup)
+		slog.Error("Error pada change stream", "error", err)
 
-	// // Create change stream
-	// changeStream, err := collection.Watch(ctx, []bson.M{}, changeStreamOptions)
-	changeStream := mongoDB.Watch(ctx, t.Configurations.CKG.TableSkrining)
-	if changeStream == nil {
-		return
+		// Check MongoDB connection health before reopening the stream
+		if err := t.Database.Ping(ctx); err != nil {
+			slog.Error("MongoDB connection is not healthy, waiting before retry...", "error", err)
+		}
+		sleepContext(ctx, 5*time.Second)
+		slog.Info("Mencoba membuat ulang change stream...")
+	}
+
+	slog.Info("Context cancelled, stopping watch...")
+}
+
+// watchChangeStream membuka change stream dari resume token terakhir lalu memproses perubahan
+// sampai terjadi error. Resume token disimpan setelah setiap perubahan selesai diproses
+// (tersimpan di outbox atau memang tidak perlu dikirim).
+func (t *CkgTransmitter) watchChangeStream(ctx context.Context, mongoDB *mongo.MongoDBConnection, checkpointID string) error {
+	checkpoint, err := t.CheckpointRepo.GetCheckpoint(checkpointID)
+	if err != nil {
+		return err
+	}
+
+	var resumeToken bson.Raw
+	var startAt time.Time
+	if checkpoint != nil && checkpoint.Position != "" {
+		if err := bson.UnmarshalExtJSON([]byte(checkpoint.Position), true, &resumeToken); err != nil {
+			slog.Warn("Resume token tidak valid, memulai change stream baru", "error", err)
+			resumeToken = nil
+		}
+	} else if checkpoint != nil {
+		// Checkpoint tanpa resume token (setelah backfill), lanjutkan dari waktu checkpoint
+		startAt, _ = time.Parse(time.RFC3339, checkpoint.CheckpointAt)
+	}
+
+	changeStream, err := mongoDB.Watch(ctx, t.Configurations.CKG.TableSkrining, resumeToken, startAt, t.Configurations.Producer.Watch.PreImages)
+	if err != nil {
+		return err
 	}
 	defer changeStream.Close(ctx)
 
-	slog.Info("Memulai watch untuk perubahan pada collection", "database", t.Configurations.Database.Database, "collection", t.Configurations.CKG.TableSkrining)
+	slog.Info("Change stream dibuka", "resume", resumeToken != nil)
 
-	// Listen for changes
-	for {
-		select {
-		case <-ctx.Done():
-			slog.Info("Context cancelled, stopping watch...")
-			return
-		default:
-			if changeStream.Next(ctx) {
-				var changeDoc bson.M
-				if err := changeStream.Decode(&changeDoc); err != nil {
-					slog.Error("Gagal decode change stream document", "error", err)
-					continue
-				}
-
-				// Process the change
-				if err := t.processChange(ctx, changeDoc); err != nil {
-					slog.Error("Gagal memproses perubahan", "error", err)
-				}
-			} else {
-				// Check for errors
-				if err := changeStream.Err(); err != nil {
-					slog.Error("Error pada change stream", "error", err)
-
-					// Check if error is due to client disconnection
-					if err.Error() == "client is disconnected" {
-						slog.Info("MongoDB client terputus, mencoba reconnect...")
-
-						// Try to reconnect and recreate change stream
-						select {
-						case <-ctx.Done():
-							return
-						default:
-							// Close existing change stream
-							// changeStream.Close(ctx)
-
-							// Check MongoDB connection health
-							if err := t.Database.Ping(ctx); err != nil {
-								slog.Error("MongoDB connection is not healthy, waiting before retry...", "error", err)
-								time.Sleep(5 * time.Second)
-								continue
-							}
-
-							// Create new change stream
-							// changeStream, err = collection.Watch(ctx, []bson.M{}, changeStreamOptions)
-							changeStream, err = mongoDB.RestartWatch(ctx, t.Configurations.CKG.TableSkrining, changeStream)
-							if err != nil {
-								// Wait before retrying
-								time.Sleep(5 * time.Second)
-								continue
-							}
-
-							slog.Info("Berhasil membuat ulang change stream")
-							continue
-						}
-					} else {
-						// For other errors, try to recreate the change stream
-						select {
-						case <-ctx.Done():
-							return
-						default:
-							slog.Info("Mencoba membuat ulang change stream...")
-							// changeStream.Close(ctx)
-							// changeStream, err = collection.Watch(ctx, []bson.M{}, changeStreamOptions)
-							changeStream, err = mongoDB.RestartWatch(ctx, t.Configurations.CKG.TableSkrining, changeStream)
-							if err != nil {
-								// Wait before retrying
-								time.Sleep(5 * time.Second)
-								continue
-							}
-							continue
-						}
-					}
-				}
+	for changeStream.Next(ctx) {
+		var changeDoc bson.M
+		if err := changeStream.Decode(&changeDoc); err != nil {
+			slog.Error("Gagal decode change stream document", "error", err)
+			continue
+		}
+
+		// Process the change
+		if err := t.processChange(ctx, changeDoc); err != nil {
+			if utils.IsTransientError(err) {
+				// Buka ulang dari checkpoint terakhir agar perubahan ini diproses lagi
+				return err
 			}
+			slog.Error("Gagal memproses perubahan", "error", err)
 		}
+
+		if err := t.saveResumeToken(checkpointID, changeStream.ResumeToken()); err != nil {
+			slog.Error("Gagal menyimpan resume token", "error", err)
+		}
+	}
+
+	if err := changeStream.Err(); err != nil {
+		return err
 	}
+	return ctx.Err()
+}
+
+func (t *CkgTransmitter) saveResumeToken(checkpointID string, resumeToken bson.Raw) error {
+	if len(resumeToken) == 0 {
+		return nil
+	}
+
+	position, err := bson.MarshalExtJSON(resumeToken, true, false)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	return t.CheckpointRepo.SaveCheckpoint(models.Checkpoint{
+		ID:           checkpointID,
+		Position:     string(position),
+		CheckpointAt: now,
+		UpdatedAt:    now,
+	})
+}
+
+// backfillFromCheckpoint mengirim perubahan sejak checkpoint terakhir dengan cara yang sama
+// seperti Produce. Setelah berhasil, resume token dihapus dan change stream berikutnya
+// dimulai dari waktu backfill sehingga perubahan selama backfill tetap terkirim.
+func (t *CkgTransmitter) backfillFromCheckpoint(ctx context.Context, checkpointID string) error {
+	checkpoint, err := t.CheckpointRepo.GetCheckpoint(checkpointID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	start := ""
+	if checkpoint != nil {
+		start = checkpoint.CheckpointAt
+	}
+	if start == "" {
+		start, _ = t.PubSubRepo.GetLastOutgoingTimestamp()
+	}
+
+	if err := t.Backfill(ctx, start, now); err != nil {
+		return err
+	}
+
+	return t.CheckpointRepo.SaveCheckpoint(models.Checkpoint{
+		ID:           checkpointID,
+		CheckpointAt: now,
+		UpdatedAt:    time.Now().Format(time.RFC3339),
+	})
+}
+
+// Backfill menyimpan ke outbox semua data skrining yang berubah antara start dan end
+func (t *CkgTransmitter) Backfill(ctx context.Context, start string, end string) error {
+	if start == "" {
+		start = time.Now().Add(-48 * time.Hour).Format(time.RFC3339)
+	}
+
+	slog.Info("Backfill data skrining", "start", start, "end", end)
+	filter := repository.SkriningFilter{Start: start, End: end}
+	return t.forEachPendingPage(ctx, filter, 0, pendingCursor{}, func(page []*models.SkriningCKGResult, _ pendingCursor) error {
+		return t.enqueuePage(page)
+	})
 }
 
 func (t *CkgTransmitter) processChange(ctx context.Context, changeDoc bson.M) error {
@@ -158,7 +248,7 @@ func (t *CkgTransmitter) processChange(ctx context.Context, changeDoc bson.M) er
 	documentKey, ok := changeDoc["documentKey"].(bson.M)
 	if !ok {
 		str, _ := bson.MarshalExtJSON(changeDoc, false, false)
-		log.Printf("changeDoc: %s", str)
+		slog.Debug("Change document tanpa documentKey", "change", string(str))
 		return fmt.Errorf("documentKey tidak ditemukan dalam change document")
 	}
 
@@ -178,6 +268,16 @@ func (t *CkgTransmitter) processChange(ctx context.Context, changeDoc bson.M) er
 		} else {
 			return fmt.Errorf("fullDocument tidak ditemukan untuk operation: %s", operation)
 		}
+	case "delete":
+		// Tanpa pre-image hanya _id yang tersedia, pasien_ckg_id tidak bisa diketahui
+		before, ok := changeDoc["fullDocumentBeforeChange"].(bson.M)
+		if !ok {
+			slog.Warn("Data sebelum delete tidak tersedia, retraksi tidak dikirim", "id", id)
+			return nil
+		}
+		raw := models.SkriningCKGRaw{}
+		raw.FromMap(before)
+		return t.enqueueRetraction(raw.PasienCKGID, raw.PasienNIK, models.RetraksiAlasanDihapus, operation)
 	default:
 		slog.Debug("Operation type tidak didukung", "operation", operation)
 		return nil
@@ -194,132 +294,270 @@ func (t *CkgTransmitter) processChange(ctx context.Context, changeDoc bson.M) er
 		return err
 	}
 
-	// Bukan terduga TB abaikan saja
+	return t.enqueueChange(skriningResult, operation)
+}
+
+// processRowChange memproses satu baris perubahan dari database SQL (polling, logical replication, binlog).
+// Baris yang dihapus dikirim sebagai retraksi.
+func (t *CkgTransmitter) processRowChange(operation string, row map[string]any) error {
+	if operation == "delete" {
+		raw := models.SkriningCKGRaw{}
+		raw.FromMap(row)
+		return t.enqueueRetraction(raw.PasienCKGID, raw.PasienNIK, models.RetraksiAlasanDihapus, operation)
+	}
+
+	skriningResult, err := t.CkgRepo.GetOnePendingTbSkriningFromMap(row)
+	if err != nil || skriningResult == nil {
+		return err
+	}
+
+	return t.enqueueChange(skriningResult, operation)
+}
+
+// enqueueChange menyimpan satu data skrining yang berubah ke outbox jika pasien terduga TB
+// dan datanya berbeda dengan yang terakhir dikirim
+func (t *CkgTransmitter) enqueueChange(skriningResult *models.SkriningCKGResult, operation string) error {
+	// Bukan terduga TB: kirim retraksi jika sebelumnya sudah terkirim sebagai terduga
 	if skriningResult.TerdugaTb == nil || *skriningResult.TerdugaTb != "Ya" {
-		return nil
+		return t.enqueueRetraction(skriningResult.PasienCKGID, skriningResult.PasienNIK, models.RetraksiAlasanBukanTerduga, operation)
 	}
 
 	// Prepare data for PubSub
-	output := []*models.SkriningCKGResult{skriningResult} // array dengan 1 entry
-	// pubsubObjectWrapper := models.PubSubObjectWrapper[*models.SkriningCKGResult]{
-	// 	Data: output,
-	// }
-	pubsubObjectWrapper := models.NewPubSubProducerWrapper(output)
+	output := t.skipUnchanged([]*models.SkriningCKGResult{skriningResult}) // array dengan 1 entry
+	if len(output) == 0 {
+		return nil
+	}
+	attributes := t.messageAttributes()
+	attributes["operation_type"] = operation
 
-	jsonStr, err := pubsubObjectWrapper.ToJSON()
-	if err != nil {
+	// Simpan ke outbox, dikirim oleh relay
+	_, err := t.Enqueue(output, attributes)
+	return err
+}
+
+// enqueueRetraction menyimpan retraksi ke outbox untuk pasien yang data terakhirnya terkirim
+// sebagai terduga TB, agar SITB tidak menyimpan terduga yang sudah tidak berlaku
+func (t *CkgTransmitter) enqueueRetraction(pasienCkgID string, pasienNIK string, alasan string, operation string) error {
+	if pasienCkgID == "" {
+		return nil
+	}
+
+	terduga, err := t.sentAsTerduga(pasienCkgID)
+	if err != nil || !terduga {
 		return err
 	}
 
-	attributes := t.Configurations.Producer.MessageAttributes
+	retraksi := &models.RetraksiSkriningCKG{
+		PasienCKGID: pasienCkgID,
+		Alasan:      alasan,
+		RetractedAt: time.Now().Format(time.RFC3339),
+	}
+	if pasienNIK != "" {
+		retraksi.PasienNIK = &pasienNIK
+	}
+
+	slog.Info("Mengirim retraksi data skrining", "pasien_ckg_id", pasienCkgID, "alasan", alasan)
+	attributes := t.messageAttributes()
+	attributes["operation_type"] = operation
+
+	_, err = t.EnqueueRetraction([]*models.RetraksiSkriningCKG{retraksi}, attributes)
+	return err
+}
+
+// messageAttributes menyalin attributes dari konfigurasi lalu menambahkan attributes standar
+func (t *CkgTransmitter) messageAttributes() map[string]string {
+	attributes := maps.Clone(t.Configurations.Producer.MessageAttributes)
 	if attributes == nil {
 		attributes = make(map[string]string)
 	}
 	attributes["environment"] = t.Configurations.App.Environment
 	attributes["timestamp"] = time.Now().Format(time.RFC3339)
-	attributes["operation_type"] = operation
-
-	// Send data via PubSub
-	slog.Debug("Publish Message", "message", jsonStr, "attributes", attributes)
-	t.PubSub.PublishMessage(ctx, []byte(jsonStr), attributes)
 
-	return nil
+	return attributes
 }
 
 func (t *CkgTransmitter) Produce(ctx context.Context) error {
-	output, err := t.Prepare(ctx)
-	if err != nil {
+	if t.dryRun != nil {
+		return t.Prepare(ctx, t.writeDryRunPage)
+	}
+
+	// Kirim dulu sisa outbox dari proses sebelumnya yang terhenti
+	if err := t.DrainOutbox(ctx); err != nil {
+		slog.Warn("Gagal mengirim sisa outbox", "error", err)
+		return err
+	}
+
+	if err := t.Prepare(ctx, t.enqueuePage); err != nil {
 		slog.Warn("Gagal menjalankan producer", "error", err)
 		return err
 	}
 
-	if len(output) > 0 {
-		batchSize := t.Configurations.Producer.BatchSize
-		totalItems := len(output)
-		count := 0
+	// Kirim isi outbox ke broker
+	return t.DrainOutbox(ctx)
+}
 
-		// Pecah data ke dalam batch dan kirim satu-satu
-		for i := 0; i < totalItems; i += batchSize {
-			end := i + batchSize
-			if end > totalItems {
-				end = totalItems
-			}
+// enqueuePage menyimpan satu halaman data skrining ke outbox, data yang tidak berubah sejak
+// terakhir dikirim tidak perlu dikirim ulang
+func (t *CkgTransmitter) enqueuePage(page []*models.SkriningCKGResult) error {
+	return t.enqueueBatches(t.skipUnchanged(page))
+}
 
-			batch := output[i:end]
+// writeDryRunPage menulis satu halaman data skrining ke output dry-run dengan batch dan
+// serialisasi yang sama seperti message yang dikirim ke broker
+func (t *CkgTransmitter) writeDryRunPage(page []*models.SkriningCKGResult) error {
+	return t.forEachBatch(t.skipUnchanged(page), func(batch []*models.SkriningCKGResult) error {
+		pubsubObjectWrapper := models.NewPubSubProducerWrapper(batch)
+		jsonStr, err := pubsubObjectWrapper.ToJSON()
+		if err != nil {
+			return err
+		}
 
-			// pubsubObjectWrapper := models.PubSubObjectWrapper[*models.SkriningCKGResult]{
-			// 	Data: batch,
-			// }
-			pubsubObjectWrapper := models.NewPubSubProducerWrapper(batch)
+		return t.dryRun.Write(dryRunMessage{
+			Topic:      t.Configurations.PubSub.Topic,
+			Attributes: t.messageAttributes(),
+			Count:      len(batch),
+			Data:       json.RawMessage(jsonStr),
+		})
+	})
+}
 
-			jsonStr, err := pubsubObjectWrapper.ToJSON()
-			if err != nil {
-				return err
-			}
+// enqueueBatches memecah data ke dalam batch lalu menyimpannya ke outbox
+func (t *CkgTransmitter) enqueueBatches(output []*models.SkriningCKGResult) error {
+	return t.forEachBatch(output, func(batch []*models.SkriningCKGResult) error {
+		_, err := t.Enqueue(batch, t.messageAttributes())
+		return err
+	})
+}
 
-			attributes := t.Configurations.Producer.MessageAttributes
-			if attributes == nil {
-				attributes = map[string]string{}
-			}
-			attributes["environment"] = t.Configurations.App.Environment
-			attributes["timestamp"] = time.Now().Format(time.RFC3339)
-
-			slog.Debug("JSON: " + jsonStr)
-			// Kirim data via PubSub
-			msgID, err := t.PubSub.PublishMessage(ctx, []byte(jsonStr), attributes)
-			if err == nil {
-				// Simpan log outgoing message
-				outgoing := models.OutgoingMessageSkriningTB{
-					ID:        msgID,
-					CreatedAt: time.Now().Format(time.RFC1123),
-				}
-				t.PubSubRepo.SaveOutgoing(outgoing)
-			}
+// forEachBatch memecah data ke dalam batch berukuran ProducerConfig.BatchSize
+func (t *CkgTransmitter) forEachBatch(output []*models.SkriningCKGResult, handle func(batch []*models.SkriningCKGResult) error) error {
+	batchSize := t.Configurations.Producer.BatchSize
+	totalItems := len(output)
 
-			// tiap 10 langkah istirahat bentar, serius santai
-			count++
-			if count%10 == 0 {
-				time.Sleep(1 * time.Second)
-			}
+	for i := 0; i < totalItems; i += batchSize {
+		end := i + batchSize
+		if end > totalItems {
+			end = totalItems
+		}
+
+		if err := handle(output[i:end]); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (t *CkgTransmitter) Prepare(ctx context.Context) ([]*models.SkriningCKGResult, error) {
-	start := ""
-	end := ""
-	limit := int64(0)
-	output := make([]*models.SkriningCKGResult, 0)
+// Prepare membaca seluruh data skrining pada rentang ProducerConfig.Window per halaman
+// (BatchSize data) dan menyerahkan setiap halaman ke handle
+func (t *CkgTransmitter) Prepare(ctx context.Context, handle func(page []*models.SkriningCKGResult) error) error {
+	window := t.Configurations.Producer.Window
+	now := time.Now()
 
 	// Get last timestamp from outgoing table
+	start := window.Start
 	if start == "" || start == "last" {
 		start, _ = t.PubSubRepo.GetLastOutgoingTimestamp()
+	} else {
+		start = windowTime(start, false)
 	}
 
 	// If no last timestamp, use default start time
-	now := time.Now()
 	if start == "" {
-		defaultTime := now.Add(-48 * time.Hour) // Default to 6 hours ago
-		start = defaultTime.Format(time.RFC3339)
+		start = now.Add(-48 * time.Hour).Format(time.RFC3339)
 	}
 
+	end := windowTime(window.End, true)
 	if end == "" {
 		end = now.Format(time.RFC3339)
 	}
 
-	if limit == 0 {
-		limit = int64(t.Configurations.Producer.BatchSize)
+	slog.Info("Menyiapkan data skrining", "start", start, "end", end, "limit", window.Limit)
+	filter := repository.SkriningFilter{Start: start, End: end}
+	return t.forEachPendingPage(ctx, filter, window.Limit, pendingCursor{}, func(page []*models.SkriningCKGResult, _ pendingCursor) error {
+		return handle(page)
+	})
+}
+
+// pendingCursor adalah posisi paging data skrining: updated_at terakhir yang dibaca, jumlah data
+// pada updated_at tersebut yang sudah dibaca, dan total data yang sudah dibaca
+type pendingCursor struct {
+	UpdatedAt string `json:"updated_at"`
+	Skip      int64  `json:"skip"`
+	Total     int64  `json:"total"`
+}
+
+// forEachPendingPage membaca data skrining sesuai filter mulai dari cursor (maksimal limit data,
+// 0 berarti semua) per halaman. Halaman berikutnya dimulai dari updated_at terakhir dengan melewati
+// data pada updated_at tersebut yang sudah dibaca. Data dengan updated_at yang sama diurutkan berdasarkan
+// primary key, sehingga data yang dilewati selalu data yang sama walaupun cursor dibaca ulang dari
+// checkpoint. handle menerima cursor setelah halaman tersebut.
+func (t *CkgTransmitter) forEachPendingPage(ctx context.Context, filter repository.SkriningFilter, limit int64, cursor pendingCursor, handle func(page []*models.SkriningCKGResult, next pendingCursor) error) error {
+	pageSize := int64(t.Configurations.Producer.BatchSize)
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	if cursor.UpdatedAt == "" {
+		cursor.UpdatedAt = filter.Start
 	}
 
-	// Get status pasien data from database
-	pending, err := t.CkgRepo.GetPendingTbSkrining(start, end, limit)
-	if err == nil {
+	for ctx.Err() == nil {
+		size := pageSize
+		if limit > 0 {
+			size = min(size, limit-cursor.Total)
+		}
+		if size <= 0 {
+			break
+		}
+
+		filter.Start = cursor.UpdatedAt
+		pending, err := t.CkgRepo.GetPendingTbSkrining(filter, size, cursor.Skip)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		page := make([]*models.SkriningCKGResult, 0, len(pending))
 		for _, skrining := range pending {
-			output = append(output, &skrining)
+			page = append(page, &skrining)
+		}
+
+		// Hitung data pada updated_at terakhir yang sudah dibaca
+		last := pending[len(pending)-1].UpdatedAt
+		if last != cursor.UpdatedAt {
+			cursor.UpdatedAt = last
+			cursor.Skip = 0
+		}
+		for i := len(pending) - 1; i >= 0 && pending[i].UpdatedAt == cursor.UpdatedAt; i-- {
+			cursor.Skip++
+		}
+		cursor.Total += int64(len(pending))
+
+		if err := handle(page, cursor); err != nil {
+			return err
+		}
+
+		if int64(len(pending)) < size {
+			break
 		}
 	}
 
-	return output, nil
+	slog.Info("Data skrining selesai dibaca", "total", cursor.Total)
+	return ctx.Err()
+}
+
+// windowTime mengubah tanggal (YYYY-MM-DD) menjadi awal hari, atau akhir hari jika endOfDay,
+// dalam format RFC3339. Nilai lain dikembalikan apa adanya.
+func windowTime(value string, endOfDay bool) string {
+	date, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return value
+	}
+	if endOfDay {
+		date = date.Add(24*time.Hour - time.Second)
+	}
+	return date.Format(time.RFC3339)
 }
@@ -12,6 +12,7 @@ func setEnvBindings() map[string]string {
 		"google.debug":       "GOOGLE_DEBUG",
 
 		// PubSub
+		"pubsub.broker":          "PUBSUB_BROKER",
 		"pubsub.topic":           "PUBSUB_TOPIC",
 		"pubsub.subscription":    "PUBSUB_SUBSCRIPTION",
 		"pubsub.messageordering": "PUBSUB_MESSAGEORDERING",
@@ -24,7 +25,19 @@ func setEnvBindings() map[string]string {
 		"consumer.retrydelay":              "CONSUMER_RETRYDELAY",
 		"consumer.flowcontrol.enabled":     "CONSUMER_FLOWCONTROL_ENABLED",
 		"consumer.flowcontrol.maxmessages": "CONSUMER_FLOWCONTROL_MAXMESSAGES",
+		"consumer.draintimeout":            "CONSUMER_DRAINTIMEOUT",
 		"consumer.flowcontrol.maxbytes":    "CONSUMER_FLOWCONTROL_MAXBYTES",
+		"consumer.flowcontrol.workers":     "CONSUMER_FLOWCONTROL_WORKERS",
+		"consumer.flowcontrol.queuesize":   "CONSUMER_FLOWCONTROL_QUEUESIZE",
+
+		"consumer.deadletterpolicy.enabled":     "CONSUMER_DEADLETTERPOLICY_ENABLED",
+		"consumer.deadletterpolicy.maxdelivery": "CONSUMER_DEADLETTERPOLICY_MAXDELIVERY",
+		"consumer.deadletterpolicy.topic":       "CONSUMER_DEADLETTERPOLICY_TOPIC",
+		"consumer.deadletterpolicy.topicsuffix": "CONSUMER_DEADLETTERPOLICY_TOPICSUFFIX",
+
+		"consumer.reply.enabled":     "CONSUMER_REPLY_ENABLED",
+		"consumer.reply.topic":       "CONSUMER_REPLY_TOPIC",
+		"consumer.reply.topicsuffix": "CONSUMER_REPLY_TOPICSUFFIX",
 
 		// Producer
 		"producer.enableordering":        "PRODUCER_ENABLEORDERING",
@@ -32,6 +45,35 @@ func setEnvBindings() map[string]string {
 		"producer.compression.enabled":   "PRODUCER_COMPRESSION_ENABLED",
 		"producer.compression.algorithm": "PRODUCER_COMPRESSION_ALGORITHM",
 
+		"producer.publish.delaythreshold": "PRODUCER_PUBLISH_DELAYTHRESHOLD",
+		"producer.publish.countthreshold": "PRODUCER_PUBLISH_COUNTTHRESHOLD",
+		"producer.publish.bytethreshold":  "PRODUCER_PUBLISH_BYTETHRESHOLD",
+		"producer.publish.timeout":        "PRODUCER_PUBLISH_TIMEOUT",
+		"producer.publish.maxinflight":    "PRODUCER_PUBLISH_MAXINFLIGHT",
+
+		"producer.outbox.relayinterval":     "PRODUCER_OUTBOX_RELAYINTERVAL",
+		"producer.outbox.batchsize":         "PRODUCER_OUTBOX_BATCHSIZE",
+		"producer.outbox.maxattempts":       "PRODUCER_OUTBOX_MAXATTEMPTS",
+		"producer.outbox.publishingtimeout": "PRODUCER_OUTBOX_PUBLISHINGTIMEOUT",
+
+		"producer.dedup.enabled":   "PRODUCER_DEDUP_ENABLED",
+		"producer.dedup.fields":    "PRODUCER_DEDUP_FIELDS",
+		"producer.dedup.cachesize": "PRODUCER_DEDUP_CACHESIZE",
+
+		"producer.watch.enabled":         "PRODUCER_WATCH_ENABLED",
+		"producer.watch.pollinterval":    "PRODUCER_WATCH_POLLINTERVAL",
+		"producer.watch.pollbatchsize":   "PRODUCER_WATCH_POLLBATCHSIZE",
+		"producer.watch.timestampcolumn": "PRODUCER_WATCH_TIMESTAMPCOLUMN",
+		"producer.watch.keycolumn":       "PRODUCER_WATCH_KEYCOLUMN",
+		"producer.watch.source":          "PRODUCER_WATCH_SOURCE",
+		"producer.watch.slot":            "PRODUCER_WATCH_SLOT",
+		"producer.watch.publication":     "PRODUCER_WATCH_PUBLICATION",
+		"producer.watch.serverid":        "PRODUCER_WATCH_SERVERID",
+		"producer.watch.preimages":       "PRODUCER_WATCH_PREIMAGES",
+		"producer.window.start":          "PRODUCER_WINDOW_START",
+		"producer.window.end":            "PRODUCER_WINDOW_END",
+		"producer.window.limit":          "PRODUCER_WINDOW_LIMIT",
+
 		// API
 		"api.baseurl":   "API_BASEURL",
 		"api.timeout":   "API_TIMEOUT",
@@ -49,15 +91,34 @@ func setEnvBindings() map[string]string {
 		"db.attributes": "DB_ATTRIBUTES",
 
 		// CKG
-		"ckg.usecache":           "CKG_USECACHE",
-		"ckg.tablemasterwilayah": "CKG_TABLE_MASTER_WILAYAH",
-		"ckg.tablemasterfaskes":  "CKG_TABLE_MASTER_FASKES",
-		"ckg.tableskrining":      "CKG_TABLE_SKRINING",
-		"ckg.tablestatus":        "CKG_TABLE_STATUS",
-		"ckg.tableincoming":      "CKG_TABLE_INCOMING",
-		"ckg.tableoutgoing":      "CKG_TABLE_OUTGOING",
-		"ckg.markerfield":        "CKG_MARKER_FIELD",
-		"ckg.markerconsume":      "CKG_MARKER_CONSUME",
-		"ckg.markerproduce":      "CKG_MARKER_PRODUCE",
+		"ckg.usecache":            "CKG_USECACHE",
+		"ckg.tablemasterwilayah":  "CKG_TABLE_MASTER_WILAYAH",
+		"ckg.tablemasterfaskes":   "CKG_TABLE_MASTER_FASKES",
+		"ckg.tableskrining":       "CKG_TABLE_SKRINING",
+		"ckg.tablestatus":         "CKG_TABLE_STATUS",
+		"ckg.tablestatushistory":  "CKG_TABLE_STATUS_HISTORY",
+		"ckg.tableincoming":       "CKG_TABLE_INCOMING",
+		"ckg.tableincomingitem":   "CKG_TABLE_INCOMING_ITEM",
+		"ckg.tableoutgoing":       "CKG_TABLE_OUTGOING",
+		"ckg.tableoutgoingitem":   "CKG_TABLE_OUTGOING_ITEM",
+		"ckg.tableoutgoinglatest": "CKG_TABLE_OUTGOING_LATEST",
+		"ckg.tablequarantine":     "CKG_TABLE_QUARANTINE",
+		"ckg.tableoutbox":         "CKG_TABLE_OUTBOX",
+		"ckg.tablecheckpoint":     "CKG_TABLE_CHECKPOINT",
+		"ckg.markerfield":         "CKG_MARKER_FIELD",
+		"ckg.markerconsume":       "CKG_MARKER_CONSUME",
+		"ckg.markerproduce":       "CKG_MARKER_PRODUCE",
+		"ckg.markerretract":       "CKG_MARKER_RETRACT",
+		"ckg.markerresponse":      "CKG_MARKER_RESPONSE",
+
+		// Retention
+		"retention.enabled":         "RETENTION_ENABLED",
+		"retention.interval":        "RETENTION_INTERVAL",
+		"retention.batchsize":       "RETENTION_BATCHSIZE",
+		"retention.incoming":        "RETENTION_INCOMING",
+		"retention.outgoing":        "RETENTION_OUTGOING",
+		"retention.outbox":          "RETENTION_OUTBOX",
+		"retention.archive.enabled": "RETENTION_ARCHIVE_ENABLED",
+		"retention.archive.dir":     "RETENTION_ARCHIVE_DIR",
 	}
 }
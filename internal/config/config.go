@@ -23,6 +23,7 @@ type Configurations struct {
 	API         APIConfig         `mapstructure:"api"`
 	Database    DatabaseConfig    `mapstructure:"db"`
 	CKG         CKGConfig         `mapstructure:"ckg"`
+	Retention   RetentionConfig   `mapstructure:"retention"`
 }
 
 type AppConfig struct {
@@ -37,31 +38,45 @@ type GoogleCloudConfig struct {
 }
 
 type PubSubConfig struct {
+	Broker          string `mapstructure:"broker"`
 	Topic           string `mapstructure:"topic"`
 	Subscription    string `mapstructure:"subscription"`
 	MessageOrdering bool   `mapstructure:"messageordering"`
 }
 
 type ConsumerConfig struct {
-	MaxMessagesPerPull    int               `mapstructure:"maxmessages"`
-	SleepTimeBetweenPulls time.Duration     `mapstructure:"sleeptime"`
-	AcknowledgeTimeout    time.Duration     `mapstructure:"acktimeout"`
-	RetryCount            int               `mapstructure:"retrycount"`
-	RetryDelay            time.Duration     `mapstructure:"retrydelay"`
-	FlowControl           FlowControlConfig `mapstructure:"flowcontrol"`
-	// DeadLetterPolicy      DeadLetterPolicyConfig `mapstructure:"deadletterpolicy"`
+	MaxMessagesPerPull    int                    `mapstructure:"maxmessages"`
+	SleepTimeBetweenPulls time.Duration          `mapstructure:"sleeptime"`
+	AcknowledgeTimeout    time.Duration          `mapstructure:"acktimeout"`
+	RetryCount            int                    `mapstructure:"retrycount"`
+	RetryDelay            time.Duration          `mapstructure:"retrydelay"`
+	DrainTimeout          time.Duration          `mapstructure:"draintimeout"`
+	FlowControl           FlowControlConfig      `mapstructure:"flowcontrol"`
+	DeadLetterPolicy      DeadLetterPolicyConfig `mapstructure:"deadletterpolicy"`
+	Reply                 ReplyConfig            `mapstructure:"reply"`
 }
 
-/*type DeadLetterPolicyConfig struct {
-	Enabled                bool  `mapstructure:"enabled"`
-	MaxDeliveryAttempts   int  `mapstructure:"maxdelivery"`
+// ReplyConfig mengatur message respon dari consumer ke SITB. Setiap message yang selesai diproses
+// dibalas ke Topic (kosong berarti topic utama + TopicSuffix) berisi hasil per item.
+type ReplyConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	Topic       string `mapstructure:"topic"`
+	TopicSuffix string `mapstructure:"topicsuffix"`
+}
+
+type DeadLetterPolicyConfig struct {
+	Enabled               bool   `mapstructure:"enabled"`
+	MaxDeliveryAttempts   int    `mapstructure:"maxdelivery"`
+	DeadLetterTopic       string `mapstructure:"topic"`
 	DeadLetterTopicSuffix string `mapstructure:"topicsuffix"`
-}*/
+}
 
 type FlowControlConfig struct {
 	Enabled                bool  `mapstructure:"enabled"`
 	MaxOutstandingMessages int   `mapstructure:"maxmessages"`
 	MaxOutstandingBytes    int64 `mapstructure:"maxbytes"`
+	Workers                int   `mapstructure:"workers"`
+	QueueSize              int   `mapstructure:"queuesize"`
 }
 
 type ProducerConfig struct {
@@ -69,6 +84,66 @@ type ProducerConfig struct {
 	BatchSize             int               `mapstructure:"batchsize"`
 	MessageAttributes     map[string]string `mapstructure:"attributes"`
 	Compression           CompressionConfig `mapstructure:"compression"`
+	Publish               PublishConfig     `mapstructure:"publish"`
+	Outbox                OutboxConfig      `mapstructure:"outbox"`
+	Dedup                 DedupConfig       `mapstructure:"dedup"`
+	Watch                 WatchConfig       `mapstructure:"watch"`
+	Window                WindowConfig      `mapstructure:"window"`
+}
+
+// WindowConfig menentukan rentang data skrining pada mode one-time. Start kosong atau "last" berarti
+// sejak outgoing terakhir (atau 48 jam terakhir), End kosong berarti sekarang, Limit 0 berarti tanpa batas.
+// Start/End menerima RFC3339 atau tanggal (YYYY-MM-DD).
+type WindowConfig struct {
+	Start string `mapstructure:"start"`
+	End   string `mapstructure:"end"`
+	Limit int64  `mapstructure:"limit"`
+}
+
+// WatchConfig mengatur mode watch producer. MongoDB memakai change stream,
+// MySQL/PostgreSQL memakai polling dengan high-water mark TimestampColumn + KeyColumn.
+// PostgreSQL dapat memakai logical replication (Source "logical") melalui Slot dan Publication,
+// MySQL dapat membaca binlog (Source "binlog") sebagai replica dengan ServerID.
+// PreImages meminta data sebelum delete dari change stream MongoDB untuk pesan retraksi.
+type WatchConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	Source          string        `mapstructure:"source"`
+	Slot            string        `mapstructure:"slot"`
+	Publication     string        `mapstructure:"publication"`
+	ServerID        uint32        `mapstructure:"serverid"`
+	PreImages       bool          `mapstructure:"preimages"`
+	PollInterval    time.Duration `mapstructure:"pollinterval"`
+	PollBatchSize   int           `mapstructure:"pollbatchsize"`
+	TimestampColumn string        `mapstructure:"timestampcolumn"`
+	KeyColumn       string        `mapstructure:"keycolumn"`
+}
+
+// DedupConfig mengatur deteksi perubahan data skrining sebelum dikirim ulang.
+// Fields berisi nama field JSON SkriningCKGResult yang dihitung, kosong berarti semua field.
+// CacheSize membatasi jumlah pasien yang data terakhirnya disimpan di memori.
+type DedupConfig struct {
+	Enabled   bool     `mapstructure:"enabled"`
+	Fields    []string `mapstructure:"fields"`
+	CacheSize int      `mapstructure:"cachesize"`
+}
+
+type OutboxConfig struct {
+	RelayInterval     time.Duration `mapstructure:"relayinterval"`
+	BatchSize         int           `mapstructure:"batchsize"`
+	MaxAttempts       int           `mapstructure:"maxattempts"`
+	PublishingTimeout time.Duration `mapstructure:"publishingtimeout"`
+}
+
+// PublishConfig mengatur batching publisher. Message dikirim dalam satu batch setelah DelayThreshold,
+// atau saat batch mencapai CountThreshold message atau ByteThreshold byte. Timeout membatasi lama
+// pengiriman satu batch. Nilai 0 memakai default library Pub/Sub.
+// MaxInFlight membatasi jumlah message yang menunggu hasil publish pada bulk publish.
+type PublishConfig struct {
+	DelayThreshold time.Duration `mapstructure:"delaythreshold"`
+	CountThreshold int           `mapstructure:"countthreshold"`
+	ByteThreshold  int           `mapstructure:"bytethreshold"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	MaxInFlight    int           `mapstructure:"maxinflight"`
 }
 
 type CompressionConfig struct {
@@ -76,6 +151,24 @@ type CompressionConfig struct {
 	Algorithm string `mapstructure:"algorithm"`
 }
 
+// RetentionConfig mengatur penghapusan log incoming dan outgoing yang lebih lama dari Incoming/Outgoing,
+// serta outbox yang sudah terkirim lebih lama dari Outbox (0 berarti tidak pernah dihapus). Penghapusan berjalan setiap Interval dengan BatchSize baris per batch.
+// Jika Archive.Enabled, baris yang dihapus lebih dulu ditulis ke file JSONL gzip di Archive.Dir.
+type RetentionConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Interval  time.Duration `mapstructure:"interval"`
+	BatchSize int64         `mapstructure:"batchsize"`
+	Incoming  time.Duration `mapstructure:"incoming"`
+	Outgoing  time.Duration `mapstructure:"outgoing"`
+	Outbox    time.Duration `mapstructure:"outbox"`
+	Archive   ArchiveConfig `mapstructure:"archive"`
+}
+
+type ArchiveConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Dir     string `mapstructure:"dir"`
+}
+
 type APIConfig struct {
 	BaseURL   string        `mapstructure:"baseurl"`
 	Timeout   time.Duration `mapstructure:"timeout"`
@@ -95,16 +188,48 @@ type DatabaseConfig struct {
 }
 
 type CKGConfig struct {
-	UseCache           bool   `mapstructure:"usecache"`
-	TableMasterWilayah string `mapstructure:"tablemasterwilayah"`
-	TableMasterFaskes  string `mapstructure:"tablemasterfaskes"`
-	TableSkrining      string `mapstructure:"tableskrining"`
-	TableStatus        string `mapstructure:"tablestatus"`
-	TableIncoming      string `mapstructure:"tableincoming"`
-	TableOutgoing      string `mapstructure:"tableoutgoing"`
-	MarkerField        string `mapstructure:"markerfield"`
-	MarkerConsume      string `mapstructure:"markerconsume"`
-	MarkerProduce      string `mapstructure:"markerproduce"`
+	UseCache            bool   `mapstructure:"usecache"`
+	TableMasterWilayah  string `mapstructure:"tablemasterwilayah"`
+	TableMasterFaskes   string `mapstructure:"tablemasterfaskes"`
+	TableSkrining       string `mapstructure:"tableskrining"`
+	TableStatus         string `mapstructure:"tablestatus"`
+	TableStatusHistory  string `mapstructure:"tablestatushistory"`
+	TableIncoming       string `mapstructure:"tableincoming"`
+	TableIncomingItem   string `mapstructure:"tableincomingitem"`
+	TableOutgoing       string `mapstructure:"tableoutgoing"`
+	TableOutgoingItem   string `mapstructure:"tableoutgoingitem"`
+	TableOutgoingLatest string `mapstructure:"tableoutgoinglatest"`
+	TableQuarantine     string `mapstructure:"tablequarantine"`
+	TableOutbox         string `mapstructure:"tableoutbox"`
+	TableCheckpoint     string `mapstructure:"tablecheckpoint"`
+	MarkerField         string `mapstructure:"markerfield"`
+	MarkerConsume       string `mapstructure:"markerconsume"`
+	MarkerProduce       string `mapstructure:"markerproduce"`
+	MarkerRetract       string `mapstructure:"markerretract"`
+	MarkerResponse      string `mapstructure:"markerresponse"`
+}
+
+// DeadLetterTopic returns the configured dead-letter topic, or the main topic with the configured suffix
+func (c *Configurations) DeadLetterTopic() string {
+	policy := c.Consumer.DeadLetterPolicy
+	if policy.DeadLetterTopic != "" {
+		return policy.DeadLetterTopic
+	}
+	return c.PubSub.Topic + policy.DeadLetterTopicSuffix
+}
+
+// ReplyTopic mengembalikan topic tujuan message respon consumer
+func (c *Configurations) ReplyTopic() string {
+	reply := c.Consumer.Reply
+	if reply.Topic != "" {
+		return reply.Topic
+	}
+	return c.PubSub.Topic + reply.TopicSuffix
+}
+
+// MessageOrdering mengembalikan true jika publisher mengirim message dengan ordering key
+func (c *Configurations) MessageOrdering() bool {
+	return c.PubSub.MessageOrdering || c.Producer.EnableMessageOrdering
 }
 
 func GetConfig() *Configurations {
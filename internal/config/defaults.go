@@ -12,6 +12,7 @@ func setDefaults() map[string]any {
 		"google.debug":       false,
 
 		// PubSub
+		"pubsub.broker":          "google",
 		"pubsub.topic":           "projects/ckg-tb-staging/topics/CKG-SITB",
 		"pubsub.subscription":    "projects/ckg-tb-staging/subscriptions/CKG-SITB-sub",
 		"pubsub.messageordering": false,
@@ -24,7 +25,19 @@ func setDefaults() map[string]any {
 		"consumer.retrydelay":              "1s",
 		"consumer.flowcontrol.enabled":     true,
 		"consumer.flowcontrol.maxmessages": 1000,
+		"consumer.draintimeout":            "30s",
 		"consumer.flowcontrol.maxbytes":    1000000, // 1M
+		"consumer.flowcontrol.workers":     10,
+		"consumer.flowcontrol.queuesize":   100,
+
+		"consumer.deadletterpolicy.enabled":     false,
+		"consumer.deadletterpolicy.maxdelivery": 5,
+		"consumer.deadletterpolicy.topic":       "",
+		"consumer.deadletterpolicy.topicsuffix": "-deadletter",
+
+		"consumer.reply.enabled":     false,
+		"consumer.reply.topic":       "",
+		"consumer.reply.topicsuffix": "-reply",
 
 		// Producer
 		"producer.enableordering":        false,
@@ -32,6 +45,35 @@ func setDefaults() map[string]any {
 		"producer.compression.enabled":   false,
 		"producer.compression.algorithm": "gzip",
 
+		"producer.publish.delaythreshold": "10ms",
+		"producer.publish.countthreshold": 100,
+		"producer.publish.bytethreshold":  1000000,
+		"producer.publish.timeout":        "60s",
+		"producer.publish.maxinflight":    100,
+
+		"producer.outbox.relayinterval":     "5s",
+		"producer.outbox.batchsize":         100,
+		"producer.outbox.maxattempts":       5,
+		"producer.outbox.publishingtimeout": "5m",
+
+		"producer.dedup.enabled":   true,
+		"producer.dedup.fields":    "",
+		"producer.dedup.cachesize": 100000,
+
+		"producer.watch.enabled":         true,
+		"producer.watch.pollinterval":    "10s",
+		"producer.watch.pollbatchsize":   100,
+		"producer.watch.timestampcolumn": "updated_at",
+		"producer.watch.keycolumn":       "id",
+		"producer.watch.source":          "poll",
+		"producer.watch.slot":            "ckg_pubsub_slot",
+		"producer.watch.publication":     "ckg_pubsub_publication",
+		"producer.watch.serverid":        1001,
+		"producer.watch.preimages":       false,
+		"producer.window.start":          "last",
+		"producer.window.end":            "",
+		"producer.window.limit":          0,
+
 		// API
 		"api.baseurl":   "https://api-dev.dto.kemkes.go.id/fhir-sirs",
 		"api.timeout":   "60s",
@@ -48,15 +90,34 @@ func setDefaults() map[string]any {
 		"db.attributes": "",
 
 		// CKG
-		"ckg.usecache":           false,
-		"ckg.tablemasterwilayah": "master_wilayah",
-		"ckg.tablemasterfaskes":  "master_faskes",
-		"ckg.tableskrining":      "skrining_tb",
-		"ckg.tablestatus":        "pasien_tb",
-		"ckg.tableincoming":      "ckg_pubsub_incoming",
-		"ckg.tableoutgoing":      "ckg_pubsub_outgoing",
-		"ckg.markerfield":        "transactionSource",
-		"ckg.markerconsume":      "STATUS-PASIEN-TB",
-		"ckg.markerproduce":      "SKRINING-CKG-TB",
+		"ckg.usecache":            false,
+		"ckg.tablemasterwilayah":  "master_wilayah",
+		"ckg.tablemasterfaskes":   "master_faskes",
+		"ckg.tableskrining":       "skrining_tb",
+		"ckg.tablestatus":         "pasien_tb",
+		"ckg.tablestatushistory":  "pasien_tb_history",
+		"ckg.tableincoming":       "ckg_pubsub_incoming",
+		"ckg.tableoutgoing":       "ckg_pubsub_outgoing",
+		"ckg.tableoutgoingitem":   "ckg_pubsub_outgoing_item",
+		"ckg.tableoutgoinglatest": "ckg_pubsub_outgoing_latest",
+		"ckg.tableincomingitem":   "ckg_pubsub_incoming_item",
+		"ckg.tablequarantine":     "ckg_pubsub_quarantine",
+		"ckg.tableoutbox":         "ckg_pubsub_outbox",
+		"ckg.tablecheckpoint":     "ckg_pubsub_checkpoint",
+		"ckg.markerfield":         "transactionSource",
+		"ckg.markerconsume":       "STATUS-PASIEN-TB",
+		"ckg.markerproduce":       "SKRINING-CKG-TB",
+		"ckg.markerretract":       "RETRAKSI-SKRINING-CKG-TB",
+		"ckg.markerresponse":      "RESPON-STATUS-PASIEN-TB",
+
+		// Retention
+		"retention.enabled":         false,
+		"retention.interval":        "24h",
+		"retention.batchsize":       500,
+		"retention.incoming":        "720h",
+		"retention.outgoing":        "2160h",
+		"retention.outbox":          "168h",
+		"retention.archive.enabled": false,
+		"retention.archive.dir":     "archive",
 	}
 }
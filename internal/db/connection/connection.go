@@ -16,9 +16,17 @@ type DatabaseConnection interface {
 	GetDriver() string
 	GetName() string
 
+	// filter is MongoDB-style and means the same for every driver: field equality (nil matches NULL),
+	// the operators $gt, $gte, $lt, $lte, $ne, $in and $nin, and $or/$and with a list of filters.
+	// Nested filters may be any map[string]any type and lists any slice type, a single $in value is
+	// a set of one and an empty $in never matches.
+	// sort maps a field to 1 (ascending) or -1 (descending), a larger magnitude sorts
+	// after a smaller one, see dbtypes.SortFields. Find returns []dbtypes.M.
 	Find(ctx context.Context, table string, column []string, filter dbtypes.M, sort map[string]int, limit int64, skip int64) (any, error)
 	FindOne(ctx context.Context, result any, table string, column []string, filter dbtypes.M, sort map[string]int) error
 	InsertOne(ctx context.Context, table string, data any) (any, error)
+	// UpdateOne returns the number of updated rows (MySQL does not count rows whose values did not change)
 	UpdateOne(ctx context.Context, table string, filter dbtypes.M, data any) (int64, error)
 	DeleteOne(ctx context.Context, table string, filter dbtypes.M) (any, error)
+	DeleteMany(ctx context.Context, table string, filter dbtypes.M) (int64, error)
 }
@@ -1,3 +1,82 @@
 package dbtypes
 
+import (
+	"cmp"
+	"reflect"
+	"slices"
+)
+
 type M map[string]any
+
+// ToM converts map-like values (M, map[string]any, bson.M, ...) into M
+func ToM(v any) (M, bool) {
+	switch m := v.(type) {
+	case M:
+		return m, true
+	case map[string]any:
+		return M(m), true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+
+	result := make(M, rv.Len())
+	for _, key := range rv.MapKeys() {
+		result[key.String()] = rv.MapIndex(key).Interface()
+	}
+	return result, true
+}
+
+// ToSlice converts any slice value (except []byte) into []any
+func ToSlice(v any) ([]any, bool) {
+	switch s := v.(type) {
+	case []any:
+		return s, true
+	case []byte:
+		return nil, false
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	result := make([]any, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		result[i] = rv.Index(i).Interface()
+	}
+	return result, true
+}
+
+// SortField is one key of an ORDER BY / sort document
+type SortField struct {
+	Field     string
+	Ascending bool
+}
+
+// SortFields orders a sort map for Find/FindOne. The sign of a value gives the direction
+// (1 ascending, -1 descending) and its magnitude the priority: {"updated_at": 1, "id": 2}
+// sorts by updated_at, then by id. Keys with the same magnitude are ordered by name.
+func SortFields(sort map[string]int) []SortField {
+	fields := make([]SortField, 0, len(sort))
+	for field, order := range sort {
+		fields = append(fields, SortField{Field: field, Ascending: order > 0})
+	}
+
+	slices.SortFunc(fields, func(a, b SortField) int {
+		if c := cmp.Compare(abs(sort[a.Field]), abs(sort[b.Field])); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Field, b.Field)
+	})
+	return fields
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
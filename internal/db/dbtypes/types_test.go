@@ -0,0 +1,59 @@
+package dbtypes
+
+import (
+	"reflect"
+	"testing"
+)
+
+type namedMap map[string]any
+
+func TestToM(t *testing.T) {
+	tests := []struct {
+		name string
+		in   any
+		want M
+		ok   bool
+	}{
+		{"M", M{"a": 1}, M{"a": 1}, true},
+		{"map", map[string]any{"a": 1}, M{"a": 1}, true},
+		{"named map", namedMap{"a": 1}, M{"a": 1}, true},
+		{"typed values", map[string]string{"a": "x"}, M{"a": "x"}, true},
+		{"non string keys", map[int]any{1: "x"}, nil, false},
+		{"scalar", "a", nil, false},
+		{"nil", nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ToM(tt.in)
+			if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ToM(%#v) = %#v, %v, want %#v, %v", tt.in, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestToSlice(t *testing.T) {
+	tests := []struct {
+		name string
+		in   any
+		want []any
+		ok   bool
+	}{
+		{"any", []any{1, "a"}, []any{1, "a"}, true},
+		{"strings", []string{"a", "b"}, []any{"a", "b"}, true},
+		{"maps", []M{{"a": 1}}, []any{M{"a": 1}}, true},
+		{"array", [2]int{1, 2}, []any{1, 2}, true},
+		{"bytes", []byte("ab"), nil, false},
+		{"scalar", "a", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ToSlice(tt.in)
+			if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ToSlice(%#v) = %#v, %v, want %#v, %v", tt.in, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
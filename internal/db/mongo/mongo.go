@@ -7,10 +7,11 @@ import (
 	"pubsub-ckg-tb/internal/config"
 	"pubsub-ckg-tb/internal/db/connection"
 	"pubsub-ckg-tb/internal/db/dbtypes"
-	"reflect"
 	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -91,16 +92,20 @@ func (p *MongoDBConnection) Connect(ctx context.Context) error {
 	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
 		slog.Error("Failed to connect to MongoDB", "error", err)
-		return nil
+		return err
 	}
 
 	// Ping the database to verify connection
 	err = client.Ping(ctx, readpref.Primary())
 	if err != nil {
 		slog.Error("Failed to ping MongoDB", "error", err)
+		// The client is not kept, release its connection pool
+		_ = client.Disconnect(context.Background())
 		return err
 	}
 
+	p.conn = client
+
 	slog.Info("Successfully connected to MongoDB")
 	return nil
 }
@@ -123,38 +128,42 @@ func (m *MongoDBConnection) Ping(ctx context.Context) error {
 	return nil
 }
 
-func (m *MongoDBConnection) Watch(ctx context.Context, table string) *mongo.ChangeStream {
+// Watch opens a change stream on table. When resumeToken is set the stream resumes
+// right after the event the token belongs to, otherwise it starts at startAt (now when zero).
+// The caller owns and closes the stream.
+func (m *MongoDBConnection) Watch(ctx context.Context, table string, resumeToken bson.Raw, startAt time.Time, preImages bool) (*mongo.ChangeStream, error) {
 	collection := m.GetCollection(table)
 
 	// Create change stream options
 	changeStreamOptions := options.ChangeStream()
 	changeStreamOptions.SetFullDocument(options.UpdateLookup)
+	if preImages {
+		// Requires MongoDB 6.0+ with changeStreamPreAndPostImages enabled on the collection
+		changeStreamOptions.SetFullDocumentBeforeChange(options.WhenAvailable)
+	}
+	if len(resumeToken) > 0 {
+		changeStreamOptions.SetResumeAfter(resumeToken)
+	} else if !startAt.IsZero() {
+		changeStreamOptions.SetStartAtOperationTime(&primitive.Timestamp{T: uint32(startAt.Unix())})
+	}
 
 	// Create change stream
 	changeStream, err := collection.Watch(ctx, []bson.M{}, changeStreamOptions)
 	if err != nil {
 		slog.Error("Gagal membuat change stream", "error", err, "collection", table)
-		return nil
+		return nil, err
 	}
-	defer changeStream.Close(ctx)
 
-	return changeStream
+	return changeStream, nil
 }
 
-func (m *MongoDBConnection) RestartWatch(ctx context.Context, table string, changeStream *mongo.ChangeStream) (*mongo.ChangeStream, error) {
-	changeStream.Close(ctx)
-
-	collection := m.GetCollection(table)
-
-	// Create change stream options
-	changeStreamOptions := options.ChangeStream()
-	changeStreamOptions.SetFullDocument(options.UpdateLookup)
-
-	changeStream, err := collection.Watch(ctx, []bson.M{}, changeStreamOptions)
-	if err != nil {
-		slog.Error("Gagal membuat ulang change stream", "error", err)
+// RestartWatch closes changeStream and opens a new one from resumeToken
+func (m *MongoDBConnection) RestartWatch(ctx context.Context, table string, changeStream *mongo.ChangeStream, resumeToken bson.Raw, preImages bool) (*mongo.ChangeStream, error) {
+	if changeStream != nil {
+		changeStream.Close(ctx)
 	}
-	return changeStream, err
+
+	return m.Watch(ctx, table, resumeToken, time.Time{}, preImages)
 }
 
 func (m *MongoDBConnection) Find(ctx context.Context, table string, column []string, filter dbtypes.M, sort map[string]int, limit int64, skip int64) (any, error) {
@@ -179,15 +188,7 @@ func (m *MongoDBConnection) Find(ctx context.Context, table string, column []str
 	}
 
 	if len(sort) > 0 {
-		sortBson := bson.M{}
-		for field, order := range sort {
-			if order == 1 {
-				sortBson[field] = 1
-			} else {
-				sortBson[field] = -1
-			}
-		}
-		findOptions.SetSort(sortBson)
+		findOptions.SetSort(sortDocument(sort))
 	}
 
 	if limit > 0 {
@@ -206,13 +207,31 @@ func (m *MongoDBConnection) Find(ctx context.Context, table string, column []str
 	}
 	defer cursor.Close(ctx)
 
-	var results []bson.M
-	if err = cursor.All(ctx, &results); err != nil {
+	var docs []bson.M
+	if err = cursor.All(ctx, &docs); err != nil {
 		return nil, err
 	}
+
+	results := make([]dbtypes.M, 0, len(docs))
+	for _, doc := range docs {
+		results = append(results, dbtypes.M(doc))
+	}
 	return results, nil
 }
 
+// sortDocument converts a sort map into an ordered sort document, see dbtypes.SortFields
+func sortDocument(sort map[string]int) bson.D {
+	doc := bson.D{}
+	for _, field := range dbtypes.SortFields(sort) {
+		order := -1
+		if field.Ascending {
+			order = 1
+		}
+		doc = append(doc, bson.E{Key: field.Field, Value: order})
+	}
+	return doc
+}
+
 func (m *MongoDBConnection) FindOne(ctx context.Context, result any, table string, column []string, filter dbtypes.M, sort map[string]int) error {
 	collection := m.GetCollection(table)
 	if collection == nil {
@@ -235,15 +254,7 @@ func (m *MongoDBConnection) FindOne(ctx context.Context, result any, table strin
 	}
 
 	if len(sort) > 0 {
-		sortBson := bson.M{}
-		for field, order := range sort {
-			if order == 1 {
-				sortBson[field] = 1
-			} else {
-				sortBson[field] = -1
-			}
-		}
-		findOptions.SetSort(sortBson)
+		findOptions.SetSort(sortDocument(sort))
 	}
 
 	mfilter := bson.M{}
@@ -300,6 +311,22 @@ func (m *MongoDBConnection) DeleteOne(ctx context.Context, table string, filter
 	return result, nil
 }
 
+// DeleteMany deletes every document matching filter and returns the number of deleted documents
+func (m *MongoDBConnection) DeleteMany(ctx context.Context, table string, filter dbtypes.M) (int64, error) {
+	collection := m.GetCollection(table)
+	if collection == nil {
+		return 0, fmt.Errorf("collection %s not found", table)
+	}
+
+	mfilter := bson.M{}
+	copyToBsonMap(filter, &mfilter)
+	result, err := collection.DeleteMany(ctx, mfilter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
 func (m *MongoDBConnection) GetCollection(collectionName string) *mongo.Collection {
 	if collection, ok := m.collections[collectionName]; ok {
 		return collection
@@ -310,26 +337,24 @@ func (m *MongoDBConnection) GetCollection(collectionName string) *mongo.Collecti
 
 func copyToBsonMap(src dbtypes.M, dst *bson.M) any {
 	for k, v := range src {
-		vType := reflect.TypeOf(v)
-		switch vType.Kind() {
-		case reflect.Map:
-			m := bson.M{}
-			copyToBsonMap(v.(dbtypes.M), &m)
-			(*dst)[k] = m
-		case reflect.Slice:
-			arr := v.([]any)
-			for i, item := range arr {
-				iType := reflect.TypeOf(item)
-				if iType.Kind() == reflect.Map {
-					m := bson.M{}
-					copyToBsonMap(item.(dbtypes.M), &m)
-					arr[i] = m
+		if m, ok := dbtypes.ToM(v); ok {
+			mb := bson.M{}
+			copyToBsonMap(m, &mb)
+			(*dst)[k] = mb
+		} else if items, ok := dbtypes.ToSlice(v); ok {
+			// Copy into a new slice, the filter of the caller must not be modified
+			arr := make([]any, len(items))
+			for i, item := range items {
+				if m, ok := dbtypes.ToM(item); ok {
+					mb := bson.M{}
+					copyToBsonMap(m, &mb)
+					arr[i] = mb
 				} else {
 					arr[i] = item
 				}
 			}
 			(*dst)[k] = arr
-		default:
+		} else {
 			(*dst)[k] = v
 		}
 	}
@@ -0,0 +1,43 @@
+package mongo
+
+import (
+	"pubsub-ckg-tb/internal/db/dbtypes"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCopyToBsonMap(t *testing.T) {
+	or := []any{
+		map[string]any{"pasien_ckg_id": "ckg-1"},
+		dbtypes.M{"pasien_nik": "3201"},
+	}
+	filter := dbtypes.M{
+		"$or":        or,
+		"status":     map[string]any{"$in": []string{"pending", "publishing"}},
+		"updated_at": bson.M{"$lt": "2025-03-01T00:00:00Z"},
+		"attempts":   3,
+	}
+
+	got := bson.M{}
+	copyToBsonMap(filter, &got)
+
+	want := bson.M{
+		"$or": []any{
+			bson.M{"pasien_ckg_id": "ckg-1"},
+			bson.M{"pasien_nik": "3201"},
+		},
+		"status":     bson.M{"$in": []any{"pending", "publishing"}},
+		"updated_at": bson.M{"$lt": "2025-03-01T00:00:00Z"},
+		"attempts":   3,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("copyToBsonMap = %#v, want %#v", got, want)
+	}
+
+	// The filter of the caller is left as it was
+	if _, ok := or[0].(map[string]any); !ok {
+		t.Fatalf("copyToBsonMap modified the caller's slice: %#v", or[0])
+	}
+}
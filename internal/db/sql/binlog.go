@@ -0,0 +1,353 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"pubsub-ckg-tb/internal/db/dbtypes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// BinlogPosition is a position in the MySQL binary log
+type BinlogPosition struct {
+	File string `json:"file"`
+	Pos  uint32 `json:"pos"`
+}
+
+func (p BinlogPosition) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Pos)
+}
+
+// BinlogEvent is what BinlogReader.Next returns: row changes of the watched tables or the end of a transaction
+type BinlogEvent struct {
+	Position BinlogPosition // position right after this event
+	Commit   bool           // end of a transaction, a safe position to resume from
+	Changes  []ChangeEvent  // row changes, LSN is not used for MySQL
+}
+
+// BinlogReader streams row events from MySQL as a replica would, using go-mysql's BinlogSyncer.
+// It requires binlog_format=ROW, binlog_row_image=FULL, binlog_row_metadata=FULL and a user with
+// the REPLICATION SLAVE and REPLICATION CLIENT privileges.
+//
+// Column names, signedness and ENUM/SET labels are taken from the table map event that precedes
+// every rows event, so rows are decoded with the table definition they were written with, also
+// when resuming from a checkpoint written before an ALTER TABLE.
+type BinlogReader struct {
+	syncer   *replication.BinlogSyncer
+	streamer *replication.BinlogStreamer
+	schema   string
+	tables   map[string]bool
+	position BinlogPosition
+}
+
+const (
+	binlogReadTimeout = 90 * time.Second
+	binlogHeartbeat   = 30 * time.Second
+)
+
+// CurrentBinlogPosition returns the position the server is currently writing to
+func (m *SQLConnection) CurrentBinlogPosition(ctx context.Context) (BinlogPosition, error) {
+	rows, err := m.conn.QueryContext(ctx, "SHOW MASTER STATUS")
+	if err != nil {
+		// MySQL 8.4 removed SHOW MASTER STATUS
+		rows, err = m.conn.QueryContext(ctx, "SHOW BINARY LOG STATUS")
+		if err != nil {
+			return BinlogPosition{}, fmt.Errorf("failed to read binlog status: %w", err)
+		}
+	}
+	defer rows.Close()
+
+	results, err := scanRows(rows)
+	if err != nil {
+		return BinlogPosition{}, err
+	}
+	if len(results) == 0 {
+		return BinlogPosition{}, fmt.Errorf("binary logging is not enabled")
+	}
+
+	pos, err := strconv.ParseUint(fmt.Sprint(results[0]["Position"]), 10, 32)
+	if err != nil {
+		return BinlogPosition{}, fmt.Errorf("invalid binlog position: %w", err)
+	}
+
+	return BinlogPosition{File: fmt.Sprint(results[0]["File"]), Pos: uint32(pos)}, nil
+}
+
+// OpenBinlog connects as a replica with serverID and streams the binlog from position.
+// Only row changes of the given tables in the configured database are decoded.
+func (m *SQLConnection) OpenBinlog(ctx context.Context, serverID uint32, position BinlogPosition, tables ...string) (*BinlogReader, error) {
+	if m.config.Driver != "mysql" {
+		return nil, fmt.Errorf("binlog replication is only supported for MySQL")
+	}
+
+	syncer := replication.NewBinlogSyncer(replication.BinlogSyncerConfig{
+		ServerID:                serverID,
+		Flavor:                  mysql.MySQLFlavor,
+		Host:                    m.config.Host,
+		Port:                    uint16(m.config.Port),
+		User:                    m.config.Username,
+		Password:                m.config.Password,
+		HeartbeatPeriod:         binlogHeartbeat,
+		ReadTimeout:             binlogReadTimeout,
+		TimestampStringLocation: time.UTC,
+		UseDecimal:              true,
+		VerifyChecksum:          true,
+		// The caller reopens the stream from its own checkpoint
+		DisableRetrySync: true,
+		Logger:           slog.Default(),
+	})
+
+	streamer, err := syncer.StartSync(mysql.Position{Name: position.File, Pos: position.Pos})
+	if err != nil {
+		syncer.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to start binlog stream: %w", err)
+	}
+
+	r := &BinlogReader{
+		syncer:   syncer,
+		streamer: streamer,
+		schema:   m.config.Database,
+		tables:   make(map[string]bool),
+		position: position,
+	}
+	for _, table := range tables {
+		r.tables[table] = true
+	}
+
+	slog.Info("Binlog stream opened", "position", position.String(), "server_id", serverID)
+	return r, nil
+}
+
+// Position returns the position after the last event read
+func (r *BinlogReader) Position() BinlogPosition {
+	return r.position
+}
+
+func (r *BinlogReader) Close() error {
+	r.syncer.Close()
+	return nil
+}
+
+// Next blocks until the next transaction end or row change of a watched table
+func (r *BinlogReader) Next(ctx context.Context) (*BinlogEvent, error) {
+	for {
+		ev, err := r.streamer.GetEvent(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("failed to read binlog: %w", err)
+		}
+
+		event, err := r.handleEvent(ev)
+		if err != nil {
+			return nil, err
+		}
+		if event != nil {
+			return event, nil
+		}
+	}
+}
+
+func (r *BinlogReader) handleEvent(ev *replication.BinlogEvent) (*BinlogEvent, error) {
+	// Rotate events sent at the start of the stream have log_pos 0 and must not move the position
+	if ev.Header.LogPos > 0 {
+		r.position.Pos = ev.Header.LogPos
+	}
+
+	switch e := ev.Event.(type) {
+	case *replication.RotateEvent:
+		r.position = BinlogPosition{
+			File: string(e.NextLogName),
+			Pos:  uint32(e.Position),
+		}
+		return nil, nil
+	case *replication.XIDEvent:
+		return &BinlogEvent{Position: r.position, Commit: true}, nil
+	case *replication.QueryEvent:
+		// BEGIN opens a transaction, COMMIT of non-transactional tables and DDL end one
+		if strings.EqualFold(string(e.Query), "BEGIN") {
+			return nil, nil
+		}
+		return &BinlogEvent{Position: r.position, Commit: true}, nil
+	case *replication.RowsEvent:
+		if e.Table == nil || string(e.Table.Schema) != r.schema || !r.tables[string(e.Table.Table)] {
+			return nil, nil
+		}
+		changes, err := binlogRowChanges(e)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode rows event at %s: %w", r.position.String(), err)
+		}
+		if len(changes) == 0 {
+			return nil, nil
+		}
+		return &BinlogEvent{Position: r.position, Changes: changes}, nil
+	case *replication.TransactionPayloadEvent:
+		return nil, fmt.Errorf("compressed binlog transactions are not supported, disable binlog_transaction_compression")
+	default:
+		// GTID, previous GTIDs, rows query, heartbeat and others carry nothing we need
+		return nil, nil
+	}
+}
+
+// binlogRowChanges converts a decoded rows event into change events keyed by column name.
+// Updates carry before and after images in turn, only the after image is kept.
+func binlogRowChanges(e *replication.RowsEvent) ([]ChangeEvent, error) {
+	table := e.Table
+	columns, err := newBinlogColumns(table)
+	if err != nil {
+		return nil, err
+	}
+
+	operation := ""
+	step := 1
+	switch e.Type() {
+	case replication.EnumRowsEventTypeInsert:
+		operation = "insert"
+	case replication.EnumRowsEventTypeUpdate:
+		operation = "update"
+		step = 2
+	case replication.EnumRowsEventTypeDelete:
+		operation = "delete"
+	default:
+		return nil, fmt.Errorf("unsupported rows event type %s", e.Type())
+	}
+
+	changes := []ChangeEvent{}
+	for i := step - 1; i < len(e.Rows); i += step {
+		row := e.Rows[i]
+		if len(row) != len(columns) {
+			return nil, fmt.Errorf("rows event has %d columns, table map has %d", len(row), len(columns))
+		}
+
+		data := dbtypes.M{}
+		for j, value := range row {
+			data[columns[j].name] = columns[j].convert(value)
+		}
+
+		changes = append(changes, ChangeEvent{
+			Operation: operation,
+			Schema:    string(table.Schema),
+			Table:     string(table.Table),
+			Data:      data,
+		})
+	}
+
+	return changes, nil
+}
+
+// binlogColumn describes one column of a table map event
+type binlogColumn struct {
+	name       string
+	columnType byte
+	unsigned   bool
+	enum       bool
+	set        bool
+	values     []string // ENUM and SET labels
+}
+
+func newBinlogColumns(table *replication.TableMapEvent) ([]binlogColumn, error) {
+	names := table.ColumnNameString()
+	if len(names) != int(table.ColumnCount) {
+		return nil, fmt.Errorf("table map of %s.%s has no column names, set binlog_row_metadata=FULL", table.Schema, table.Table)
+	}
+
+	unsigned := table.UnsignedMap()
+	enums := table.EnumStrValueString()
+	sets := table.SetStrValueString()
+
+	columns := make([]binlogColumn, len(names))
+	for i, name := range names {
+		column := binlogColumn{
+			name:       name,
+			columnType: table.ColumnType[i],
+			unsigned:   unsigned[i],
+		}
+
+		// Labels are listed per ENUM/SET column in column order
+		switch {
+		case table.IsEnumColumn(i):
+			column.enum = true
+			if len(enums) > 0 {
+				column.values, enums = enums[0], enums[1:]
+			}
+		case table.IsSetColumn(i):
+			column.set = true
+			if len(sets) > 0 {
+				column.values, sets = sets[0], sets[1:]
+			}
+		}
+
+		columns[i] = column
+	}
+
+	return columns, nil
+}
+
+// convert turns a value decoded by go-mysql into what the rest of the application expects:
+// integers as int64 (uint64 above MaxInt64), decimals and text as string, ENUM/SET as labels
+func (c binlogColumn) convert(value any) any {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case int8:
+		if c.unsigned {
+			return int64(uint8(v))
+		}
+		return int64(v)
+	case int16:
+		if c.unsigned {
+			return int64(uint16(v))
+		}
+		return int64(v)
+	case int32:
+		if c.unsigned {
+			if c.columnType == mysql.MYSQL_TYPE_INT24 {
+				return int64(uint32(v) & 0xffffff)
+			}
+			return int64(uint32(v))
+		}
+		return int64(v)
+	case int64:
+		switch {
+		case c.enum:
+			if v > 0 && int(v) <= len(c.values) {
+				return c.values[v-1]
+			}
+			return ""
+		case c.set:
+			labels := []string{}
+			for i, label := range c.values {
+				if v&(1<<i) != 0 {
+					labels = append(labels, label)
+				}
+			}
+			return strings.Join(labels, ",")
+		case c.unsigned && v < 0:
+			return uint64(v)
+		}
+		return v
+	case int:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case string:
+		// go-mysql shares the event buffer with strings it decodes
+		return strings.Clone(v)
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		// decimal.Decimal
+		return v.String()
+	default:
+		return v
+	}
+}
@@ -0,0 +1,384 @@
+package sql
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// The events below are built byte for byte in the layout MySQL 8 writes with binlog_format=ROW,
+// binlog_row_image=FULL and binlog_row_metadata=FULL, then decoded by go-mysql's parser the same
+// way BinlogSyncer does it.
+
+type testColumn struct {
+	name       string
+	columnType byte
+	meta       []byte
+	unsigned   bool
+	labels     []string // ENUM labels
+}
+
+var (
+	colID      = testColumn{name: "id", columnType: mysql.MYSQL_TYPE_LONGLONG, unsigned: true}
+	colNIK     = testColumn{name: "pasien_nik", columnType: mysql.MYSQL_TYPE_VARCHAR, meta: []byte{128, 0}}
+	colUmur    = testColumn{name: "umur", columnType: mysql.MYSQL_TYPE_TINY, unsigned: true}
+	colStatus  = testColumn{name: "status", columnType: mysql.MYSQL_TYPE_STRING, meta: []byte{mysql.MYSQL_TYPE_ENUM, 1}, labels: []string{"draft", "final"}}
+	colBerat   = testColumn{name: "berat", columnType: mysql.MYSQL_TYPE_NEWDECIMAL, meta: []byte{5, 2}}
+	colUpdated = testColumn{name: "updated_at", columnType: mysql.MYSQL_TYPE_DATETIME2, meta: []byte{0}}
+	colCatatan = testColumn{name: "catatan", columnType: mysql.MYSQL_TYPE_BLOB, meta: []byte{2}}
+)
+
+func binlogEvent(eventType replication.EventType, logPos uint32, body []byte) []byte {
+	header := make([]byte, replication.EventHeaderSize)
+	header[4] = byte(eventType)
+	binary.LittleEndian.PutUint32(header[5:], 1)
+	binary.LittleEndian.PutUint32(header[9:], uint32(replication.EventHeaderSize+len(body)))
+	binary.LittleEndian.PutUint32(header[13:], logPos)
+	return append(header, body...)
+}
+
+func formatDescriptionEvent() []byte {
+	body := binary.LittleEndian.AppendUint16(nil, 4)
+	version := make([]byte, 50)
+	copy(version, "8.0.36")
+	body = append(body, version...)
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = append(body, replication.EventHeaderSize)
+
+	postHeader := make([]byte, 40)
+	postHeader[replication.TABLE_MAP_EVENT-1] = 8
+	postHeader[replication.WRITE_ROWS_EVENTv2-1] = 10
+	postHeader[replication.UPDATE_ROWS_EVENTv2-1] = 10
+	postHeader[replication.DELETE_ROWS_EVENTv2-1] = 10
+	body = append(body, postHeader...)
+
+	// Checksum algorithm OFF followed by the checksum field
+	body = append(body, replication.BINLOG_CHECKSUM_ALG_OFF, 0, 0, 0, 0)
+	return binlogEvent(replication.FORMAT_DESCRIPTION_EVENT, 0, body)
+}
+
+func lenencString(b []byte, s string) []byte {
+	return append(append(b, byte(len(s))), s...)
+}
+
+func tableMapEvent(tableID uint64, schema string, table string, columns []testColumn, withNames bool) []byte {
+	body := binary.LittleEndian.AppendUint64(nil, tableID)[:6]
+	body = append(body, 0, 0)
+	body = append(lenencString(body, schema), 0)
+	body = append(lenencString(body, table), 0)
+	body = append(body, byte(len(columns)))
+
+	meta := []byte{}
+	for _, column := range columns {
+		body = append(body, column.columnType)
+		meta = append(meta, column.meta...)
+	}
+	body = append(append(body, byte(len(meta))), meta...)
+	body = append(body, make([]byte, (len(columns)+7)/8)...) // null bitmap
+
+	// Optional metadata: signedness of numeric columns (most significant bit first)
+	signedness := []byte{}
+	bit := 0
+	for _, column := range columns {
+		switch column.columnType {
+		case mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_TINY, mysql.MYSQL_TYPE_NEWDECIMAL:
+			if bit%8 == 0 {
+				signedness = append(signedness, 0)
+			}
+			if column.unsigned {
+				signedness[bit/8] |= 0x80 >> (bit % 8)
+			}
+			bit++
+		}
+	}
+	body = append(body, replication.TABLE_MAP_OPT_META_SIGNEDNESS, byte(len(signedness)))
+	body = append(body, signedness...)
+
+	if withNames {
+		names := []byte{}
+		for _, column := range columns {
+			names = lenencString(names, column.name)
+		}
+		body = append(body, replication.TABLE_MAP_OPT_META_COLUMN_NAME, byte(len(names)))
+		body = append(body, names...)
+	}
+
+	enums := []byte{}
+	for _, column := range columns {
+		if column.labels == nil {
+			continue
+		}
+		enums = append(enums, byte(len(column.labels)))
+		for _, label := range column.labels {
+			enums = lenencString(enums, label)
+		}
+	}
+	if len(enums) > 0 {
+		body = append(body, replication.TABLE_MAP_OPT_META_ENUM_STR_VALUE, byte(len(enums)))
+		body = append(body, enums...)
+	}
+
+	return binlogEvent(replication.TABLE_MAP_EVENT, 0, body)
+}
+
+// rowsEvent writes rows with every column present, a nil value is written as NULL
+func rowsEvent(eventType replication.EventType, tableID uint64, columns []testColumn, rows ...[]any) []byte {
+	body := binary.LittleEndian.AppendUint64(nil, tableID)[:6]
+	body = append(body, 0, 0)
+	body = binary.LittleEndian.AppendUint16(body, 2) // no extra data
+	body = append(body, byte(len(columns)))
+
+	present := make([]byte, (len(columns)+7)/8)
+	for i := range columns {
+		present[i/8] |= 1 << (i % 8)
+	}
+	body = append(body, present...)
+	if eventType == replication.UPDATE_ROWS_EVENTv2 {
+		body = append(body, present...)
+	}
+
+	for _, row := range rows {
+		nulls := make([]byte, (len(columns)+7)/8)
+		values := []byte{}
+		for i, value := range row {
+			if value == nil {
+				nulls[i/8] |= 1 << (i % 8)
+				continue
+			}
+			values = append(values, value.([]byte)...)
+		}
+		body = append(append(body, nulls...), values...)
+	}
+
+	return binlogEvent(eventType, 0, body)
+}
+
+func longlong(v uint64) []byte { return binary.LittleEndian.AppendUint64(nil, v) }
+
+func varchar(s string) []byte { return append([]byte{byte(len(s))}, s...) }
+
+func blob(s string) []byte {
+	return append(binary.LittleEndian.AppendUint16(nil, uint16(len(s))), s...)
+}
+
+// decimal52 encodes a positive DECIMAL(5,2): 3 integer digits in 2 bytes, 2 fraction digits in 1 byte
+func decimal52(integer int, fraction int) []byte {
+	return []byte{byte(integer>>8) | 0x80, byte(integer), byte(fraction)}
+}
+
+// datetime encodes DATETIME(0) as written by MySQL 5.6.4 and later
+func datetime(year, month, day, hour, minute, second int64) []byte {
+	ymd := (year*13+month)<<5 | day
+	hms := hour<<12 | minute<<6 | second
+	packed := uint64(ymd<<17|hms) + 0x8000000000
+	return binary.BigEndian.AppendUint64(nil, packed)[3:]
+}
+
+func parseBinlogEvents(t *testing.T, events ...[]byte) []*replication.BinlogEvent {
+	t.Helper()
+
+	parser := replication.NewBinlogParser()
+	parser.SetFlavor(mysql.MySQLFlavor)
+	parser.SetUseDecimal(true)
+
+	parsed := []*replication.BinlogEvent{}
+	for _, data := range append([][]byte{formatDescriptionEvent()}, events...) {
+		event, err := parser.Parse(data)
+		if err != nil {
+			t.Fatalf("parse binlog event: %v", err)
+		}
+		parsed = append(parsed, event)
+	}
+	return parsed[1:]
+}
+
+func rowsOf(t *testing.T, events []*replication.BinlogEvent) []ChangeEvent {
+	t.Helper()
+
+	changes := []ChangeEvent{}
+	for _, event := range events {
+		rows, ok := event.Event.(*replication.RowsEvent)
+		if !ok {
+			continue
+		}
+		decoded, err := binlogRowChanges(rows)
+		if err != nil {
+			t.Fatalf("binlogRowChanges: %v", err)
+		}
+		changes = append(changes, decoded...)
+	}
+	return changes
+}
+
+func TestBinlogRowChangesInsert(t *testing.T) {
+	columns := []testColumn{colID, colNIK, colUmur, colStatus, colBerat, colUpdated}
+	events := parseBinlogEvents(t,
+		tableMapEvent(70, "ckg", "skrining", columns, true),
+		rowsEvent(replication.WRITE_ROWS_EVENTv2, 70, columns,
+			[]any{longlong(1 << 63), varchar("3171234567890001"), []byte{200}, []byte{2}, decimal52(65, 50), datetime(2024, 5, 17, 8, 30, 0)},
+			[]any{longlong(2), nil, []byte{7}, []byte{1}, decimal52(3, 5), datetime(2024, 5, 18, 23, 59, 59)},
+		),
+	)
+
+	changes := rowsOf(t, events)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(changes))
+	}
+
+	first := changes[0]
+	if first.Operation != "insert" || first.Schema != "ckg" || first.Table != "skrining" {
+		t.Fatalf("unexpected change header: %+v", first)
+	}
+	expected := map[string]any{
+		"id":         uint64(1 << 63),
+		"pasien_nik": "3171234567890001",
+		"umur":       int64(200),
+		"status":     "final",
+		"berat":      "65.5",
+		"updated_at": "2024-05-17 08:30:00",
+	}
+	for key, value := range expected {
+		if first.Data[key] != value {
+			t.Errorf("%s: expected %#v, got %#v", key, value, first.Data[key])
+		}
+	}
+
+	second := changes[1]
+	if v, ok := second.Data["pasien_nik"]; !ok || v != nil {
+		t.Errorf("pasien_nik: expected NULL, got %#v", v)
+	}
+	if second.Data["id"] != int64(2) || second.Data["status"] != "draft" || second.Data["berat"] != "3.05" {
+		t.Errorf("unexpected second row: %#v", second.Data)
+	}
+}
+
+func TestBinlogRowChangesUpdateKeepsAfterImage(t *testing.T) {
+	columns := []testColumn{colID, colNIK, colUpdated}
+	events := parseBinlogEvents(t,
+		tableMapEvent(70, "ckg", "skrining", columns, true),
+		rowsEvent(replication.UPDATE_ROWS_EVENTv2, 70, columns,
+			[]any{longlong(5), varchar("lama"), datetime(2024, 1, 1, 0, 0, 0)},
+			[]any{longlong(5), varchar("baru"), datetime(2024, 1, 2, 0, 0, 0)},
+		),
+	)
+
+	changes := rowsOf(t, events)
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(changes))
+	}
+	if changes[0].Operation != "update" || changes[0].Data["pasien_nik"] != "baru" || changes[0].Data["updated_at"] != "2024-01-02 00:00:00" {
+		t.Fatalf("unexpected update: %+v", changes[0])
+	}
+}
+
+func TestBinlogRowChangesDelete(t *testing.T) {
+	columns := []testColumn{colID, colNIK}
+	events := parseBinlogEvents(t,
+		tableMapEvent(70, "ckg", "skrining", columns, true),
+		rowsEvent(replication.DELETE_ROWS_EVENTv2, 70, columns, []any{longlong(9), varchar("3171")}),
+	)
+
+	changes := rowsOf(t, events)
+	if len(changes) != 1 || changes[0].Operation != "delete" || changes[0].Data["id"] != int64(9) || changes[0].Data["pasien_nik"] != "3171" {
+		t.Fatalf("unexpected delete: %+v", changes)
+	}
+}
+
+// A checkpoint written before ALTER TABLE ... ADD COLUMN replays rows of the old definition
+// followed by rows of the new one, each must be decoded with its own table map
+func TestBinlogRowChangesFollowTableMapAcrossAlter(t *testing.T) {
+	before := []testColumn{colID, colNIK}
+	after := []testColumn{colID, colCatatan, colNIK}
+
+	events := parseBinlogEvents(t,
+		tableMapEvent(70, "ckg", "skrining", before, true),
+		rowsEvent(replication.WRITE_ROWS_EVENTv2, 70, before, []any{longlong(1), varchar("sebelum")}),
+		tableMapEvent(71, "ckg", "skrining", after, true),
+		rowsEvent(replication.WRITE_ROWS_EVENTv2, 71, after, []any{longlong(2), blob("batuk"), varchar("sesudah")}),
+	)
+
+	changes := rowsOf(t, events)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(changes))
+	}
+	if changes[0].Data["pasien_nik"] != "sebelum" || len(changes[0].Data) != 2 {
+		t.Errorf("unexpected row before alter: %#v", changes[0].Data)
+	}
+	if changes[1].Data["pasien_nik"] != "sesudah" || changes[1].Data["catatan"] != "batuk" {
+		t.Errorf("unexpected row after alter: %#v", changes[1].Data)
+	}
+}
+
+func TestBinlogRowChangesRequireColumnNames(t *testing.T) {
+	columns := []testColumn{colID}
+	events := parseBinlogEvents(t,
+		tableMapEvent(70, "ckg", "skrining", columns, false),
+		rowsEvent(replication.WRITE_ROWS_EVENTv2, 70, columns, []any{longlong(1)}),
+	)
+
+	_, err := binlogRowChanges(events[1].Event.(*replication.RowsEvent))
+	if err == nil || !strings.Contains(err.Error(), "binlog_row_metadata=FULL") {
+		t.Fatalf("expected binlog_row_metadata error, got %v", err)
+	}
+}
+
+func TestBinlogReaderHandleEvent(t *testing.T) {
+	columns := []testColumn{colID}
+	events := parseBinlogEvents(t,
+		tableMapEvent(70, "ckg", "skrining", columns, true),
+		rowsEvent(replication.WRITE_ROWS_EVENTv2, 70, columns, []any{longlong(1)}),
+		tableMapEvent(72, "ckg", "lainnya", columns, true),
+		rowsEvent(replication.WRITE_ROWS_EVENTv2, 72, columns, []any{longlong(2)}),
+	)
+
+	r := &BinlogReader{
+		schema:   "ckg",
+		tables:   map[string]bool{"skrining": true},
+		position: BinlogPosition{File: "binlog.000001", Pos: 4},
+	}
+
+	rotate := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.ROTATE_EVENT},
+		Event:  &replication.RotateEvent{NextLogName: []byte("binlog.000002"), Position: 4},
+	}
+	if event, err := r.handleEvent(rotate); err != nil || event != nil {
+		t.Fatalf("rotate: unexpected %v, %v", event, err)
+	}
+	if r.Position() != (BinlogPosition{File: "binlog.000002", Pos: 4}) {
+		t.Fatalf("rotate did not move the position: %s", r.Position())
+	}
+
+	events[1].Header.LogPos = 300
+	event, err := r.handleEvent(events[1])
+	if err != nil || event == nil || len(event.Changes) != 1 || event.Commit {
+		t.Fatalf("watched table: unexpected %+v, %v", event, err)
+	}
+	if event.Position != (BinlogPosition{File: "binlog.000002", Pos: 300}) {
+		t.Fatalf("unexpected position %s", event.Position)
+	}
+
+	events[3].Header.LogPos = 400
+	if event, err := r.handleEvent(events[3]); err != nil || event != nil {
+		t.Fatalf("other table: unexpected %+v, %v", event, err)
+	}
+
+	begin := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.QUERY_EVENT, LogPos: 450},
+		Event:  &replication.QueryEvent{Query: []byte("BEGIN")},
+	}
+	if event, err := r.handleEvent(begin); err != nil || event != nil {
+		t.Fatalf("begin: unexpected %+v, %v", event, err)
+	}
+
+	xid := &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.XID_EVENT, LogPos: 500},
+		Event:  &replication.XIDEvent{},
+	}
+	event, err = r.handleEvent(xid)
+	if err != nil || event == nil || !event.Commit || event.Position.Pos != 500 {
+		t.Fatalf("xid: unexpected %+v, %v", event, err)
+	}
+}
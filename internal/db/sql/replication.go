@@ -0,0 +1,415 @@
+package sql
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"pubsub-ckg-tb/internal/db/dbtypes"
+	"strconv"
+	"strings"
+)
+
+// ChangeEvent is a row change decoded from a pgoutput logical replication slot
+type ChangeEvent struct {
+	LSN       string    // LSN of the change record, e.g. "0/16B3748"
+	Operation string    // insert, update or delete
+	Schema    string    // schema of the changed table
+	Table     string    // name of the changed table
+	Data      dbtypes.M // new row for insert/update, old row (replica identity) for delete
+}
+
+// ReplicationTable is the published table as resolved by PostgreSQL
+type ReplicationTable struct {
+	Schema string
+	Name   string
+	// ReplicaIdentity is pg_class.relreplident: d (primary key), n (nothing), f (full) or i (index).
+	// Deletes only carry the full old row with f, otherwise just the replica identity columns.
+	ReplicaIdentity string
+}
+
+// Matches reports whether event is a change of this table
+func (t ReplicationTable) Matches(event ChangeEvent) bool {
+	return event.Schema == t.Schema && event.Table == t.Name
+}
+
+// FullIdentity reports whether deletes carry every column of the old row
+func (t ReplicationTable) FullIdentity() bool {
+	return t.ReplicaIdentity == "f"
+}
+
+// EnsureReplicationSlot creates the publication for table and the pgoutput logical
+// replication slot when they do not exist yet. It requires wal_level=logical.
+// The returned table carries the schema the name resolved to and its replica identity.
+func (m *SQLConnection) EnsureReplicationSlot(ctx context.Context, slot string, publication string, table string) (ReplicationTable, error) {
+	resolved := ReplicationTable{}
+	if m.config.Driver == "mysql" {
+		return resolved, fmt.Errorf("logical replication is only supported for PostgreSQL")
+	}
+
+	// regclass resolves an unqualified name through search_path like CREATE PUBLICATION does
+	err := m.conn.QueryRowContext(ctx,
+		"SELECT n.nspname, c.relname, c.relreplident::text FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE c.oid = $1::regclass",
+		quoteIdentifier(table)).Scan(&resolved.Schema, &resolved.Name, &resolved.ReplicaIdentity)
+	if err != nil {
+		return resolved, fmt.Errorf("failed to resolve table %s: %w", table, err)
+	}
+
+	var exists bool
+	err = m.conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1)", publication).Scan(&exists)
+	if err != nil {
+		return resolved, fmt.Errorf("failed to check publication %s: %w", publication, err)
+	}
+	if !exists {
+		// Identifiers cannot be bound as parameters
+		query := fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s", quoteIdentifier(publication), quoteIdentifier(table))
+		if _, err := m.conn.ExecContext(ctx, query); err != nil {
+			return resolved, fmt.Errorf("failed to create publication %s: %w", publication, err)
+		}
+		slog.Info("Created publication", "publication", publication, "table", table)
+	}
+
+	err = m.conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_replication_slots WHERE slot_name = $1)", slot).Scan(&exists)
+	if err != nil {
+		return resolved, fmt.Errorf("failed to check replication slot %s: %w", slot, err)
+	}
+	if !exists {
+		if _, err := m.conn.ExecContext(ctx, "SELECT pg_create_logical_replication_slot($1, 'pgoutput')", slot); err != nil {
+			return resolved, fmt.Errorf("failed to create replication slot %s: %w", slot, err)
+		}
+		slog.Info("Created logical replication slot", "slot", slot)
+	}
+
+	return resolved, nil
+}
+
+// PeekChanges decodes up to limit changes from the slot without consuming them and returns the
+// LSN of the last record read. The slot only moves forward with AdvanceReplicationSlot, so changes
+// are read again after a crash until their position has been checkpointed.
+func (m *SQLConnection) PeekChanges(ctx context.Context, slot string, publication string, limit int) ([]ChangeEvent, string, error) {
+	var upto any
+	if limit > 0 {
+		upto = limit
+	}
+
+	rows, err := m.conn.QueryContext(ctx,
+		"SELECT lsn::text, data FROM pg_logical_slot_peek_binary_changes($1, NULL, $2, 'proto_version', '1', 'publication_names', $3)",
+		slot, upto, publication)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read replication slot %s: %w", slot, err)
+	}
+	defer rows.Close()
+
+	// Every SQL decoding session starts fresh, relation messages are sent again before their first change
+	decoder := newPgoutputDecoder()
+	events := []ChangeEvent{}
+	lastLSN := ""
+	for rows.Next() {
+		var lsn string
+		var data []byte
+		if err := rows.Scan(&lsn, &data); err != nil {
+			return nil, "", fmt.Errorf("failed to scan change: %w", err)
+		}
+		lastLSN = lsn
+
+		event, err := decoder.decode(data)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decode change at %s: %w", lsn, err)
+		}
+		if event != nil {
+			event.LSN = lsn
+			events = append(events, *event)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("error iterating changes: %w", err)
+	}
+
+	return events, lastLSN, nil
+}
+
+// AdvanceReplicationSlot confirms all changes up to lsn so the server can recycle their WAL
+func (m *SQLConnection) AdvanceReplicationSlot(ctx context.Context, slot string, lsn string) error {
+	if _, err := m.conn.ExecContext(ctx, "SELECT pg_replication_slot_advance($1, $2::pg_lsn)", slot, lsn); err != nil {
+		return fmt.Errorf("failed to advance replication slot %s: %w", slot, err)
+	}
+	return nil
+}
+
+// ParseLSN converts the textual X/Y form of a PostgreSQL LSN to a number
+func ParseLSN(lsn string) (uint64, error) {
+	hi, lo, ok := strings.Cut(lsn, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid LSN %q", lsn)
+	}
+
+	high, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q: %w", lsn, err)
+	}
+	low, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q: %w", lsn, err)
+	}
+
+	return high<<32 | low, nil
+}
+
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+// pgoutput protocol version 1, see "Logical Replication Message Formats" in the PostgreSQL docs
+
+type pgRelation struct {
+	namespace string
+	name      string
+	columns   []pgColumn
+}
+
+type pgColumn struct {
+	name    string
+	typeOID uint32
+}
+
+type pgoutputDecoder struct {
+	relations map[uint32]*pgRelation
+}
+
+func newPgoutputDecoder() *pgoutputDecoder {
+	return &pgoutputDecoder{
+		relations: make(map[uint32]*pgRelation),
+	}
+}
+
+var errShortMessage = errors.New("pgoutput message too short")
+
+// decode handles one pgoutput message, it returns nil for messages that are not row changes
+func (d *pgoutputDecoder) decode(data []byte) (*ChangeEvent, error) {
+	if len(data) == 0 {
+		return nil, errShortMessage
+	}
+
+	r := &pgReader{buf: data[1:]}
+	switch data[0] {
+	case 'R':
+		return nil, d.decodeRelation(r)
+	case 'I':
+		relation, err := d.relation(r)
+		if err != nil {
+			return nil, err
+		}
+		if kind := r.byte(); kind != 'N' {
+			return nil, fmt.Errorf("unexpected insert tuple type %q", kind)
+		}
+		return d.tupleEvent("insert", relation, r)
+	case 'U':
+		relation, err := d.relation(r)
+		if err != nil {
+			return nil, err
+		}
+		kind := r.byte()
+		if kind == 'K' || kind == 'O' {
+			// Old key/row is only sent when the replica identity changed, the new row is what we need
+			if _, err := d.tuple(relation, r); err != nil {
+				return nil, err
+			}
+			kind = r.byte()
+		}
+		if kind != 'N' {
+			return nil, fmt.Errorf("unexpected update tuple type %q", kind)
+		}
+		return d.tupleEvent("update", relation, r)
+	case 'D':
+		relation, err := d.relation(r)
+		if err != nil {
+			return nil, err
+		}
+		if kind := r.byte(); kind != 'K' && kind != 'O' {
+			return nil, fmt.Errorf("unexpected delete tuple type %q", kind)
+		}
+		return d.tupleEvent("delete", relation, r)
+	default:
+		// Begin, Commit, Origin, Type, Truncate and Message carry no row data
+		return nil, nil
+	}
+}
+
+func (d *pgoutputDecoder) decodeRelation(r *pgReader) error {
+	id := r.uint32()
+	relation := &pgRelation{
+		namespace: r.string(),
+		name:      r.string(),
+	}
+	r.byte() // replica identity setting
+
+	count := int(r.uint16())
+	for range count {
+		r.byte() // flags, 1 marks a key column
+		column := pgColumn{
+			name:    r.string(),
+			typeOID: r.uint32(),
+		}
+		r.uint32() // type modifier
+		relation.columns = append(relation.columns, column)
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+	d.relations[id] = relation
+	return nil
+}
+
+func (d *pgoutputDecoder) relation(r *pgReader) (*pgRelation, error) {
+	id := r.uint32()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	relation, ok := d.relations[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown relation %d", id)
+	}
+	return relation, nil
+}
+
+func (d *pgoutputDecoder) tupleEvent(operation string, relation *pgRelation, r *pgReader) (*ChangeEvent, error) {
+	data, err := d.tuple(relation, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChangeEvent{
+		Operation: operation,
+		Schema:    relation.namespace,
+		Table:     relation.name,
+		Data:      data,
+	}, nil
+}
+
+func (d *pgoutputDecoder) tuple(relation *pgRelation, r *pgReader) (dbtypes.M, error) {
+	count := int(r.uint16())
+	data := make(dbtypes.M, count)
+	for i := range count {
+		kind := r.byte()
+		var value any
+		switch kind {
+		case 'n':
+			value = nil
+		case 'u':
+			// Unchanged TOAST value, not sent by the server
+			continue
+		case 't':
+			size := int(r.uint32())
+			value = r.bytes(size)
+		default:
+			return nil, fmt.Errorf("unsupported tuple column type %q", kind)
+		}
+
+		if r.err != nil {
+			return nil, r.err
+		}
+		if i >= len(relation.columns) {
+			return nil, fmt.Errorf("tuple has more columns than relation %s", relation.name)
+		}
+
+		column := relation.columns[i]
+		if text, ok := value.([]byte); ok {
+			data[column.name] = convertText(column.typeOID, string(text))
+		} else {
+			data[column.name] = nil
+		}
+	}
+
+	return data, r.err
+}
+
+// convertText converts the text representation of a column to the Go type database/sql would return
+func convertText(typeOID uint32, text string) any {
+	switch typeOID {
+	case 16: // bool
+		return text == "t"
+	case 20, 21, 23: // int8, int2, int4
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n
+		}
+	case 700, 701, 1700: // float4, float8, numeric
+		// NaN and Infinity stay text, they cannot be encoded to JSON as numbers
+		if f, err := strconv.ParseFloat(text, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f
+		}
+	}
+	return text
+}
+
+// pgReader reads big-endian protocol values, the first error sticks and makes later reads no-ops
+type pgReader struct {
+	buf []byte
+	err error
+}
+
+func (r *pgReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.buf) < n {
+		r.err = errShortMessage
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *pgReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *pgReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *pgReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *pgReader) bytes(n int) []byte {
+	return r.next(n)
+}
+
+func (r *pgReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	end := -1
+	for i, c := range r.buf {
+		if c == 0 {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		r.err = errShortMessage
+		return ""
+	}
+	s := string(r.buf[:end])
+	r.buf = r.buf[end+1:]
+	return s
+}
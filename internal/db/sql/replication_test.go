@@ -0,0 +1,362 @@
+package sql
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"pubsub-ckg-tb/internal/config"
+)
+
+// pgoutput protocol version 1 messages as returned by pg_logical_slot_peek_binary_changes for
+//
+//	CREATE TABLE public.skrining (id int4 PRIMARY KEY, pasien_id text, terduga_tb bool, berat numeric, catatan text);
+//	ALTER TABLE public.skrining REPLICA IDENTITY FULL;
+
+type pgColumnSpec struct {
+	name    string
+	typeOID uint32
+	key     bool
+}
+
+var skriningColumns = []pgColumnSpec{
+	{name: "id", typeOID: 23, key: true},
+	{name: "pasien_id", typeOID: 25},
+	{name: "terduga_tb", typeOID: 16},
+	{name: "berat", typeOID: 1700},
+	{name: "catatan", typeOID: 25},
+}
+
+func pgString(b []byte, s string) []byte {
+	return append(append(b, s...), 0)
+}
+
+func relationMessage(id uint32, namespace string, name string, identity byte, columns []pgColumnSpec) []byte {
+	msg := binary.BigEndian.AppendUint32([]byte{'R'}, id)
+	msg = pgString(msg, namespace)
+	msg = pgString(msg, name)
+	msg = append(msg, identity)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(columns)))
+	for _, column := range columns {
+		flags := byte(0)
+		if column.key {
+			flags = 1
+		}
+		msg = pgString(append(msg, flags), column.name)
+		msg = binary.BigEndian.AppendUint32(msg, column.typeOID)
+		msg = binary.BigEndian.AppendUint32(msg, 0xffffffff) // atttypmod -1
+	}
+	return msg
+}
+
+// pgTuple encodes TupleData, a string is sent as text, nil as NULL and pgUnchanged as an unchanged TOAST value
+func pgTuple(values ...any) []byte {
+	msg := binary.BigEndian.AppendUint16(nil, uint16(len(values)))
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			msg = append(msg, 'n')
+		case pgUnchangedToast:
+			msg = append(msg, 'u')
+		case string:
+			msg = binary.BigEndian.AppendUint32(append(msg, 't'), uint32(len(v)))
+			msg = append(msg, v...)
+		}
+	}
+	return msg
+}
+
+type pgUnchangedToast struct{}
+
+var pgUnchanged = pgUnchangedToast{}
+
+func changeMessage(kind byte, relation uint32, tuples ...[]byte) []byte {
+	msg := binary.BigEndian.AppendUint32([]byte{kind}, relation)
+	return append(msg, concat(tuples...)...)
+}
+
+func concat(parts ...[]byte) []byte {
+	out := []byte{}
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+func TestPgoutputDecodeInsert(t *testing.T) {
+	d := newPgoutputDecoder()
+	if event, err := d.decode(relationMessage(16385, "public", "skrining", 'f', skriningColumns)); err != nil || event != nil {
+		t.Fatalf("relation: unexpected %+v, %v", event, err)
+	}
+
+	event, err := d.decode(changeMessage('I', 16385, []byte{'N'}, pgTuple("7", "P-001", "t", "65.50", nil)))
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if event.Operation != "insert" || event.Schema != "public" || event.Table != "skrining" {
+		t.Fatalf("unexpected insert header: %+v", event)
+	}
+
+	expected := map[string]any{
+		"id":         int64(7),
+		"pasien_id":  "P-001",
+		"terduga_tb": true,
+		"berat":      65.5,
+		"catatan":    nil,
+	}
+	for key, value := range expected {
+		got, ok := event.Data[key]
+		if !ok || got != value {
+			t.Errorf("%s: expected %#v, got %#v", key, value, got)
+		}
+	}
+}
+
+func TestPgoutputDecodeUpdate(t *testing.T) {
+	d := newPgoutputDecoder()
+	if _, err := d.decode(relationMessage(16385, "public", "skrining", 'f', skriningColumns)); err != nil {
+		t.Fatal(err)
+	}
+
+	// With REPLICA IDENTITY FULL the old row is sent first ('O'), the new row follows ('N')
+	event, err := d.decode(changeMessage('U', 16385,
+		[]byte{'O'}, pgTuple("7", "P-001", "t", "65.50", "lama"),
+		[]byte{'N'}, pgTuple("7", "P-001", "f", "66", pgUnchanged),
+	))
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if event.Operation != "update" || event.Data["terduga_tb"] != false || event.Data["berat"] != 66.0 {
+		t.Fatalf("unexpected update: %+v", event)
+	}
+	if _, ok := event.Data["catatan"]; ok {
+		t.Errorf("unchanged TOAST column must be left out, got %#v", event.Data["catatan"])
+	}
+
+	// Without a changed key only the new row is sent
+	event, err = d.decode(changeMessage('U', 16385, []byte{'N'}, pgTuple("8", "P-002", "t", "1", "baru")))
+	if err != nil || event.Data["pasien_id"] != "P-002" {
+		t.Fatalf("update without old row: unexpected %+v, %v", event, err)
+	}
+}
+
+func TestPgoutputDecodeDelete(t *testing.T) {
+	d := newPgoutputDecoder()
+	if _, err := d.decode(relationMessage(16385, "public", "skrining", 'f', skriningColumns)); err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := d.decode(changeMessage('D', 16385, []byte{'O'}, pgTuple("7", "P-001", "t", "65.50", nil)))
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if event.Operation != "delete" || event.Data["pasien_id"] != "P-001" || event.Data["id"] != int64(7) {
+		t.Fatalf("unexpected delete: %+v", event)
+	}
+
+	// With the default replica identity only the key columns are filled, the others are NULL
+	event, err = d.decode(changeMessage('D', 16385, []byte{'K'}, pgTuple("7", nil, nil, nil, nil)))
+	if err != nil {
+		t.Fatalf("delete by key: %v", err)
+	}
+	if event.Data["id"] != int64(7) || event.Data["pasien_id"] != nil {
+		t.Fatalf("unexpected delete by key: %+v", event)
+	}
+}
+
+func TestPgoutputDecodeIgnoresOtherMessages(t *testing.T) {
+	d := newPgoutputDecoder()
+
+	begin := binary.BigEndian.AppendUint64([]byte{'B'}, 0x16B3748)
+	begin = binary.BigEndian.AppendUint64(begin, 0)
+	begin = binary.BigEndian.AppendUint32(begin, 750)
+	commit := binary.BigEndian.AppendUint64([]byte{'C', 0}, 0x16B3748)
+	commit = binary.BigEndian.AppendUint64(commit, 0x16B3780)
+	commit = binary.BigEndian.AppendUint64(commit, 0)
+
+	for _, msg := range [][]byte{begin, commit} {
+		if event, err := d.decode(msg); err != nil || event != nil {
+			t.Fatalf("%c: unexpected %+v, %v", msg[0], event, err)
+		}
+	}
+}
+
+func TestPgoutputDecodeErrors(t *testing.T) {
+	d := newPgoutputDecoder()
+	if _, err := d.decode(nil); err == nil {
+		t.Error("expected error for an empty message")
+	}
+	if _, err := d.decode(changeMessage('I', 99, []byte{'N'}, pgTuple("1"))); err == nil {
+		t.Error("expected error for an unknown relation")
+	}
+
+	if _, err := d.decode(relationMessage(16385, "public", "skrining", 'f', skriningColumns[:1])); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.decode(changeMessage('I', 16385, []byte{'N'}, pgTuple("1", "extra"))); err == nil {
+		t.Error("expected error for a tuple with more columns than the relation")
+	}
+
+	truncated := changeMessage('I', 16385, []byte{'N'}, pgTuple("12345"))
+	if _, err := d.decode(truncated[:len(truncated)-2]); err != errShortMessage {
+		t.Errorf("expected errShortMessage, got %v", err)
+	}
+}
+
+// A relation message for the same id replaces the previous definition, e.g. after ALTER TABLE
+func TestPgoutputTupleFollowsRelation(t *testing.T) {
+	d := newPgoutputDecoder()
+	if _, err := d.decode(relationMessage(16385, "public", "skrining", 'f', skriningColumns[:2])); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.decode(relationMessage(16385, "public", "skrining", 'f', []pgColumnSpec{skriningColumns[0], {name: "nik", typeOID: 25}})); err != nil {
+		t.Fatal(err)
+	}
+
+	relation := d.relations[16385]
+	data, err := d.tuple(relation, &pgReader{buf: pgTuple("1", "3171")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["nik"] != "3171" || data["pasien_id"] != nil {
+		t.Fatalf("unexpected tuple %#v", data)
+	}
+}
+
+func TestConvertText(t *testing.T) {
+	tests := []struct {
+		typeOID  uint32
+		text     string
+		expected any
+	}{
+		{16, "t", true},
+		{16, "f", false},
+		{20, "9223372036854775807", int64(9223372036854775807)},
+		{21, "-12", int64(-12)},
+		{23, "42", int64(42)},
+		{23, "bukan angka", "bukan angka"},
+		{700, "1.5", 1.5},
+		{701, "-0.25", -0.25},
+		{1700, "65.50", 65.5},
+		{1700, "NaN", "NaN"},
+		{701, "Infinity", "Infinity"},
+		{25, "teks", "teks"},
+		{1082, "2025-01-31", "2025-01-31"},
+		{1184, "2025-01-31 10:00:00+07", "2025-01-31 10:00:00+07"},
+	}
+
+	for _, tt := range tests {
+		got := convertText(tt.typeOID, tt.text)
+		if got != tt.expected {
+			t.Errorf("convertText(%d, %q) = %#v, expected %#v", tt.typeOID, tt.text, got, tt.expected)
+		}
+	}
+}
+
+// TestLogicalReplication runs against the PostgreSQL service of docker-compose.yaml
+// (docker compose --profile postgres up -d postgres), set TEST_POSTGRES_HOST to enable it.
+func TestLogicalReplication(t *testing.T) {
+	host := os.Getenv("TEST_POSTGRES_HOST")
+	if host == "" {
+		t.Skip("TEST_POSTGRES_HOST is not set")
+	}
+
+	port := 5432
+	if value := os.Getenv("TEST_POSTGRES_PORT"); value != "" {
+		port, _ = strconv.Atoi(value)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	db := NewDBConnection(&config.DatabaseConfig{
+		Driver:   "postgres",
+		Host:     host,
+		Port:     port,
+		Username: envOr("TEST_POSTGRES_USER", "postgres"),
+		Password: envOr("TEST_POSTGRES_PASSWORD", "password"),
+		Database: envOr("TEST_POSTGRES_DATABASE", "ckg_db"),
+	}).(*SQLConnection)
+	if err := db.Connect(ctx); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer db.Close(context.Background())
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	table := "pgoutput_test_" + suffix
+	slot := "pgoutput_test_slot_" + suffix
+	publication := "pgoutput_test_pub_" + suffix
+
+	exec := func(query string, args ...any) {
+		t.Helper()
+		if _, err := db.conn.ExecContext(ctx, query, args...); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+
+	exec(fmt.Sprintf("CREATE TABLE %s (id int4 PRIMARY KEY, pasien_id text, terduga_tb bool, berat numeric)", table))
+	defer func() {
+		db.conn.ExecContext(context.Background(), "SELECT pg_drop_replication_slot($1)", slot)
+		db.conn.ExecContext(context.Background(), "DROP PUBLICATION IF EXISTS "+publication)
+		db.conn.ExecContext(context.Background(), "DROP TABLE IF EXISTS "+table)
+	}()
+
+	replicated, err := db.EnsureReplicationSlot(ctx, slot, publication, table)
+	if err != nil {
+		t.Fatalf("EnsureReplicationSlot: %v", err)
+	}
+	if replicated.Schema != "public" || replicated.Name != table || replicated.FullIdentity() {
+		t.Fatalf("unexpected table %+v", replicated)
+	}
+
+	exec(fmt.Sprintf("ALTER TABLE %s REPLICA IDENTITY FULL", table))
+	replicated, err = db.EnsureReplicationSlot(ctx, slot, publication, table)
+	if err != nil || !replicated.FullIdentity() {
+		t.Fatalf("expected full replica identity, got %+v, %v", replicated, err)
+	}
+
+	exec(fmt.Sprintf("INSERT INTO %s VALUES (1, 'P-001', true, 65.5)", table))
+	exec(fmt.Sprintf("UPDATE %s SET terduga_tb = false WHERE id = 1", table))
+	exec(fmt.Sprintf("DELETE FROM %s WHERE id = 1", table))
+
+	events, lastLSN, err := db.PeekChanges(ctx, slot, publication, 0)
+	if err != nil {
+		t.Fatalf("PeekChanges: %v", err)
+	}
+	if lastLSN == "" || len(events) != 3 {
+		t.Fatalf("expected 3 changes, got %d (last LSN %q)", len(events), lastLSN)
+	}
+
+	operations := []string{"insert", "update", "delete"}
+	for i, event := range events {
+		if !replicated.Matches(event) || event.Operation != operations[i] {
+			t.Errorf("change %d: unexpected %+v", i, event)
+		}
+		if event.Data["pasien_id"] != "P-001" || event.Data["id"] != int64(1) {
+			t.Errorf("change %d: unexpected data %#v", i, event.Data)
+		}
+	}
+	if events[1].Data["terduga_tb"] != false {
+		t.Errorf("update: expected terduga_tb false, got %#v", events[1].Data["terduga_tb"])
+	}
+
+	// Peeking does not consume, the slot only moves with AdvanceReplicationSlot
+	if err := db.AdvanceReplicationSlot(ctx, slot, lastLSN); err != nil {
+		t.Fatalf("AdvanceReplicationSlot: %v", err)
+	}
+	events, _, err = db.PeekChanges(ctx, slot, publication, 0)
+	if err != nil || len(events) != 0 {
+		t.Fatalf("expected no changes after advancing, got %d, %v", len(events), err)
+	}
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
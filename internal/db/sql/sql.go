@@ -11,16 +11,11 @@ import (
 	"pubsub-ckg-tb/internal/db/dbtypes"
 	"reflect"
 	"strings"
-	"sync"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 )
 
-var (
-	mapColumns sync.Map = sync.Map{}
-)
-
 // SQLConnection implements DatabaseConnection for MySQL and PostgreSQL
 type SQLConnection struct {
 	conn   *sql.DB
@@ -146,18 +141,62 @@ func (m *SQLConnection) Find(ctx context.Context, table string, column []string,
 	query := fmt.Sprintf("SELECT %s FROM %s%s%s", colSelect, table, whereClause, orderClause)
 	slog.Debug("Query: " + query)
 
-	rows, err := m.conn.QueryContext(ctx, query, args...)
+	rows, err := m.conn.QueryContext(ctx, m.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	results, err := scanRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	str, _ := json.Marshal(results)
+	slog.Debug("Hasil: " + string(str))
+
+	return results, nil
+}
+
+// Poll returns up to limit rows of table changed after the (afterTimestamp, afterKey) high-water mark,
+// ordered by timestampColumn and keyColumn. A nil afterTimestamp starts from the first row and a nil
+// afterKey includes every row at afterTimestamp.
+func (m *SQLConnection) Poll(ctx context.Context, table string, timestampColumn string, keyColumn string, afterTimestamp any, afterKey any, limit int64) ([]dbtypes.M, error) {
+	whereClause := ""
+	var args []any
+	if afterTimestamp != nil {
+		if afterKey != nil {
+			whereClause = fmt.Sprintf(" WHERE (%s > ? OR (%s = ? AND %s > ?))", timestampColumn, timestampColumn, keyColumn)
+			args = append(args, afterTimestamp, afterTimestamp, afterKey)
+		} else {
+			whereClause = fmt.Sprintf(" WHERE %s >= ?", timestampColumn)
+			args = append(args, afterTimestamp)
+		}
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s%s ORDER BY %s ASC, %s ASC", table, whereClause, timestampColumn, keyColumn)
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	slog.Debug("Query: " + query)
+
+	rows, err := m.conn.QueryContext(ctx, m.rebind(query), args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query table %s: %v", table, err)
+		return nil, fmt.Errorf("failed to poll table %s: %w", table, err)
 	}
 	defer rows.Close()
 
-	var results []dbtypes.M
+	return scanRows(rows)
+}
+
+// scanRows reads all rows into maps keyed by column name, []byte values are converted to string
+func scanRows(rows *sql.Rows) ([]dbtypes.M, error) {
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get columns: %v", err)
+		return nil, fmt.Errorf("failed to get columns: %w", err)
 	}
 
+	results := []dbtypes.M{}
 	for rows.Next() {
 		values := make([]any, len(columns))
 		valuePtrs := make([]any, len(columns))
@@ -166,7 +205,7 @@ func (m *SQLConnection) Find(ctx context.Context, table string, column []string,
 		}
 
 		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, fmt.Errorf("failed to scan row: %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
 		entry := make(dbtypes.M)
@@ -182,13 +221,10 @@ func (m *SQLConnection) Find(ctx context.Context, table string, column []string,
 		results = append(results, entry)
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %v", err)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
 
-	str, _ := json.Marshal(results)
-	slog.Debug("Hasil: " + string(str))
-
 	return results, nil
 }
 
@@ -199,53 +235,22 @@ func (m *SQLConnection) FindOne(ctx context.Context, result any, table string, c
 
 	query := fmt.Sprintf("SELECT %s FROM %s%s%s", colSelect, table, whereClause, orderClause)
 
-	row := m.conn.QueryRowContext(ctx, query, args...)
-
-	var columns []string
-	keyMap := table + "Columns"
-	cols, _ := mapColumns.Load(keyMap)
-	if cols != nil {
-		// Load column names from cache
-		columns = cols.([]string)
-	} else {
-		// Get the column names by querying the table schema
-		if m.config.Driver == "mysql" {
-			schemaQuery := fmt.Sprintf("SHOW COLUMNS FROM %s", table)
-			rows, err := m.conn.QueryContext(ctx, schemaQuery)
-			if err != nil {
-				return fmt.Errorf("failed to get columns: %v", err)
-			}
-			defer rows.Close()
-
-			for rows.Next() {
-				var column string
-				if err := rows.Scan(&column); err != nil {
-					return fmt.Errorf("failed to scan column: %v", err)
-				}
-				columns = append(columns, column)
-			}
-		} else {
-			// For PostgreSQL
-			schemaQuery := fmt.Sprintf("SELECT column_name FROM information_schema.columns WHERE table_name = '%s'", table)
-			rows, err := m.conn.QueryContext(ctx, schemaQuery)
-			if err != nil {
-				return fmt.Errorf("failed to get columns: %v", err)
-			}
-			defer rows.Close()
+	rows, err := m.conn.QueryContext(ctx, m.rebind(query), args...)
+	if err != nil {
+		return fmt.Errorf("failed to query table %s: %w", table, err)
+	}
+	defer rows.Close()
 
-			for rows.Next() {
-				var column string
-				if err := rows.Scan(&column); err != nil {
-					return fmt.Errorf("failed to scan column: %v", err)
-				}
-				columns = append(columns, column)
-			}
-		}
-		mapColumns.Store(keyMap, columns)
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to get columns: %w", err)
 	}
 
-	if len(columns) == 0 {
-		return fmt.Errorf("no columns found for table %s", table)
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating rows: %w", err)
+		}
+		return fmt.Errorf("no rows found: %w", sql.ErrNoRows)
 	}
 
 	values := make([]any, len(columns))
@@ -254,11 +259,8 @@ func (m *SQLConnection) FindOne(ctx context.Context, result any, table string, c
 		valuePtrs[i] = &values[i]
 	}
 
-	if err := row.Scan(valuePtrs...); err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("no rows found")
-		}
-		return fmt.Errorf("failed to scan row: %v", err)
+	if err := rows.Scan(valuePtrs...); err != nil {
+		return fmt.Errorf("failed to scan row: %w", err)
 	}
 
 	// Convert to map first
@@ -297,7 +299,7 @@ func (m *SQLConnection) FindOne(ctx context.Context, result any, table string, c
 			jsonTag = jsonTag[:len(jsonTag)-1]
 		}
 
-		if val, exists := resultMap[jsonTag]; exists && field.CanSet() {
+		if val, exists := resultMap[jsonTag]; exists && val != nil && field.CanSet() {
 			valValue := reflect.ValueOf(val)
 			if valValue.Type().ConvertibleTo(field.Type()) {
 				field.Set(valValue.Convert(field.Type()))
@@ -364,14 +366,19 @@ func (m *SQLConnection) InsertOne(ctx context.Context, table string, data any) (
 		strings.Join(columns, ", "),
 		strings.Join(placeholders, ", "))
 
-	result, err := m.conn.ExecContext(ctx, query, values...)
+	result, err := m.conn.ExecContext(ctx, m.rebind(query), values...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to insert into table %s: %v", table, err)
+		return nil, fmt.Errorf("failed to insert into table %s: %w", table, err)
+	}
+
+	// PostgreSQL (lib/pq) does not support LastInsertId
+	if m.config.Driver != "mysql" {
+		return nil, nil
 	}
 
 	id, err := result.LastInsertId()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get last insert id: %v", err)
+		return nil, fmt.Errorf("failed to get last insert id: %w", err)
 	}
 
 	return dbtypes.M{"id": id}, nil
@@ -431,14 +438,14 @@ func (m *SQLConnection) UpdateOne(ctx context.Context, table string, filter dbty
 		strings.Join(setClauses, ", "),
 		whereClause)
 
-	result, err := m.conn.ExecContext(ctx, query, values...)
+	result, err := m.conn.ExecContext(ctx, m.rebind(query), values...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update table %s: %v", table, err)
+		return 0, fmt.Errorf("failed to update table %s: %w", table, err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get rows affected: %v", err)
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
 	return rowsAffected, nil
@@ -449,114 +456,183 @@ func (m *SQLConnection) DeleteOne(ctx context.Context, table string, filter dbty
 
 	query := fmt.Sprintf("DELETE FROM %s%s", table, whereClause)
 
-	result, err := m.conn.ExecContext(ctx, query, args...)
+	result, err := m.conn.ExecContext(ctx, m.rebind(query), args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to delete from table %s: %v", table, err)
+		return nil, fmt.Errorf("failed to delete from table %s: %w", table, err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get rows affected: %v", err)
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
 	return dbtypes.M{"deleted_count": rowsAffected}, nil
 }
 
+// DeleteMany deletes every row matching filter and returns the number of deleted rows
+func (m *SQLConnection) DeleteMany(ctx context.Context, table string, filter dbtypes.M) (int64, error) {
+	whereClause, args := m.buildWhereClause(filter)
+
+	query := fmt.Sprintf("DELETE FROM %s%s", table, whereClause)
+
+	result, err := m.conn.ExecContext(ctx, m.rebind(query), args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete from table %s: %w", table, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// rebind converts ? placeholders to the $n placeholders used by PostgreSQL
+func (m *SQLConnection) rebind(query string) string {
+	if m.config.Driver == "mysql" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 // buildWhereClause converts MongoDB-style filter to SQL WHERE clause
 func (m *SQLConnection) buildWhereClause(filter dbtypes.M) (string, []any) {
 	if filter == nil {
 		return "", nil
 	}
 
+	whereClauses, args := m.buildConditions(filter)
+
+	whereClause := ""
+	if len(whereClauses) > 0 {
+		whereClause = " WHERE " + strings.Join(whereClauses, " AND ")
+	}
+
+	return whereClause, args
+}
+
+func (m *SQLConnection) buildConditions(filter dbtypes.M) ([]string, []any) {
 	var whereClauses []string
 	var args []any
 
 	for key, value := range filter {
-		switch v := value.(type) {
-		case dbtypes.M:
-			// Handle operators like $gt, $lt, $in, etc.
-			for op, val := range v {
-				switch op {
-				case "$gt":
-					whereClauses = append(whereClauses, fmt.Sprintf("%s > ?", key))
-					args = append(args, val)
-				case "$gte":
-					whereClauses = append(whereClauses, fmt.Sprintf("%s >= ?", key))
-					args = append(args, val)
-				case "$lt":
-					whereClauses = append(whereClauses, fmt.Sprintf("%s < ?", key))
-					args = append(args, val)
-				case "$lte":
-					whereClauses = append(whereClauses, fmt.Sprintf("%s <= ?", key))
-					args = append(args, val)
-				case "$ne":
+		// Logical operators on the top level, e.g. {"$or": [{...}, {...}]}
+		if key == "$or" || key == "$and" {
+			if clause, clauseArgs := m.buildLogicalClause(key, value); clause != "" {
+				whereClauses = append(whereClauses, clause)
+				args = append(args, clauseArgs...)
+			}
+			continue
+		}
+
+		v, isMap := dbtypes.ToM(value)
+		if !isMap {
+			// Simple equality
+			if value == nil {
+				whereClauses = append(whereClauses, fmt.Sprintf("%s IS NULL", key))
+			} else {
+				whereClauses = append(whereClauses, fmt.Sprintf("%s = ?", key))
+				args = append(args, value)
+			}
+			continue
+		}
+
+		// Handle operators like $gt, $lt, $in, etc.
+		for op, val := range v {
+			switch op {
+			case "$gt":
+				whereClauses = append(whereClauses, fmt.Sprintf("%s > ?", key))
+				args = append(args, val)
+			case "$gte":
+				whereClauses = append(whereClauses, fmt.Sprintf("%s >= ?", key))
+				args = append(args, val)
+			case "$lt":
+				whereClauses = append(whereClauses, fmt.Sprintf("%s < ?", key))
+				args = append(args, val)
+			case "$lte":
+				whereClauses = append(whereClauses, fmt.Sprintf("%s <= ?", key))
+				args = append(args, val)
+			case "$ne":
+				if val == nil {
+					whereClauses = append(whereClauses, fmt.Sprintf("%s IS NOT NULL", key))
+				} else {
 					whereClauses = append(whereClauses, fmt.Sprintf("%s != ?", key))
 					args = append(args, val)
-				case "$in":
-					if vals, ok := val.([]any); ok {
-						placeholders := make([]string, len(vals))
-						for i := range vals {
-							placeholders[i] = "?"
-						}
-						whereClauses = append(whereClauses, fmt.Sprintf("%s IN (%s)", key, strings.Join(placeholders, ", ")))
-						args = append(args, vals...)
-					}
-				case "$nin":
-					if vals, ok := val.([]any); ok {
-						placeholders := make([]string, len(vals))
-						for i := range vals {
-							placeholders[i] = "?"
-						}
-						whereClauses = append(whereClauses, fmt.Sprintf("%s NOT IN (%s)", key, strings.Join(placeholders, ", ")))
-						args = append(args, vals...)
-					}
-				case "$or":
-					if orConditions, ok := val.([]any); ok {
-						var orClauses []string
-						for _, condition := range orConditions {
-							if condMap, ok := condition.(dbtypes.M); ok {
-								orWhere, orArgs := m.buildWhereClause(condMap)
-								if orWhere != "" {
-									orClauses = append(orClauses, fmt.Sprintf("(%s)", orWhere))
-									args = append(args, orArgs...)
-								}
-							}
-						}
-						if len(orClauses) > 0 {
-							whereClauses = append(whereClauses, fmt.Sprintf("(%s)", strings.Join(orClauses, " OR ")))
-						}
-					}
-				case "$and":
-					if andConditions, ok := val.([]any); ok {
-						var andClauses []string
-						for _, condition := range andConditions {
-							if condMap, ok := condition.(dbtypes.M); ok {
-								andWhere, andArgs := m.buildWhereClause(condMap)
-								if andWhere != "" {
-									andClauses = append(andClauses, fmt.Sprintf("(%s)", andWhere))
-									args = append(args, andArgs...)
-								}
-							}
-						}
-						if len(andClauses) > 0 {
-							whereClauses = append(whereClauses, fmt.Sprintf("(%s)", strings.Join(andClauses, " AND ")))
-						}
+				}
+			case "$in", "$nin":
+				// A single value is a set of one, dropping the condition would match every row
+				vals, ok := dbtypes.ToSlice(val)
+				if !ok {
+					vals = []any{val}
+				}
+				if len(vals) == 0 {
+					// IN () is not valid SQL, an empty set never matches
+					if op == "$in" {
+						whereClauses = append(whereClauses, "1 = 0")
 					}
+					continue
+				}
+				placeholders := make([]string, len(vals))
+				for i := range vals {
+					placeholders[i] = "?"
+				}
+				operator := "IN"
+				if op == "$nin" {
+					operator = "NOT IN"
+				}
+				whereClauses = append(whereClauses, fmt.Sprintf("%s %s (%s)", key, operator, strings.Join(placeholders, ", ")))
+				args = append(args, vals...)
+			case "$or", "$and":
+				if clause, clauseArgs := m.buildLogicalClause(op, val); clause != "" {
+					whereClauses = append(whereClauses, clause)
+					args = append(args, clauseArgs...)
 				}
 			}
-		default:
-			// Simple equality
-			whereClauses = append(whereClauses, fmt.Sprintf("%s = ?", key))
-			args = append(args, value)
 		}
 	}
 
-	whereClause := ""
-	if len(whereClauses) > 0 {
-		whereClause = " WHERE " + strings.Join(whereClauses, " AND ")
+	return whereClauses, args
+}
+
+func (m *SQLConnection) buildLogicalClause(op string, value any) (string, []any) {
+	conditions, ok := dbtypes.ToSlice(value)
+	if !ok {
+		return "", nil
 	}
 
-	return whereClause, args
+	separator := " OR "
+	if op == "$and" {
+		separator = " AND "
+	}
+
+	var clauses []string
+	var args []any
+	for _, condition := range conditions {
+		if condMap, ok := dbtypes.ToM(condition); ok {
+			condClauses, condArgs := m.buildConditions(condMap)
+			if len(condClauses) > 0 {
+				clauses = append(clauses, fmt.Sprintf("(%s)", strings.Join(condClauses, " AND ")))
+				args = append(args, condArgs...)
+			}
+		}
+	}
+
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("(%s)", strings.Join(clauses, separator)), args
 }
 
 func (m *SQLConnection) buildSelectClause(column []string) string {
@@ -577,11 +653,11 @@ func (m *SQLConnection) buildOrderClause(sort map[string]int, limit int64, skip
 	}
 
 	var orderClauses []string
-	for key, value := range sort {
-		if value == 1 {
-			orderClauses = append(orderClauses, fmt.Sprintf("%s ASC", key))
+	for _, field := range dbtypes.SortFields(sort) {
+		if field.Ascending {
+			orderClauses = append(orderClauses, fmt.Sprintf("%s ASC", field.Field))
 		} else {
-			orderClauses = append(orderClauses, fmt.Sprintf("%s DESC", key))
+			orderClauses = append(orderClauses, fmt.Sprintf("%s DESC", field.Field))
 		}
 	}
 	orderClause := ""
@@ -0,0 +1,114 @@
+package sql
+
+import (
+	"reflect"
+	"testing"
+
+	"pubsub-ckg-tb/internal/config"
+	"pubsub-ckg-tb/internal/db/dbtypes"
+)
+
+func TestBuildWhereClause(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter dbtypes.M
+		where  string
+		args   []any
+	}{
+		{
+			name:   "equality",
+			filter: dbtypes.M{"id": "msg-1"},
+			where:  " WHERE id = ?",
+			args:   []any{"msg-1"},
+		},
+		{
+			name:   "nil is null",
+			filter: dbtypes.M{"processed_at": nil},
+			where:  " WHERE processed_at IS NULL",
+		},
+		{
+			name:   "ne nil is not null",
+			filter: dbtypes.M{"processed_at": dbtypes.M{"$ne": nil}},
+			where:  " WHERE processed_at IS NOT NULL",
+		},
+		{
+			name:   "operators of map[string]any",
+			filter: dbtypes.M{"created_at": map[string]any{"$lt": "2025-03-01"}},
+			where:  " WHERE created_at < ?",
+			args:   []any{"2025-03-01"},
+		},
+		{
+			name:   "in typed slice",
+			filter: dbtypes.M{"id": dbtypes.M{"$in": []string{"a", "b"}}},
+			where:  " WHERE id IN (?, ?)",
+			args:   []any{"a", "b"},
+		},
+		{
+			name:   "in single value",
+			filter: dbtypes.M{"id": dbtypes.M{"$in": "a"}},
+			where:  " WHERE id IN (?)",
+			args:   []any{"a"},
+		},
+		{
+			name:   "empty in never matches",
+			filter: dbtypes.M{"id": dbtypes.M{"$in": []string{}}},
+			where:  " WHERE 1 = 0",
+		},
+		{
+			name:   "empty nin always matches",
+			filter: dbtypes.M{"id": dbtypes.M{"$nin": []any{}}},
+			where:  "",
+		},
+		{
+			name: "top level or",
+			filter: dbtypes.M{"$or": []dbtypes.M{
+				{"pasien_ckg_id": "ckg-1"},
+				{"pasien_nik": "3201"},
+			}},
+			where: " WHERE ((pasien_ckg_id = ?) OR (pasien_nik = ?))",
+			args:  []any{"ckg-1", "3201"},
+		},
+		{
+			name: "nested and with or",
+			filter: dbtypes.M{"$and": []any{
+				map[string]any{"$or": []any{dbtypes.M{"pasien_ckg_id": "ckg-1"}}},
+				dbtypes.M{"$or": []any{
+					dbtypes.M{"sitb_updated_at": dbtypes.M{"$lt": "2025-03-01"}},
+					dbtypes.M{"sitb_updated_at": nil},
+				}},
+			}},
+			where: " WHERE ((((pasien_ckg_id = ?))) AND (((sitb_updated_at < ?) OR (sitb_updated_at IS NULL))))",
+			args:  []any{"ckg-1", "2025-03-01"},
+		},
+	}
+
+	m := &SQLConnection{config: &config.DatabaseConfig{Driver: "mysql"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := m.buildWhereClause(tt.filter)
+			if where != tt.where {
+				t.Errorf("where = %q, want %q", where, tt.where)
+			}
+			if len(args) != 0 || len(tt.args) != 0 {
+				if !reflect.DeepEqual(args, tt.args) {
+					t.Errorf("args = %#v, want %#v", args, tt.args)
+				}
+			}
+		})
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := "SELECT * FROM t WHERE a = ? AND b IN (?, ?)"
+
+	mysql := &SQLConnection{config: &config.DatabaseConfig{Driver: "mysql"}}
+	if got := mysql.rebind(query); got != query {
+		t.Errorf("mysql rebind = %q", got)
+	}
+
+	postgres := &SQLConnection{config: &config.DatabaseConfig{Driver: "postgres"}}
+	want := "SELECT * FROM t WHERE a = $1 AND b IN ($2, $3)"
+	if got := postgres.rebind(query); got != want {
+		t.Errorf("postgres rebind = %q, want %q", got, want)
+	}
+}
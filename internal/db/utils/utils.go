@@ -2,12 +2,81 @@ package utils
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"io"
+	"net"
 	"pubsub-ckg-tb/internal/db/connection"
 	"pubsub-ckg-tb/internal/models"
 	"strings"
+	"syscall"
+
+	"github.com/go-sql-driver/mysql"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// ErrStaleStatus is returned by UpdatePasienTb when the stored status has the same or a newer SITB updated_at
+var ErrStaleStatus = errors.New("stale status: stored updated_at is not older")
+
+// IsNoDocuments checks whether err means that no document/row matched the filter
+func IsNoDocuments(err error) bool {
+	return errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, sql.ErrNoRows)
+}
+
+// IsTransientError checks whether err (or any error joined/wrapped in it) is a temporary
+// database or network failure that may succeed when retried
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// errors.Join menghasilkan beberapa error sekaligus, cukup satu yang transient
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			if IsTransientError(e) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return false
+}
+
+// IsChangeStreamHistoryLost checks whether a change stream cannot be resumed because
+// the resume token is no longer in the oplog
+func IsChangeStreamHistoryLost(err error) bool {
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+
+	// 286 ChangeStreamHistoryLost, 280 ChangeStreamFatalError, 136 CappedPositionLost
+	return serverErr.HasErrorCode(286) || serverErr.HasErrorCode(280) || serverErr.HasErrorCode(136)
+}
+
 func IsNotEmptyString(str *string) bool {
 	return str != nil && *str != ""
 }
@@ -189,6 +258,22 @@ func UpdatePasienTb(ctx context.Context, db connection.DatabaseConnection, colle
 		"$or": orFilter,
 	}
 
+	// Pertahankan updated_at SITB tersimpan jika pengirim tidak menyertakannya. Jika ada, update hanya
+	// berlaku untuk status yang lebih lama agar dua message yang diproses bersamaan tidak saling menimpa.
+	// Nilai sudah dinormalisasi ke format UTC dengan lebar tetap sehingga bisa dibandingkan sebagai string.
+	if IsNotEmptyString(item.SitbUpdatedAt) {
+		setUpdate["sitb_updated_at"] = item.SitbUpdatedAt
+		filter = map[string]any{
+			"$and": []map[string]any{
+				{"$or": orFilter},
+				{"$or": []map[string]any{
+					{"sitb_updated_at": map[string]any{"$lt": *item.SitbUpdatedAt}},
+					{"sitb_updated_at": nil},
+				}},
+			},
+		}
+	}
+
 	// result, err := collection.UpdateOne(ctx, filter, update)
 	result, err := db.UpdateOne(ctx, collectionName, filter, setUpdate)
 	if err != nil {
@@ -196,6 +281,10 @@ func UpdatePasienTb(ctx context.Context, db connection.DatabaseConnection, colle
 	}
 
 	if result == 0 {
+		if IsNotEmptyString(item.SitbUpdatedAt) {
+			// Status ada (sudah ditemukan sebelumnya) tetapi updated_at tersimpan tidak lebih lama
+			return ErrStaleStatus.Error(), ErrStaleStatus
+		}
 		err = errors.New("failed to update tb patient status")
 		return err.Error(), err
 	}
@@ -1,15 +1,405 @@
 package models
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// State proses message pada log incoming
+const (
+	IncomingStateReceived        = "received"
+	IncomingStateProcessing      = "processing"
+	IncomingStateSucceeded       = "succeeded"
+	IncomingStatePartiallyFailed = "partially_failed"
+	IncomingStateFailed          = "failed"
+)
+
+// IncomingMessageStatusTB mencatat message yang diterima consumer beserta state proses, jumlah percobaan
+// dan error terakhir. ProcessedAt terisi jika message selesai diproses (berhasil maupun gagal permanen).
 type IncomingMessageStatusTB struct {
 	ID          string  `json:"id" bson:"id"`
 	Data        *string `json:"data" bson:"data"`
+	State       string  `json:"state" bson:"state"`
+	Attempts    int     `json:"attempts" bson:"attempts"`
+	LastError   *string `json:"last_error" bson:"last_error"`
 	ReceivedAt  string  `json:"received_at" bson:"received_at"`
 	ProcessedAt *string `json:"processed_at" bson:"processed_at"`
+	UpdatedAt   string  `json:"updated_at" bson:"updated_at"`
+}
+
+// FromMap creates an IncomingMessageStatusTB from a map
+func (i *IncomingMessageStatusTB) FromMap(data map[string]any) {
+	if val, ok := data["id"].(string); ok {
+		i.ID = val
+	}
+	if val, ok := data["data"].(string); ok {
+		i.Data = &val
+	}
+	if val, ok := data["state"].(string); ok {
+		i.State = val
+	}
+	if val, ok := toInt(data["attempts"]); ok {
+		i.Attempts = val
+	}
+	if val, ok := data["last_error"].(string); ok {
+		i.LastError = &val
+	}
+	if val, ok := data["received_at"].(string); ok {
+		i.ReceivedAt = val
+	}
+	if val, ok := data["processed_at"].(string); ok && val != "" {
+		i.ProcessedAt = &val
+	}
+	if val, ok := data["updated_at"].(string); ok {
+		i.UpdatedAt = val
+	}
+}
+
+// IncomingItemStatusTB mencatat hasil proses satu status pasien di dalam message incoming
+type IncomingItemStatusTB struct {
+	MessageID   string  `json:"message_id" bson:"message_id"`
+	ItemIndex   int     `json:"item_index" bson:"item_index"`
+	PasienCkgID *string `json:"pasien_ckg_id" bson:"pasien_ckg_id"`
+	TerdugaID   *string `json:"terduga_id" bson:"terduga_id"`
+	PasienTbID  *string `json:"pasien_tb_id" bson:"pasien_tb_id"`
+	PasienNIK   *string `json:"pasien_nik" bson:"pasien_nik"`
+	IsError     bool    `json:"is_error" bson:"is_error"`
+	Respons     string  `json:"respons" bson:"respons"`
+	Attempt     int     `json:"attempt" bson:"attempt"`
+	ProcessedAt string  `json:"processed_at" bson:"processed_at"`
 }
 
+// NewIncomingItemStatusTB membuat log item dari hasil UpdateTbPatientStatus
+func NewIncomingItemStatusTB(messageID string, index int, result StatusPasienResult, attempt int, processedAt string) IncomingItemStatusTB {
+	return IncomingItemStatusTB{
+		MessageID:   messageID,
+		ItemIndex:   index,
+		PasienCkgID: result.PasienCkgID,
+		TerdugaID:   result.TerdugaID,
+		PasienTbID:  result.PasienTbID,
+		PasienNIK:   result.PasienNIK,
+		IsError:     result.IsError,
+		Respons:     result.Respons,
+		Attempt:     attempt,
+		ProcessedAt: processedAt,
+	}
+}
+
+// FromMap creates an IncomingItemStatusTB from a map
+func (i *IncomingItemStatusTB) FromMap(data map[string]any) {
+	if val, ok := data["message_id"].(string); ok {
+		i.MessageID = val
+	}
+	if val, ok := toInt(data["item_index"]); ok {
+		i.ItemIndex = val
+	}
+	if val, ok := data["pasien_ckg_id"].(string); ok {
+		i.PasienCkgID = &val
+	}
+	if val, ok := data["terduga_id"].(string); ok {
+		i.TerdugaID = &val
+	}
+	if val, ok := data["pasien_tb_id"].(string); ok {
+		i.PasienTbID = &val
+	}
+	if val, ok := data["pasien_nik"].(string); ok {
+		i.PasienNIK = &val
+	}
+	switch val := data["is_error"].(type) {
+	case bool:
+		i.IsError = val
+	default:
+		// MySQL menyimpan boolean sebagai TINYINT
+		if n, ok := toInt(val); ok {
+			i.IsError = n != 0
+		}
+	}
+	if val, ok := data["respons"].(string); ok {
+		i.Respons = val
+	}
+	if val, ok := toInt(data["attempt"]); ok {
+		i.Attempt = val
+	}
+	if val, ok := data["processed_at"].(string); ok {
+		i.ProcessedAt = val
+	}
+}
+
+// Status hasil publish pada log outgoing
+const (
+	OutgoingStatusPublished = "published"
+	OutgoingStatusFailed    = "failed"
+)
+
+// OutgoingMessageSkriningTB mencatat hasil setiap percobaan publish. Publish yang gagal tidak memiliki
+// message ID dari broker sehingga ID diisi <outbox_id>/<attempt>.
 type OutgoingMessageSkriningTB struct {
-	ID        string `json:"id" bson:"id"`
-	CreatedAt string `json:"created_at" bson:"created_at"`
-	UpdatedAt string `json:"updated_at" bson:"updated_at"`
-	// CkgID     string `json:"ckg_id" bson:"ckg_id"`
+	ID          string  `json:"id" bson:"id"`
+	OutboxID    string  `json:"outbox_id" bson:"outbox_id"`
+	PayloadHash string  `json:"payload_hash" bson:"payload_hash"`
+	OrderingKey string  `json:"ordering_key" bson:"ordering_key"`
+	Status      string  `json:"status" bson:"status"`
+	Error       *string `json:"error" bson:"error"`
+	Attempt     int     `json:"attempt" bson:"attempt"`
+	RecordCount int     `json:"record_count" bson:"record_count"`
+	CreatedAt   string  `json:"created_at" bson:"created_at"`
+	UpdatedAt   string  `json:"updated_at" bson:"updated_at"`
+}
+
+// OutgoingRecordSkriningTB mencatat satu data skrining yang terkirim di dalam sebuah message
+type OutgoingRecordSkriningTB struct {
+	MessageID   string `json:"message_id" bson:"message_id"`
+	PasienCkgID string `json:"pasien_ckg_id" bson:"pasien_ckg_id"`
+	PasienNIK   string `json:"pasien_nik" bson:"pasien_nik"`
+	RecordHash  string `json:"record_hash" bson:"record_hash"`
+	Terduga     *bool  `json:"terduga" bson:"terduga"` // dikirim sebagai terduga TB, nil untuk data sebelum flag ini dicatat
+	Attempt     int    `json:"attempt" bson:"attempt"`
+	PublishedAt string `json:"published_at" bson:"published_at"`
+}
+
+// FromMap creates an OutgoingRecordSkriningTB from a map
+func (o *OutgoingRecordSkriningTB) FromMap(data map[string]any) {
+	if val, ok := data["message_id"].(string); ok {
+		o.MessageID = val
+	}
+	if val, ok := data["pasien_ckg_id"].(string); ok {
+		o.PasienCkgID = val
+	}
+	if val, ok := data["pasien_nik"].(string); ok {
+		o.PasienNIK = val
+	}
+	if val, ok := data["record_hash"].(string); ok {
+		o.RecordHash = val
+	}
+	if val, ok := toBool(data["terduga"]); ok {
+		o.Terduga = &val
+	}
+	if val, ok := toInt(data["attempt"]); ok {
+		o.Attempt = val
+	}
+	if val, ok := data["published_at"].(string); ok {
+		o.PublishedAt = val
+	}
+}
+
+// OutgoingLatestSkriningTB menyimpan data terakhir per pasien, ditulis saat data masuk outbox sehingga
+// data yang masih menunggu relay ikut dihitung. MessageID dan PublishedAt diisi setelah message terkirim.
+type OutgoingLatestSkriningTB struct {
+	PasienCkgID string  `json:"pasien_ckg_id" bson:"pasien_ckg_id"`
+	OutboxID    *string `json:"outbox_id" bson:"outbox_id"`
+	MessageID   *string `json:"message_id" bson:"message_id"`
+	PasienNIK   string  `json:"pasien_nik" bson:"pasien_nik"`
+	RecordHash  string  `json:"record_hash" bson:"record_hash"`
+	Terduga     *bool   `json:"terduga" bson:"terduga"`
+	Attempt     int     `json:"attempt" bson:"attempt"`
+	QueuedAt    *string `json:"queued_at" bson:"queued_at"`
+	PublishedAt *string `json:"published_at" bson:"published_at"`
+}
+
+// FromMap creates an OutgoingLatestSkriningTB from a map
+func (o *OutgoingLatestSkriningTB) FromMap(data map[string]any) {
+	if val, ok := data["pasien_ckg_id"].(string); ok {
+		o.PasienCkgID = val
+	}
+	if val, ok := data["outbox_id"].(string); ok {
+		o.OutboxID = &val
+	}
+	if val, ok := data["message_id"].(string); ok {
+		o.MessageID = &val
+	}
+	if val, ok := data["pasien_nik"].(string); ok {
+		o.PasienNIK = val
+	}
+	if val, ok := data["record_hash"].(string); ok {
+		o.RecordHash = val
+	}
+	if val, ok := toBool(data["terduga"]); ok {
+		o.Terduga = &val
+	}
+	if val, ok := toInt(data["attempt"]); ok {
+		o.Attempt = val
+	}
+	if val, ok := data["queued_at"].(string); ok {
+		o.QueuedAt = &val
+	}
+	if val, ok := data["published_at"].(string); ok {
+		o.PublishedAt = &val
+	}
+}
+
+// PayloadHash returns the hex encoded SHA-256 of data
+func PayloadHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ContentHash returns the PayloadHash of the JSON representation of v
+func ContentHash(v any) (string, error) {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return PayloadHash(jsonBytes), nil
+}
+
+// Status outbox message, alur normal pending -> publishing -> published.
+// Publish yang gagal ditandai failed lalu dicoba ulang oleh relay sampai batas percobaan.
+const (
+	OutboxStatePending    = "pending"
+	OutboxStatePublishing = "publishing"
+	OutboxStatePublished  = "published"
+	OutboxStateFailed     = "failed"
+)
+
+// OutboxMessage adalah message yang menunggu dikirim oleh outbox relay
+type OutboxMessage struct {
+	ID          string  `json:"id" bson:"id"`
+	Topic       string  `json:"topic" bson:"topic"`
+	Data        string  `json:"data" bson:"data"`
+	Attributes  *string `json:"attributes" bson:"attributes"`
+	Records     *string `json:"records" bson:"records"` // JSON []OutgoingRecordSkriningTB, disalin ke log outgoing saat terkirim
+	State       string  `json:"state" bson:"state"`
+	Attempts    int     `json:"attempts" bson:"attempts"`
+	LastError   *string `json:"last_error" bson:"last_error"`
+	MessageID   *string `json:"message_id" bson:"message_id"`
+	CreatedAt   string  `json:"created_at" bson:"created_at"`
+	UpdatedAt   string  `json:"updated_at" bson:"updated_at"`
+	PublishedAt *string `json:"published_at" bson:"published_at"`
+}
+
+// FromMap creates an OutboxMessage from a map
+func (o *OutboxMessage) FromMap(data map[string]any) {
+	if val, ok := data["id"].(string); ok {
+		o.ID = val
+	}
+	if val, ok := data["topic"].(string); ok {
+		o.Topic = val
+	}
+	if val, ok := data["data"].(string); ok {
+		o.Data = val
+	}
+	if val, ok := data["attributes"].(string); ok {
+		o.Attributes = &val
+	}
+	if val, ok := data["records"].(string); ok {
+		o.Records = &val
+	}
+	if val, ok := data["state"].(string); ok {
+		o.State = val
+	}
+	if val, ok := toInt(data["attempts"]); ok {
+		o.Attempts = val
+	}
+	if val, ok := data["last_error"].(string); ok {
+		o.LastError = &val
+	}
+	if val, ok := data["message_id"].(string); ok {
+		o.MessageID = &val
+	}
+	if val, ok := data["created_at"].(string); ok {
+		o.CreatedAt = val
+	}
+	if val, ok := data["updated_at"].(string); ok {
+		o.UpdatedAt = val
+	}
+	if val, ok := data["published_at"].(string); ok {
+		o.PublishedAt = &val
+	}
+}
+
+// Checkpoint menyimpan posisi terakhir sumber perubahan data (resume token change stream,
+// cursor polling, LSN atau posisi binlog) agar producer bisa melanjutkan setelah restart
+type Checkpoint struct {
+	ID           string `json:"id" bson:"id"`
+	Position     string `json:"position" bson:"position"`
+	CheckpointAt string `json:"checkpoint_at" bson:"checkpoint_at"` // waktu event terakhir yang selesai diproses
+	UpdatedAt    string `json:"updated_at" bson:"updated_at"`
+}
+
+// FromMap creates a Checkpoint from a map
+func (c *Checkpoint) FromMap(data map[string]any) {
+	if val, ok := data["id"].(string); ok {
+		c.ID = val
+	}
+	if val, ok := data["position"].(string); ok {
+		c.Position = val
+	}
+	if val, ok := data["checkpoint_at"].(string); ok {
+		c.CheckpointAt = val
+	}
+	if val, ok := data["updated_at"].(string); ok {
+		c.UpdatedAt = val
+	}
+}
+
+// QuarantineMessage menyimpan message yang tidak bisa diproses (poison message) untuk diperiksa operator
+type QuarantineMessage struct {
+	ID              string  `json:"id" bson:"id"`
+	Data            *string `json:"data" bson:"data"`
+	Attributes      *string `json:"attributes" bson:"attributes"`
+	Reason          string  `json:"reason" bson:"reason"`
+	Error           string  `json:"error" bson:"error"`
+	Attempts        int     `json:"attempts" bson:"attempts"`
+	DeliveryAttempt *int    `json:"delivery_attempt" bson:"delivery_attempt"`
+	DeadLetterID    *string `json:"dead_letter_id" bson:"dead_letter_id"`
+	QuarantinedAt   string  `json:"quarantined_at" bson:"quarantined_at"`
+}
+
+// FromMap creates a QuarantineMessage from a map
+func (q *QuarantineMessage) FromMap(data map[string]any) {
+	if val, ok := data["id"].(string); ok {
+		q.ID = val
+	}
+	if val, ok := data["data"].(string); ok {
+		q.Data = &val
+	}
+	if val, ok := data["attributes"].(string); ok {
+		q.Attributes = &val
+	}
+	if val, ok := data["reason"].(string); ok {
+		q.Reason = val
+	}
+	if val, ok := data["error"].(string); ok {
+		q.Error = val
+	}
+	if val, ok := toInt(data["attempts"]); ok {
+		q.Attempts = val
+	}
+	if val, ok := toInt(data["delivery_attempt"]); ok {
+		q.DeliveryAttempt = &val
+	}
+	if val, ok := data["dead_letter_id"].(string); ok {
+		q.DeadLetterID = &val
+	}
+	if val, ok := data["quarantined_at"].(string); ok {
+		q.QuarantinedAt = val
+	}
+}
+
+// toBool menyeragamkan boolean dari MongoDB dan PostgreSQL (bool) maupun MySQL (TINYINT)
+func toBool(v any) (bool, bool) {
+	if b, ok := v.(bool); ok {
+		return b, true
+	}
+	if n, ok := toInt(v); ok {
+		return n != 0, true
+	}
+	return false, false
+}
+
+// toInt menyeragamkan angka dari MongoDB (int32/int64) maupun SQL (int64) dan JSON (float64)
+func toInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
 }
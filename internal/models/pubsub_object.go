@@ -4,11 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"pubsub-ckg-tb/internal/config"
+	"reflect"
 )
 
 const (
 	PUBSUB_CONSUME = iota
 	PUBSUB_PRODUCE
+	PUBSUB_RETRACT
+	PUBSUB_RESPONSE
 )
 
 // PubSubObject is the base class for CKG data objects
@@ -16,6 +19,9 @@ type PubSubObjectWrapper[T PubSubObject] struct {
 	CKGObject bool
 	Type      int
 	Data      []T `json:"data"`
+
+	// Fields berisi field tambahan pada payload selain data dan marker
+	Fields map[string]any
 }
 
 type PubSubObject interface {
@@ -23,6 +29,15 @@ type PubSubObject interface {
 	ToMap() map[string]any
 }
 
+// newPubSubObject allocates a new T, so pointer types do not end up as nil receivers
+func newPubSubObject[T PubSubObject]() T {
+	var x T
+	if rt := reflect.TypeOf(x); rt != nil && rt.Kind() == reflect.Ptr {
+		x = reflect.New(rt.Elem()).Interface().(T)
+	}
+	return x
+}
+
 func NewPubSubConsumerWrapper[T PubSubObject]() PubSubObjectWrapper[T] {
 	return PubSubObjectWrapper[T]{
 		Type: PUBSUB_CONSUME,
@@ -36,6 +51,23 @@ func NewPubSubProducerWrapper[T PubSubObject](data []T) PubSubObjectWrapper[T] {
 	}
 }
 
+// NewPubSubRetractionWrapper membungkus retraksi data skrining dengan marker MarkerRetract.
+// Dengan data nil, wrapper dipakai sisi consumer untuk membaca message retraksi.
+func NewPubSubRetractionWrapper[T PubSubObject](data []T) PubSubObjectWrapper[T] {
+	return PubSubObjectWrapper[T]{
+		Type: PUBSUB_RETRACT,
+		Data: data,
+	}
+}
+
+// NewPubSubResponseWrapper membungkus hasil proses consumer dengan marker MarkerResponse
+func NewPubSubResponseWrapper[T PubSubObject](data []T) PubSubObjectWrapper[T] {
+	return PubSubObjectWrapper[T]{
+		Type: PUBSUB_RESPONSE,
+		Data: data,
+	}
+}
+
 // FromMap creates a PubSubObject from a map
 func (t *PubSubObjectWrapper[T]) FromMap(obj map[string]any) *PubSubObjectWrapper[T] {
 	cfg := config.GetConfig()
@@ -51,6 +83,10 @@ func (t *PubSubObjectWrapper[T]) FromMap(obj map[string]any) *PubSubObjectWrappe
 		markerValueStruct = cfg.CKG.MarkerProduce
 	case PUBSUB_CONSUME:
 		markerValueStruct = cfg.CKG.MarkerConsume
+	case PUBSUB_RETRACT:
+		markerValueStruct = cfg.CKG.MarkerRetract
+	case PUBSUB_RESPONSE:
+		markerValueStruct = cfg.CKG.MarkerResponse
 	}
 
 	// Check if this is a CKG object
@@ -60,7 +96,7 @@ func (t *PubSubObjectWrapper[T]) FromMap(obj map[string]any) *PubSubObjectWrappe
 
 		if data, ok := obj["data"].([]any); ok {
 			for _, item := range data {
-				var x T
+				x := newPubSubObject[T]()
 				if dataMap, ok := item.(map[string]any); ok {
 					x.FromMap(dataMap)
 					t.Data = append(t.Data, x)
@@ -85,6 +121,9 @@ func (t *PubSubObjectWrapper[T]) FromJSON(jsonStr string) error {
 
 func (t *PubSubObjectWrapper[T]) ToMap() map[string]any {
 	data := make(map[string]any)
+	for key, value := range t.Fields {
+		data[key] = value
+	}
 
 	items := make([]any, 0)
 	for _, item := range t.Data {
@@ -101,9 +140,14 @@ func (t *PubSubObjectWrapper[T]) ToJSON() (string, error) {
 	cfg := config.GetConfig()
 
 	// Add marker field
-	if t.Type == PUBSUB_PRODUCE {
+	switch t.Type {
+	case PUBSUB_PRODUCE:
 		data[cfg.CKG.MarkerField] = cfg.CKG.MarkerProduce
-	} else {
+	case PUBSUB_RETRACT:
+		data[cfg.CKG.MarkerField] = cfg.CKG.MarkerRetract
+	case PUBSUB_RESPONSE:
+		data[cfg.CKG.MarkerField] = cfg.CKG.MarkerResponse
+	default:
 		data[cfg.CKG.MarkerField] = cfg.CKG.MarkerConsume
 	}
 
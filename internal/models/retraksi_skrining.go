@@ -0,0 +1,40 @@
+package models
+
+// Alasan retraksi data skrining
+const (
+	RetraksiAlasanDihapus      = "dihapus"       // data skrining dihapus dari CKG
+	RetraksiAlasanBukanTerduga = "bukan_terduga" // data skrining dikoreksi sehingga tidak lagi terduga TB
+)
+
+// RetraksiSkriningCKG membatalkan data skrining terduga TB yang sudah pernah dikirim ke SITB
+type RetraksiSkriningCKG struct {
+	PasienCKGID string  `json:"pasien_ckg_id"`
+	PasienNIK   *string `json:"pasien_nik"`
+	Alasan      string  `json:"alasan"`
+	RetractedAt string  `json:"retracted_at"`
+}
+
+// FromMap creates a RetraksiSkriningCKG from a map
+func (r *RetraksiSkriningCKG) FromMap(data map[string]any) {
+	if val, ok := data["pasien_ckg_id"].(string); ok {
+		r.PasienCKGID = val
+	}
+	if val, ok := data["pasien_nik"].(string); ok {
+		r.PasienNIK = &val
+	}
+	if val, ok := data["alasan"].(string); ok {
+		r.Alasan = val
+	}
+	if val, ok := data["retracted_at"].(string); ok {
+		r.RetractedAt = val
+	}
+}
+
+func (r *RetraksiSkriningCKG) ToMap() map[string]any {
+	return map[string]any{
+		"pasien_ckg_id": r.PasienCKGID,
+		"pasien_nik":    r.PasienNIK,
+		"alasan":        r.Alasan,
+		"retracted_at":  r.RetractedAt,
+	}
+}
@@ -261,6 +261,8 @@ func (s *SkriningCKGRaw) ToMap() map[string]any {
 // ToSkriningCKGResult converts SkriningCKGRaw to SkriningCKGResult
 func (s *SkriningCKGRaw) ToSkriningCKGResult() SkriningCKGResult {
 	result := SkriningCKGResult{
+		UpdatedAt: s.UpdatedAt,
+
 		// Identitas Pasien
 		PasienCKGID:        s.PasienCKGID,
 		PasienNIK:          s.PasienNIK,
@@ -372,6 +374,9 @@ type SkriningCKGResult struct {
 	HasilPemeriksaanTbTcm     *string `json:"pemeriksaan_tb_tcm"`
 	HasilPemeriksaanPoct      *string `json:"pemeriksaan_tb_poct"`
 	HasilPemeriksaanRadiologi *string `json:"pemeriksaan_tb_radiologi"`
+
+	// Waktu perubahan data skrining, dipakai untuk paging dan tidak ikut dikirim
+	UpdatedAt string `json:"-"`
 }
 
 type SkriningCKGOutput struct {
@@ -19,6 +19,10 @@ type StatusPasien struct {
 	TanggalMulaiPengobatan   *string `json:"tanggal_mulai_pengobatan" bson:"tanggal_mulai_pengobatan"`
 	TanggalSelesaiPengobatan *string `json:"tanggal_selesai_pengobatan" bson:"tanggal_selesai_pengobatan"`
 	HasilAkhir               *string `json:"hasil_akhir" bson:"hasil_akhir"` // ["Sembuh", "Pengobatan Lengkap", "Pengobatan Gagal", "Meninggal", "Putus berobat (lost to follow up)", "Tidak dievaluasi/pindah", "Gagal karena Perubahan Diagnosis"]
+
+	// Waktu perubahan status di SITB (field sitb_updated_at pada payload), dipakai untuk menolak status yang lebih lama
+	// dari status tersimpan saat message diterima tidak berurutan
+	SitbUpdatedAt *string `json:"sitb_updated_at" bson:"sitb_updated_at"`
 }
 
 type StatusPasienResult struct {
@@ -30,6 +34,39 @@ type StatusPasienResult struct {
 	Respons     string  `json:"message"`       // pesan respon pemrosesan
 }
 
+// FromMap creates a StatusPasienResult from a map
+func (s *StatusPasienResult) FromMap(data map[string]any) {
+	if val, ok := data["pasien_ckg_id"].(string); ok {
+		s.PasienCkgID = &val
+	}
+	if val, ok := data["terduga_id"].(string); ok {
+		s.TerdugaID = &val
+	}
+	if val, ok := data["pasien_tb_id"].(string); ok {
+		s.PasienTbID = &val
+	}
+	if val, ok := data["pasien_nik"].(string); ok {
+		s.PasienNIK = &val
+	}
+	if val, ok := data["error"].(bool); ok {
+		s.IsError = val
+	}
+	if val, ok := data["message"].(string); ok {
+		s.Respons = val
+	}
+}
+
+func (s *StatusPasienResult) ToMap() map[string]any {
+	return map[string]any{
+		"pasien_ckg_id": s.PasienCkgID,
+		"terduga_id":    s.TerdugaID,
+		"pasien_tb_id":  s.PasienTbID,
+		"pasien_nik":    s.PasienNIK,
+		"error":         s.IsError,
+		"message":       s.Respons,
+	}
+}
+
 // NewStatusPasien creates a new StatusPasien instance
 func NewStatusPasien() *StatusPasien {
 	return &StatusPasien{}
@@ -69,6 +106,9 @@ func (s *StatusPasien) FromMap(data map[string]any) {
 	if val, ok := data["hasil_akhir"].(string); ok {
 		s.HasilAkhir = &val
 	}
+	if val, ok := data["sitb_updated_at"].(string); ok && val != "" {
+		s.SitbUpdatedAt = &val
+	}
 }
 
 func (s *StatusPasien) ToMap() map[string]any {
@@ -83,7 +123,121 @@ func (s *StatusPasien) ToMap() map[string]any {
 		"tanggal_mulai_pengobatan":   s.TanggalMulaiPengobatan,
 		"tanggal_selesai_pengobatan": s.TanggalSelesaiPengobatan,
 		"hasil_akhir":                s.HasilAkhir,
+		"sitb_updated_at":            s.SitbUpdatedAt,
 	}
 
 	return result
 }
+
+// statusHistoryFields adalah field status pasien yang dicatat pada riwayat status
+var statusHistoryFields = []string{
+	"pasien_tb_id",
+	"status_diagnosa",
+	"diagnosa_lab_hasil_tcm",
+	"diagnosa_lab_hasil_bta",
+	"tanggal_mulai_pengobatan",
+	"tanggal_selesai_pengobatan",
+	"hasil_akhir",
+}
+
+// StatusPasienHistory mencatat satu perubahan field status pasien yang diterima dari SITB
+type StatusPasienHistory struct {
+	PasienCkgID   *string `json:"pasien_ckg_id" bson:"pasien_ckg_id"`
+	TerdugaID     *string `json:"terduga_id" bson:"terduga_id"`
+	PasienTbID    *string `json:"pasien_tb_id" bson:"pasien_tb_id"`
+	PasienNIK     *string `json:"pasien_nik" bson:"pasien_nik"`
+	Field         string  `json:"field" bson:"field"`
+	PreviousValue *string `json:"previous_value" bson:"previous_value"`
+	NewValue      *string `json:"new_value" bson:"new_value"`
+	MessageID     string  `json:"message_id" bson:"message_id"`
+	ChangedAt     string  `json:"changed_at" bson:"changed_at"`
+}
+
+// NewStatusPasienHistory membandingkan status sebelumnya (nil untuk status baru) dengan status baru dan
+// mengembalikan satu riwayat untuk setiap field yang berubah. Identitas pasien yang tidak dikirim pada
+// status baru diambil dari status sebelumnya.
+func NewStatusPasienHistory(previous *StatusPasien, current StatusPasien, messageID string, changedAt string) []StatusPasienHistory {
+	identity := current
+	previousValues := map[string]any{}
+	if previous != nil {
+		identity.PasienCkgID = firstNotEmpty(current.PasienCkgID, previous.PasienCkgID)
+		identity.TerdugaID = firstNotEmpty(current.TerdugaID, previous.TerdugaID)
+		identity.PasienTbID = firstNotEmpty(current.PasienTbID, previous.PasienTbID)
+		identity.PasienNIK = firstNotEmpty(current.PasienNIK, previous.PasienNIK)
+		previousValues = previous.ToMap()
+	}
+	currentValues := current.ToMap()
+
+	histories := []StatusPasienHistory{}
+	for _, field := range statusHistoryFields {
+		previousValue := emptyToNil(previousValues[field])
+		newValue := emptyToNil(currentValues[field])
+		if previousValue == nil && newValue == nil {
+			continue
+		}
+		if previousValue != nil && newValue != nil && *previousValue == *newValue {
+			continue
+		}
+
+		histories = append(histories, StatusPasienHistory{
+			PasienCkgID:   identity.PasienCkgID,
+			TerdugaID:     identity.TerdugaID,
+			PasienTbID:    identity.PasienTbID,
+			PasienNIK:     identity.PasienNIK,
+			Field:         field,
+			PreviousValue: previousValue,
+			NewValue:      newValue,
+			MessageID:     messageID,
+			ChangedAt:     changedAt,
+		})
+	}
+
+	return histories
+}
+
+// FromMap creates a StatusPasienHistory from a map
+func (h *StatusPasienHistory) FromMap(data map[string]any) {
+	if val, ok := data["pasien_ckg_id"].(string); ok {
+		h.PasienCkgID = &val
+	}
+	if val, ok := data["terduga_id"].(string); ok {
+		h.TerdugaID = &val
+	}
+	if val, ok := data["pasien_tb_id"].(string); ok {
+		h.PasienTbID = &val
+	}
+	if val, ok := data["pasien_nik"].(string); ok {
+		h.PasienNIK = &val
+	}
+	if val, ok := data["field"].(string); ok {
+		h.Field = val
+	}
+	if val, ok := data["previous_value"].(string); ok {
+		h.PreviousValue = &val
+	}
+	if val, ok := data["new_value"].(string); ok {
+		h.NewValue = &val
+	}
+	if val, ok := data["message_id"].(string); ok {
+		h.MessageID = val
+	}
+	if val, ok := data["changed_at"].(string); ok {
+		h.ChangedAt = val
+	}
+}
+
+func firstNotEmpty(values ...*string) *string {
+	for _, value := range values {
+		if value != nil && *value != "" {
+			return value
+		}
+	}
+	return nil
+}
+
+func emptyToNil(value any) *string {
+	if val, ok := value.(*string); ok && val != nil && *val != "" {
+		return val
+	}
+	return nil
+}
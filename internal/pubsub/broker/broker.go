@@ -0,0 +1,86 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrUnsettled is returned by a receiver that keeps the messages to settle them itself later,
+// the consumer then neither acks nor nacks them
+var ErrUnsettled = errors.New("messages left unsettled by the receiver")
+
+// Message is a transport independent representation of a Pub/Sub message
+type Message struct {
+	ID              string
+	Data            []byte
+	Attributes      map[string]string
+	OrderingKey     string
+	PublishTime     time.Time
+	DeliveryAttempt *int
+
+	ack  func()
+	nack func()
+}
+
+// WithAckHandler attaches the backend specific ack/nack functions to the message
+func (m *Message) WithAckHandler(ack func(), nack func()) *Message {
+	m.ack = ack
+	m.nack = nack
+	return m
+}
+
+// Ack acknowledges the message so the broker will not redeliver it
+func (m *Message) Ack() {
+	if m.ack != nil {
+		m.ack()
+	}
+}
+
+// Nack tells the broker that the message was not processed and should be redelivered
+func (m *Message) Nack() {
+	if m.nack != nil {
+		m.nack()
+	}
+}
+
+// ReceiveSettings controls how many messages a broker keeps outstanding while receiving
+type ReceiveSettings struct {
+	MaxOutstandingMessages int
+	MaxOutstandingBytes    int
+}
+
+// PublishResult is the pending outcome of an asynchronous publish
+type PublishResult interface {
+	// Get blocks until the message is published and returns the server generated message ID
+	Get(ctx context.Context) (string, error)
+}
+
+// Handler is called by the broker for every received message
+type Handler func(ctx context.Context, msg *Message)
+
+// Broker abstracts the messaging transport used by the producer and consumer
+type Broker interface {
+	GetName() string
+
+	// Publish sends a message to the topic and returns the server generated message ID
+	Publish(ctx context.Context, topic string, msg *Message) (string, error)
+
+	// PublishAsync queues a message on the long-lived publisher of the topic and returns
+	// immediately, messages are sent in batches according to the publish settings
+	PublishAsync(ctx context.Context, topic string, msg *Message) PublishResult
+
+	// ResumePublish resumes an ordering key of the topic that was paused by a failed publish.
+	// Later messages with the key are rejected until then, so call it when the failed message
+	// is sent again or given up.
+	ResumePublish(topic string, orderingKey string)
+
+	// Receive blocks and calls handler for each message of the subscription until ctx is done
+	Receive(ctx context.Context, subscription string, settings ReceiveSettings, handler Handler) error
+
+	// Topic and subscription administration
+	TopicExists(ctx context.Context, topic string) bool
+	SubscriptionExists(ctx context.Context, subscription string) bool
+
+	Close() error
+}
@@ -0,0 +1,48 @@
+package broker
+
+import (
+	"context"
+	"sync"
+)
+
+// PublishOutcome is the result of one message of a bulk publish
+type PublishOutcome struct {
+	ID  string
+	Err error
+}
+
+// PublishAll publishes the messages concurrently with at most maxInFlight publishes waiting for
+// their result, and returns one outcome per message in the same order as messages.
+// Once ctx is done no new message is queued, the remaining messages get ctx.Err(). Results of
+// queued messages are still awaited so a message that reached the broker is reported with its ID.
+func PublishAll(ctx context.Context, b Broker, topic string, messages []*Message, maxInFlight int) []PublishOutcome {
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+
+	outcomes := make([]PublishOutcome, len(messages))
+	inFlight := make(chan struct{}, maxInFlight)
+	var wg sync.WaitGroup
+
+	for i, msg := range messages {
+		select {
+		case inFlight <- struct{}{}:
+		case <-ctx.Done():
+			outcomes[i].Err = ctx.Err()
+			continue
+		}
+
+		result := b.PublishAsync(ctx, topic, msg)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+
+			id, err := result.Get(context.WithoutCancel(ctx))
+			outcomes[i] = PublishOutcome{ID: id, Err: err}
+		}()
+	}
+
+	wg.Wait()
+	return outcomes
+}
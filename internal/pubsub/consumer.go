@@ -2,62 +2,175 @@ package pubsub
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"cloud.google.com/go/pubsub/v2"
+	"pubsub-ckg-tb/internal/pubsub/broker"
 )
 
 type Receiver interface {
-	Consume(ctx context.Context, messages []*pubsub.Message) (map[string]bool, error)
+	Consume(ctx context.Context, messages []*broker.Message) (map[string]bool, error)
+}
+
+// Stopper is implemented by receivers that can end the consumer themselves,
+// the consumer stops receiving once Done is closed
+type Stopper interface {
+	Done() <-chan struct{}
 }
 
 func (c *Client) StartConsumer(ctx context.Context, receiver Receiver) {
 	c.Receiver = receiver
+	cfg := c.Config.Consumer
 
-	// Create a context that can be cancelled
+	// Create a context that can be cancelled, it only stops receiving new messages
 	consumerCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	// Workers keep their own context so in-flight messages can finish during drain
+	workerCtx, cancelWorkers := context.WithCancel(ctx)
+	defer cancelWorkers()
+
 	// Set up signal handling for graceful shutdown
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signalChan)
 
-	slog.Info("Starting message consumer...")
+	var receiverDone <-chan struct{}
+	if stopper, ok := receiver.(Stopper); ok {
+		receiverDone = stopper.Done()
+	}
 
-	// Main consumer loop
-	for {
+	go func() {
 		select {
-		case <-consumerCtx.Done():
-			slog.Info("Consumer context cancelled, shutting down...")
-			return
 		case <-signalChan:
 			slog.Info("Received termination signal, shutting down...")
-			return
-		default:
-			// Pull messages from PubSub
-			messages, err := c.PullMessages(consumerCtx, c.Config.Consumer.MaxMessagesPerPull)
-			if err != nil {
-				slog.Error("Error pulling messages", "error", err)
-				// Wait before retrying
-				time.Sleep(c.Config.Consumer.SleepTimeBetweenPulls)
-				continue
+			cancel()
+		case <-receiverDone:
+			slog.Info("Receiver is done, shutting down...")
+			cancel()
+		case <-consumerCtx.Done():
+		}
+	}()
+
+	slog.Info("Starting message consumer...",
+		"workers", cfg.FlowControl.Workers,
+		"queue", cfg.FlowControl.QueueSize)
+
+	c.pool = newWorkerPool(cfg.FlowControl.Workers, cfg.FlowControl.QueueSize)
+	c.pool.start(workerCtx, c.processMessage)
+
+	settings := broker.ReceiveSettings{
+		MaxOutstandingMessages: cfg.MaxMessagesPerPull,
+	}
+	if cfg.FlowControl.Enabled {
+		settings.MaxOutstandingMessages = cfg.FlowControl.MaxOutstandingMessages
+		settings.MaxOutstandingBytes = int(cfg.FlowControl.MaxOutstandingBytes)
+	}
+
+	// Main consumer loop, Receive only returns on shutdown or on a non-retryable error
+	receiveDone := make(chan struct{})
+	go func() {
+		defer close(receiveDone)
+		for consumerCtx.Err() == nil {
+			err := c.Broker.Receive(consumerCtx, c.Subscription, settings, c.handleMessage)
+			if err != nil && consumerCtx.Err() == nil {
+				slog.Error("Error receiving messages", "error", err)
 			}
 
-			if len(messages) == 0 {
-				// No messages received, wait before pulling again
-				time.Sleep(c.Config.Consumer.SleepTimeBetweenPulls)
-				continue
+			// Wait before opening a new stream
+			select {
+			case <-consumerCtx.Done():
+			case <-time.After(cfg.SleepTimeBetweenPulls):
 			}
+		}
+	}()
 
-			slog.Debug("Received messages", "count", len(messages))
+	<-consumerCtx.Done()
+	slog.Info("Consumer context cancelled, draining in-flight messages...", "timeout", cfg.DrainTimeout)
+	c.drain(receiveDone, cancelWorkers, cfg.DrainTimeout)
+}
 
-			if c.Receiver != nil {
-				go c.Receiver.Consume(ctx, messages)
-			}
+// workerStopTimeout bounds how long drain waits for the workers after cancelling them
+const workerStopTimeout = 5 * time.Second
+
+// drain waits for queued and in-flight messages up to timeout, then cancels the workers and
+// waits up to workerStopTimeout for them to return, so the caller does not close the database
+// and broker while a worker still uses them. Messages that were not settled in time are
+// redelivered by the broker.
+func (c *Client) drain(receiveDone <-chan struct{}, cancelWorkers context.CancelFunc, timeout time.Duration) {
+	drained := make(chan struct{})
+	go func() {
+		// The queue can only be closed once no handler is submitting anymore
+		<-receiveDone
+		c.pool.stop()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		slog.Info("Consumer stopped gracefully")
+	case <-time.After(timeout):
+		slog.Warn("Drain timeout reached, cancelling in-flight messages")
+		cancelWorkers()
+
+		select {
+		case <-drained:
+			slog.Info("Consumer stopped after cancelling in-flight messages")
+		case <-time.After(workerStopTimeout):
+			slog.Error("Workers did not stop after cancellation", "timeout", workerStopTimeout)
+		}
+	}
+}
+
+// handleMessage queues a message into the worker pool and waits until it is processed.
+// Blocking here keeps the message outstanding so the broker applies flow control.
+func (c *Client) handleMessage(ctx context.Context, msg *broker.Message) {
+	done := c.pool.submit(ctx, msg)
+	if done == nil {
+		// Shutting down before the message got a slot, let the broker redeliver it
+		msg.Nack()
+		return
+	}
+	<-done
+}
+
+// processMessage hands a single message to the receiver and settles it based on the result
+func (c *Client) processMessage(ctx context.Context, msg *broker.Message) {
+	if c.Receiver == nil || ctx.Err() != nil {
+		msg.Nack()
+		return
+	}
+
+	messages := []*broker.Message{msg}
+	results, err := c.Receiver.Consume(ctx, messages)
+	settleMessages(messages, results, err)
+}
+
+// settleMessages acks successfully processed messages and nacks failed ones so the broker redelivers them.
+// Messages missing from results were skipped by the receiver (duplicate, non-CKG or unparseable) and are acked.
+// On ErrUnsettled the receiver settles the messages itself.
+func settleMessages(messages []*broker.Message, results map[string]bool, err error) {
+	if errors.Is(err, broker.ErrUnsettled) {
+		return
+	}
+
+	for _, msg := range messages {
+		if err != nil {
+			slog.Error("Gagal memproses message", "id", msg.ID, "error", err)
+			msg.Nack()
+			continue
+		}
+
+		if ok, found := results[msg.ID]; found && !ok {
+			slog.Debug("Nack message", "id", msg.ID)
+			msg.Nack()
+			continue
 		}
+
+		msg.Ack()
 	}
 }
@@ -0,0 +1,307 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pubsub-ckg-tb/internal/config"
+	"pubsub-ckg-tb/internal/pubsub/broker"
+)
+
+// fakeBroker delivers its messages concurrently on the first Receive call, like a streaming pull,
+// and returns once ctx is done and every handler returned
+type fakeBroker struct {
+	messages  []*broker.Message
+	delivered atomic.Bool
+}
+
+func (b *fakeBroker) GetName() string { return "fake" }
+
+func (b *fakeBroker) Publish(ctx context.Context, topic string, msg *broker.Message) (string, error) {
+	return "", errors.New("not supported")
+}
+
+func (b *fakeBroker) PublishAsync(ctx context.Context, topic string, msg *broker.Message) broker.PublishResult {
+	return nil
+}
+
+func (b *fakeBroker) Receive(ctx context.Context, subscription string, settings broker.ReceiveSettings, handler broker.Handler) error {
+	var wg sync.WaitGroup
+	if !b.delivered.Swap(true) {
+		for _, msg := range b.messages {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				handler(ctx, msg)
+			}()
+		}
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+	return nil
+}
+
+func (b *fakeBroker) ResumePublish(topic string, orderingKey string) {}
+
+func (b *fakeBroker) TopicExists(ctx context.Context, topic string) bool { return true }
+
+func (b *fakeBroker) SubscriptionExists(ctx context.Context, subscription string) bool { return true }
+
+func (b *fakeBroker) Close() error { return nil }
+
+// settlement records how a message was settled
+type settlement struct {
+	mu    sync.Mutex
+	acks  map[string]int
+	nacks map[string]int
+}
+
+func newSettlement() *settlement {
+	return &settlement{acks: map[string]int{}, nacks: map[string]int{}}
+}
+
+func (s *settlement) message(id string) *broker.Message {
+	msg := &broker.Message{ID: id}
+	return msg.WithAckHandler(
+		func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.acks[id]++
+		},
+		func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.nacks[id]++
+		},
+	)
+}
+
+func (s *settlement) counts(id string) (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.acks[id], s.nacks[id]
+}
+
+// fakeReceiver fails the messages in failed, tracks how many messages it processes at once and
+// closes Done once stopAfter messages were processed
+type fakeReceiver struct {
+	failed    map[string]bool
+	err       error
+	delay     time.Duration
+	stopAfter int32
+
+	processed atomic.Int32
+	running   atomic.Int32
+	peak      atomic.Int32
+	done      chan struct{}
+	doneOnce  sync.Once
+}
+
+func newFakeReceiver(stopAfter int) *fakeReceiver {
+	return &fakeReceiver{
+		failed:    map[string]bool{},
+		stopAfter: int32(stopAfter),
+		done:      make(chan struct{}),
+	}
+}
+
+func (r *fakeReceiver) Consume(ctx context.Context, messages []*broker.Message) (map[string]bool, error) {
+	running := r.running.Add(1)
+	defer r.running.Add(-1)
+	for {
+		peak := r.peak.Load()
+		if running <= peak || r.peak.CompareAndSwap(peak, running) {
+			break
+		}
+	}
+
+	time.Sleep(r.delay)
+
+	results := map[string]bool{}
+	for _, msg := range messages {
+		if r.failed[msg.ID] {
+			results[msg.ID] = false
+		}
+	}
+
+	if r.processed.Add(int32(len(messages))) >= r.stopAfter {
+		r.doneOnce.Do(func() { close(r.done) })
+	}
+	return results, r.err
+}
+
+func (r *fakeReceiver) Done() <-chan struct{} {
+	return r.done
+}
+
+func testConfig(workers int, queueSize int) *config.Configurations {
+	return &config.Configurations{
+		Consumer: config.ConsumerConfig{
+			SleepTimeBetweenPulls: 10 * time.Millisecond,
+			DrainTimeout:          time.Second,
+			FlowControl: config.FlowControlConfig{
+				Workers:   workers,
+				QueueSize: queueSize,
+			},
+		},
+	}
+}
+
+func TestSettleMessages(t *testing.T) {
+	tests := []struct {
+		name      string
+		results   map[string]bool
+		err       error
+		wantAcks  int
+		wantNacks int
+	}{
+		{"succeeded", map[string]bool{"m1": true}, nil, 1, 0},
+		{"skipped by the receiver", map[string]bool{}, nil, 1, 0},
+		{"failed", map[string]bool{"m1": false}, nil, 0, 1},
+		{"error", map[string]bool{"m1": true}, errors.New("db down"), 0, 1},
+		{"unsettled", nil, broker.ErrUnsettled, 0, 0},
+		{"wrapped unsettled", nil, fmt.Errorf("dry-run: %w", broker.ErrUnsettled), 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSettlement()
+			settleMessages([]*broker.Message{s.message("m1")}, tt.results, tt.err)
+
+			acks, nacks := s.counts("m1")
+			if acks != tt.wantAcks || nacks != tt.wantNacks {
+				t.Fatalf("acks = %d, nacks = %d, want %d, %d", acks, nacks, tt.wantAcks, tt.wantNacks)
+			}
+		})
+	}
+}
+
+func TestHandleMessageNacksWhenShuttingDown(t *testing.T) {
+	// Without workers and queue the message never gets a slot
+	c := &Client{pool: newWorkerPool(1, 0)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := newSettlement()
+	c.handleMessage(ctx, s.message("m1"))
+
+	if acks, nacks := s.counts("m1"); acks != 0 || nacks != 1 {
+		t.Fatalf("acks = %d, nacks = %d, want 0, 1", acks, nacks)
+	}
+}
+
+func TestProcessMessageWithoutReceiver(t *testing.T) {
+	c := &Client{}
+	s := newSettlement()
+	c.processMessage(context.Background(), s.message("m1"))
+
+	if acks, nacks := s.counts("m1"); acks != 0 || nacks != 1 {
+		t.Fatalf("acks = %d, nacks = %d, want 0, 1", acks, nacks)
+	}
+}
+
+func TestStartConsumerSettlesEveryMessage(t *testing.T) {
+	const total = 20
+	s := newSettlement()
+	b := &fakeBroker{}
+	for i := range total {
+		b.messages = append(b.messages, s.message(fmt.Sprintf("m%d", i)))
+	}
+
+	receiver := newFakeReceiver(total)
+	receiver.delay = 5 * time.Millisecond
+	receiver.failed["m3"] = true
+	receiver.failed["m7"] = true
+
+	c := NewClientWithBroker(testConfig(3, 2), b)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		c.StartConsumer(context.Background(), receiver)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("consumer did not stop after the receiver was done")
+	}
+
+	for _, msg := range b.messages {
+		acks, nacks := s.counts(msg.ID)
+		if receiver.failed[msg.ID] {
+			if acks != 0 || nacks != 1 {
+				t.Errorf("%s: acks = %d, nacks = %d, want 0, 1", msg.ID, acks, nacks)
+			}
+			continue
+		}
+		if acks != 1 || nacks != 0 {
+			t.Errorf("%s: acks = %d, nacks = %d, want 1, 0", msg.ID, acks, nacks)
+		}
+	}
+
+	if peak := receiver.peak.Load(); peak > 3 {
+		t.Errorf("receiver ran %d messages at once, want at most 3 workers", peak)
+	}
+}
+
+func TestStartConsumerLeavesUnsettledMessages(t *testing.T) {
+	s := newSettlement()
+	b := &fakeBroker{messages: []*broker.Message{s.message("m1"), s.message("m2")}}
+
+	receiver := newFakeReceiver(2)
+	receiver.err = broker.ErrUnsettled
+
+	c := NewClientWithBroker(testConfig(2, 0), b)
+	c.StartConsumer(context.Background(), receiver)
+
+	for _, msg := range b.messages {
+		if acks, nacks := s.counts(msg.ID); acks != 0 || nacks != 0 {
+			t.Errorf("%s: acks = %d, nacks = %d, want 0, 0", msg.ID, acks, nacks)
+		}
+	}
+}
+
+// blockingReceiver blocks every message until its context is cancelled
+type blockingReceiver struct {
+	started  chan struct{}
+	once     sync.Once
+	finished atomic.Int32
+}
+
+func (r *blockingReceiver) Consume(ctx context.Context, messages []*broker.Message) (map[string]bool, error) {
+	r.once.Do(func() { close(r.started) })
+	<-ctx.Done()
+
+	// Cleanup after cancellation, e.g. recording the failure in the database
+	time.Sleep(50 * time.Millisecond)
+	r.finished.Add(1)
+	return nil, ctx.Err()
+}
+
+func (r *blockingReceiver) Done() <-chan struct{} {
+	return r.started
+}
+
+func TestStartConsumerWaitsForCancelledWorkers(t *testing.T) {
+	s := newSettlement()
+	b := &fakeBroker{messages: []*broker.Message{s.message("m1")}}
+	receiver := &blockingReceiver{started: make(chan struct{})}
+
+	cfg := testConfig(1, 0)
+	cfg.Consumer.DrainTimeout = 20 * time.Millisecond
+	c := NewClientWithBroker(cfg, b)
+	c.StartConsumer(context.Background(), receiver)
+
+	if receiver.finished.Load() != 1 {
+		t.Fatal("consumer returned while a worker was still processing")
+	}
+	if acks, nacks := s.counts("m1"); acks != 0 || nacks != 1 {
+		t.Fatalf("acks = %d, nacks = %d, want 0, 1", acks, nacks)
+	}
+}
@@ -0,0 +1,268 @@
+package google
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"pubsub-ckg-tb/internal/config"
+	"pubsub-ckg-tb/internal/pubsub/broker"
+
+	"cloud.google.com/go/pubsub/v2"
+	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// GoogleBroker implements broker.Broker for Google Cloud Pub/Sub
+type GoogleBroker struct {
+	client    *pubsub.Client
+	projectID string
+
+	// Publishers are long-lived per topic so messages are batched and ordering keys are honored
+	publishSettings pubsub.PublishSettings
+	ordering        bool
+	publishers      map[string]*pubsub.Publisher
+	mu              sync.Mutex
+}
+
+func NewBroker(ctx context.Context, cfg *config.Configurations) (broker.Broker, error) {
+	// Set credentials if file exists
+	var opts []option.ClientOption
+	if cfg.GoogleCloud.CredentialsPath != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.GoogleCloud.CredentialsPath))
+	}
+
+	// Create pubsub client
+	client, err := pubsub.NewClient(ctx, cfg.GoogleCloud.ProjectID, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pubsub client: %v", err)
+	}
+
+	slog.Debug("PubSub client initialized for",
+		"project", cfg.GoogleCloud.ProjectID,
+		"topic", cfg.PubSub.Topic,
+		"subscription", cfg.PubSub.Subscription)
+
+	return &GoogleBroker{
+		client:          client,
+		projectID:       cfg.GoogleCloud.ProjectID,
+		publishSettings: publishSettings(cfg.Producer.Publish),
+		ordering:        cfg.MessageOrdering(),
+		publishers:      make(map[string]*pubsub.Publisher),
+	}, nil
+}
+
+// publishSettings applies the configured batching thresholds on top of the library defaults
+func publishSettings(cfg config.PublishConfig) pubsub.PublishSettings {
+	settings := pubsub.DefaultPublishSettings
+	if cfg.DelayThreshold > 0 {
+		settings.DelayThreshold = cfg.DelayThreshold
+	}
+	if cfg.CountThreshold > 0 {
+		settings.CountThreshold = cfg.CountThreshold
+	}
+	if cfg.ByteThreshold > 0 {
+		settings.ByteThreshold = cfg.ByteThreshold
+	}
+	if cfg.Timeout > 0 {
+		settings.Timeout = cfg.Timeout
+	}
+	return settings
+}
+
+func (g *GoogleBroker) GetName() string {
+	return "Google Pub/Sub"
+}
+
+// Close flushes and stops all publishers before closing the client
+func (g *GoogleBroker) Close() error {
+	g.mu.Lock()
+	for topic, publisher := range g.publishers {
+		publisher.Stop()
+		delete(g.publishers, topic)
+	}
+	g.mu.Unlock()
+
+	return g.client.Close()
+}
+
+// TopicExists checks if the topic exists
+func (g *GoogleBroker) TopicExists(ctx context.Context, topic string) bool {
+	return g.GetTopicInfo(ctx, topic) != nil
+}
+
+// SubscriptionExists checks if the subscription exists
+func (g *GoogleBroker) SubscriptionExists(ctx context.Context, subscription string) bool {
+	return g.GetSubscriptionInfo(ctx, subscription) != nil
+}
+
+// GetTopicInfo returns information about the topic
+func (g *GoogleBroker) GetTopicInfo(ctx context.Context, topic string) *pubsubpb.Topic {
+	req := &pubsubpb.ListTopicsRequest{
+		Project: fmt.Sprintf("projects/%s", g.projectID),
+	}
+	it := g.client.TopicAdminClient.ListTopics(ctx, req)
+	for {
+		t, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			continue
+		}
+
+		slog.Debug("Found topic", "name", t.Name)
+		if t.Name == g.fullName("topics", topic) {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// GetSubscriptionInfo returns information about the subscription
+func (g *GoogleBroker) GetSubscriptionInfo(ctx context.Context, subscription string) *pubsubpb.Subscription {
+	exists := g.ListSubscriptions(ctx)
+
+	for _, sub := range exists {
+		if sub != nil && sub.Name == g.fullName("subscriptions", subscription) {
+			return sub
+		}
+	}
+
+	return nil
+}
+
+// ListSubscriptions lists all subscriptions for this project
+func (g *GoogleBroker) ListSubscriptions(ctx context.Context) []*pubsubpb.Subscription {
+	var subs []*pubsubpb.Subscription
+	req := &pubsubpb.ListSubscriptionsRequest{
+		Project: fmt.Sprintf("projects/%s", g.projectID),
+	}
+	it := g.client.SubscriptionAdminClient.ListSubscriptions(ctx, req)
+	for {
+		s, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			continue
+		}
+		subs = append(subs, s)
+	}
+	return subs
+}
+
+// Publish publishes a message to the topic
+func (g *GoogleBroker) Publish(ctx context.Context, topic string, msg *broker.Message) (string, error) {
+	// Block until the result is returned and a server-generated
+	// ID is returned for the published message.
+	return g.PublishAsync(ctx, topic, msg).Get(ctx)
+}
+
+// PublishAsync queues a message on the topic publisher, the publisher sends it in a batch
+// once one of the thresholds in the publish settings is reached
+func (g *GoogleBroker) PublishAsync(ctx context.Context, topic string, msg *broker.Message) broker.PublishResult {
+	publisher := g.publisher(topic)
+
+	// Ordering keys are rejected by a publisher without message ordering
+	orderingKey := msg.OrderingKey
+	if !g.ordering {
+		orderingKey = ""
+	}
+
+	result := publisher.Publish(ctx, &pubsub.Message{
+		Data:        msg.Data,
+		Attributes:  msg.Attributes,
+		OrderingKey: orderingKey,
+	})
+
+	return &publishResult{
+		result: result,
+	}
+}
+
+// ResumePublish resumes an ordering key paused by a failed publish
+func (g *GoogleBroker) ResumePublish(topic string, orderingKey string) {
+	if !g.ordering || orderingKey == "" {
+		return
+	}
+	g.publisher(topic).ResumePublish(orderingKey)
+}
+
+// publisher returns the long-lived publisher of the topic, creating it on first use
+func (g *GoogleBroker) publisher(topic string) *pubsub.Publisher {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if publisher, ok := g.publishers[topic]; ok {
+		return publisher
+	}
+
+	publisher := g.client.Publisher(topic)
+	publisher.PublishSettings = g.publishSettings
+	publisher.EnableMessageOrdering = g.ordering
+	g.publishers[topic] = publisher
+
+	slog.Debug("Publisher created",
+		"topic", topic,
+		"ordering", g.ordering,
+		"delay_threshold", g.publishSettings.DelayThreshold,
+		"count_threshold", g.publishSettings.CountThreshold,
+		"byte_threshold", g.publishSettings.ByteThreshold)
+	return publisher
+}
+
+// publishResult wraps the library result. A failed publish pauses its ordering key, the key stays
+// paused until the caller resumes it with ResumePublish so later messages are not sent out of order.
+type publishResult struct {
+	result *pubsub.PublishResult
+}
+
+func (r *publishResult) Get(ctx context.Context) (string, error) {
+	msgID, err := r.result.Get(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to publish message: %v", err)
+	}
+
+	slog.Debug("Published message with", "msgID", msgID)
+	return msgID, nil
+}
+
+// Receive streams messages from the subscription until ctx is done
+func (g *GoogleBroker) Receive(ctx context.Context, subscription string, settings broker.ReceiveSettings, handler broker.Handler) error {
+	subscriber := g.client.Subscriber(subscription)
+	if settings.MaxOutstandingMessages != 0 {
+		subscriber.ReceiveSettings.MaxOutstandingMessages = settings.MaxOutstandingMessages
+	}
+	if settings.MaxOutstandingBytes != 0 {
+		subscriber.ReceiveSettings.MaxOutstandingBytes = settings.MaxOutstandingBytes
+	}
+
+	err := subscriber.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+		msg := &broker.Message{
+			ID:              m.ID,
+			Data:            m.Data,
+			Attributes:      m.Attributes,
+			OrderingKey:     m.OrderingKey,
+			PublishTime:     m.PublishTime,
+			DeliveryAttempt: m.DeliveryAttempt,
+		}
+		handler(ctx, msg.WithAckHandler(m.Ack, m.Nack))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to receive messages: %v", err)
+	}
+
+	return nil
+}
+
+// fullName returns the fully qualified resource name, accepting both short IDs and full names
+func (g *GoogleBroker) fullName(kind string, nameOrID string) string {
+	if strings.HasPrefix(nameOrID, "projects/") {
+		return nameOrID
+	}
+	return fmt.Sprintf("projects/%s/%s/%s", g.projectID, kind, nameOrID)
+}
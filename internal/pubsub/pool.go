@@ -0,0 +1,70 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+
+	"pubsub-ckg-tb/internal/pubsub/broker"
+)
+
+type poolJob struct {
+	msg  *broker.Message
+	done chan struct{}
+}
+
+// workerPool processes received messages with a fixed number of workers and a bounded queue
+type workerPool struct {
+	size int
+	jobs chan *poolJob
+	wg   sync.WaitGroup
+}
+
+func newWorkerPool(size int, queueSize int) *workerPool {
+	if size <= 0 {
+		size = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	return &workerPool{
+		size: size,
+		jobs: make(chan *poolJob, queueSize),
+	}
+}
+
+// start runs the workers, each job is handed to fn and marked done afterwards
+func (p *workerPool) start(ctx context.Context, fn func(ctx context.Context, msg *broker.Message)) {
+	p.wg.Add(p.size)
+	for range p.size {
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				fn(ctx, job.msg)
+				close(job.done)
+			}
+		}()
+	}
+}
+
+// submit queues a message and blocks while the queue is full (backpressure).
+// It returns nil if ctx is done before the message could be queued.
+func (p *workerPool) submit(ctx context.Context, msg *broker.Message) chan struct{} {
+	job := &poolJob{
+		msg:  msg,
+		done: make(chan struct{}),
+	}
+
+	select {
+	case p.jobs <- job:
+		return job.done
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// stop closes the queue and waits until all queued and in-flight jobs are finished
+func (p *workerPool) stop() {
+	close(p.jobs)
+	p.wg.Wait()
+}
@@ -27,6 +27,9 @@ func (c *Client) StartProducer(ctx context.Context, transmitter Transmitter, wat
 	if c.Transmitter != nil {
 		// Start the transmitter in a goroutine
 		go func() {
+			// Mode one-time selesai setelah Produce kembali
+			defer cancel()
+
 			slog.Info("Starting message producer...")
 			if watchMode {
 				c.Transmitter.Watch(producerCtx)
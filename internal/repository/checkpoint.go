@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"pubsub-ckg-tb/internal/config"
+	"pubsub-ckg-tb/internal/db/connection"
+	"pubsub-ckg-tb/internal/db/dbtypes"
+	"pubsub-ckg-tb/internal/db/utils"
+	"pubsub-ckg-tb/internal/models"
+)
+
+type Checkpoint interface {
+	GetCheckpoint(id string) (*models.Checkpoint, error)
+	SaveCheckpoint(checkpoint models.Checkpoint) error
+}
+
+type CheckpointRepository struct {
+	Configurations *config.Configurations
+	Context        context.Context
+	Connnection    connection.DatabaseConnection
+}
+
+func NewCheckpointRepository(ctx context.Context, config *config.Configurations, conn connection.DatabaseConnection) *CheckpointRepository {
+	return &CheckpointRepository{
+		Configurations: config,
+		Context:        ctx,
+		Connnection:    conn,
+	}
+}
+
+// GetCheckpoint returns the checkpoint with id, or nil when none was saved yet
+func (r *CheckpointRepository) GetCheckpoint(id string) (*models.Checkpoint, error) {
+	filter := dbtypes.M{
+		"id": id,
+	}
+	ret, err := r.Connnection.Find(r.Context, r.Configurations.CKG.TableCheckpoint, nil, filter, nil, 1, 0)
+	if err != nil {
+		if utils.IsNoDocuments(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	entries := ret.([]dbtypes.M)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	checkpoint := models.Checkpoint{}
+	checkpoint.FromMap(entries[0])
+	return &checkpoint, nil
+}
+
+// SaveCheckpoint updates the checkpoint or inserts it when it does not exist yet
+func (r *CheckpointRepository) SaveCheckpoint(checkpoint models.Checkpoint) error {
+	filter := dbtypes.M{
+		"id": checkpoint.ID,
+	}
+	update := dbtypes.M{
+		"position":      checkpoint.Position,
+		"checkpoint_at": checkpoint.CheckpointAt,
+		"updated_at":    checkpoint.UpdatedAt,
+	}
+
+	matched, err := r.Connnection.UpdateOne(r.Context, r.Configurations.CKG.TableCheckpoint, filter, update)
+	if err != nil {
+		return err
+	}
+	if matched > 0 {
+		return nil
+	}
+
+	_, err = r.Connnection.InsertOne(r.Context, r.Configurations.CKG.TableCheckpoint, checkpoint)
+	return err
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"pubsub-ckg-tb/internal/config"
@@ -11,15 +12,26 @@ import (
 	"pubsub-ckg-tb/internal/models"
 	"slices"
 	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type CKGTB interface {
-	GetPendingTbSkrining(start string, end string, limit int64) ([]models.SkriningCKGResult, error)
+	GetPendingTbSkrining(filter SkriningFilter, limit int64, skip int64) ([]models.SkriningCKGResult, error)
 	GetOnePendingTbSkrining(table string, docBytes []byte) (*models.SkriningCKGResult, error)
-	UpdateTbPatientStatus(input []models.StatusPasien) ([]models.StatusPasienResult, error)
+	GetOnePendingTbSkriningFromMap(entry map[string]any) (*models.SkriningCKGResult, error)
+	UpdateTbPatientStatus(messageID string, input []models.StatusPasien) ([]models.StatusPasienResult, error)
+	FindStatusHistory(pasienCkgID string, pasienNIK string, limit int64) ([]models.StatusPasienHistory, error)
+	SetDryRun(dryRun bool)
+}
+
+// SkriningFilter membatasi pencarian data skrining, field kosong diabaikan
+type SkriningFilter struct {
+	Start          string   `json:"start,omitempty"`           // updated_at >= Start
+	End            string   `json:"end,omitempty"`             // updated_at <= End
+	KodeFaskes     []string `json:"kode_faskes,omitempty"`     // kode_faskes salah satu dari daftar
+	ProvinsiFaskes []string `json:"provinsi_faskes,omitempty"` // provinsi_faskes salah satu dari daftar
 }
 
 type CKGTBRepository struct {
@@ -34,6 +46,9 @@ type CKGTBRepository struct {
 	useCache     bool
 	cacheWilayah map[string]models.MasterWilayah
 	cacheFaskes  map[string]models.MasterFaskes
+
+	// dryRun hanya menghitung hasil UpdateTbPatientStatus tanpa menulis ke tabel status
+	dryRun bool
 }
 
 func NewCKGTBRepository(ctx context.Context, config *config.Configurations, conn connection.DatabaseConnection) *CKGTBRepository {
@@ -55,15 +70,40 @@ func NewCKGTBRepository(ctx context.Context, config *config.Configurations, conn
 	}
 }
 
-func (r *CKGTBRepository) GetPendingTbSkrining(start string, end string, limit int64) ([]models.SkriningCKGResult, error) {
+func (r *CKGTBRepository) SetDryRun(dryRun bool) {
+	r.dryRun = dryRun
+}
+
+// GetPendingTbSkrining mengambil data skrining sesuai filter, urut berdasarkan updated_at lalu primary key
+func (r *CKGTBRepository) GetPendingTbSkrining(filter SkriningFilter, limit int64, skip int64) ([]models.SkriningCKGResult, error) {
 	// Get Skrining
-	filter := dbtypes.M{
-		"updated_at": dbtypes.M{
-			"$gte": start,
-			"$lte": end,
-		},
+	query := dbtypes.M{}
+
+	period := dbtypes.M{}
+	if filter.Start != "" {
+		period["$gte"] = filter.Start
+	}
+	if filter.End != "" {
+		period["$lte"] = filter.End
+	}
+	if len(period) > 0 {
+		query["updated_at"] = period
+	}
+
+	if len(filter.KodeFaskes) > 0 {
+		query["kode_faskes"] = dbtypes.M{"$in": filter.KodeFaskes}
+	}
+	if len(filter.ProvinsiFaskes) > 0 {
+		query["provinsi_faskes"] = dbtypes.M{"$in": filter.ProvinsiFaskes}
 	}
-	ret, err := r.Connnection.Find(r.Context, r.Configurations.CKG.TableSkrining, nil, filter, nil, limit, 0)
+
+	// Urutan data dengan updated_at yang sama ditentukan oleh primary key agar skip
+	// pada cursor paging selalu melewati data yang sama
+	sort := map[string]int{
+		"updated_at":          1,
+		r.skriningKeyColumn(): 2,
+	}
+	ret, err := r.Connnection.Find(r.Context, r.Configurations.CKG.TableSkrining, nil, query, sort, limit, skip)
 	if err != nil {
 		slog.Debug("GetPendingTbSkrining:", "error", err)
 		return nil, err
@@ -81,6 +121,16 @@ func (r *CKGTBRepository) GetPendingTbSkrining(start string, end string, limit i
 	return result, nil
 }
 
+// skriningKeyColumn adalah primary key tabel skrining: _id pada MongoDB,
+// PRODUCER_WATCH_KEYCOLUMN pada MySQL/PostgreSQL
+func (r *CKGTBRepository) skriningKeyColumn() string {
+	keyColumn := r.Configurations.Producer.Watch.KeyColumn
+	if r.Connnection.GetDriver() == "mongodb" || keyColumn == "" {
+		return "_id"
+	}
+	return keyColumn
+}
+
 func (r *CKGTBRepository) GetOnePendingTbSkrining(id string, docBytes []byte) (*models.SkriningCKGResult, error) {
 	// Convert to SkriningCKGRaw
 	var raw models.SkriningCKGRaw
@@ -135,10 +185,29 @@ func (r *CKGTBRepository) GetOnePendingTbSkrining(id string, docBytes []byte) (*
 	return &res, nil
 }
 
-func (r *CKGTBRepository) UpdateTbPatientStatus(input []models.StatusPasien) ([]models.StatusPasienResult, error) {
+// GetOnePendingTbSkriningFromMap sama seperti GetOnePendingTbSkrining untuk baris hasil query SQL
+func (r *CKGTBRepository) GetOnePendingTbSkriningFromMap(entry map[string]any) (*models.SkriningCKGResult, error) {
+	raw := models.SkriningCKGRaw{}
+	raw.FromMap(entry)
+
+	res := raw.ToSkriningCKGResult()
+	r._HitungHasilSkrining(raw, &res)
+	r._MappingMasterData(r.Context, r.Context, raw, &res)
+
+	return &res, nil
+}
+
+// UpdateTbPatientStatus menyimpan status pasien dari SITB. Setiap perubahan yang diterima juga dicatat
+// ke riwayat status dengan messageID sebagai sumber perubahan. Item yang gagal validasi atau ditolak
+// karena usang hanya dilaporkan pada hasil per item, error yang dikembalikan berasal dari database.
+func (r *CKGTBRepository) UpdateTbPatientStatus(messageID string, input []models.StatusPasien) ([]models.StatusPasienResult, error) {
 	results := make([]models.StatusPasienResult, 0, len(input))
 	collectionName := r.Configurations.CKG.TableStatus
 
+	// Hanya error database yang dikumpulkan, pemanggil yang menentukan perlu retry atau tidak.
+	// Error validasi bersifat permanen dan cukup dilaporkan pada StatusPasienResult item tersebut.
+	var itemErrors []error
+
 	for i, item := range input {
 		res := models.StatusPasienResult{
 			PasienCkgID: item.PasienCkgID,
@@ -158,9 +227,24 @@ func (r *CKGTBRepository) UpdateTbPatientStatus(input []models.StatusPasien) ([]
 			continue
 		}
 
+		// sitb_updated_at disimpan dalam format yang bisa dibandingkan (format sudah divalidasi)
+		if utils.IsNotEmptyString(item.SitbUpdatedAt) {
+			normalized, _ := normalizeSitbTimestamp(*item.SitbUpdatedAt)
+			item.SitbUpdatedAt = &normalized
+		}
+
 		// Simpan atau update database.
 		resExist, err := utils.FindPasienTb(r.Context, r.Connnection, collectionName, item)
 		if resExist != nil { // sudah ada status
+			// Tolak status yang lebih lama dari status tersimpan (message diterima tidak berurutan).
+			// Penolakan ini bukan error proses sehingga message tetap dianggap selesai dan tidak dikarantina.
+			if stale, storedAt := isStaleStatus(item, *resExist); stale {
+				res.IsError = true
+				res.Respons = fmt.Sprintf("stale status ignored: sitb_updated_at %s is not newer than stored sitb_updated_at %s", *item.SitbUpdatedAt, storedAt)
+				results = append(results, res)
+				continue
+			}
+
 			if utils.IsNotEmptyString(resExist.PasienCkgID) {
 				res.PasienCkgID = resExist.PasienCkgID
 			}
@@ -213,12 +297,25 @@ func (r *CKGTBRepository) UpdateTbPatientStatus(input []models.StatusPasien) ([]
 				item.HasilAkhir = nil
 			}
 
+			if r.dryRun {
+				res.Respons = "dry-run: tb patient status would be updated"
+				results = append(results, res)
+				continue
+			}
+
 			msg, err1 := utils.UpdatePasienTb(r.Context, r.Connnection, collectionName, item)
 			res.Respons = msg
-			if err1 != nil {
+			if errors.Is(err1, utils.ErrStaleStatus) {
+				// Status yang lebih baru tersimpan di antara pembacaan dan update
+				res.IsError = true
+				res.Respons = fmt.Sprintf("stale status ignored: sitb_updated_at %s is not newer than the stored status", *item.SitbUpdatedAt)
+			} else if err1 != nil {
 				res.IsError = true
+				itemErrors = append(itemErrors, err1)
+			} else {
+				r.saveStatusHistory(resExist, item, messageID)
 			}
-		} else if err == mongo.ErrNoDocuments { // status baru
+		} else if utils.IsNoDocuments(err) { // status baru
 			// Coba cari di transaksi
 			if utils.IsNotEmptyString(item.PasienNIK) {
 				var transaction models.SkriningCKGRaw
@@ -265,19 +362,124 @@ func (r *CKGTBRepository) UpdateTbPatientStatus(input []models.StatusPasien) ([]
 				item.HasilAkhir = nil
 			}
 
+			if r.dryRun {
+				res.Respons = "dry-run: new tb patient status would be added"
+				results = append(results, res)
+				continue
+			}
+
 			msg, err1 := utils.InsertPasienTb(r.Context, r.Connnection, collectionName, item)
 			res.Respons = msg
 			if err1 != nil {
 				res.IsError = true
+				itemErrors = append(itemErrors, err1)
+			} else {
+				r.saveStatusHistory(nil, item, messageID)
 			}
-		} else {
-			continue
+		} else { // gagal membaca status existing
+			res.IsError = true
+			res.Respons = err.Error()
+			itemErrors = append(itemErrors, err)
 		}
 
 		results = append(results, res)
 	}
 
-	return results, nil
+	return results, errors.Join(itemErrors...)
+}
+
+// isStaleStatus memeriksa apakah item tidak lebih baru dari status tersimpan berdasarkan sitb_updated_at.
+// Status tanpa sitb_updated_at (pengirim lama) selalu diterima.
+func isStaleStatus(item models.StatusPasien, stored models.StatusPasien) (bool, string) {
+	if !utils.IsNotEmptyString(item.SitbUpdatedAt) || !utils.IsNotEmptyString(stored.SitbUpdatedAt) {
+		return false, ""
+	}
+
+	itemAt, err := parseSitbTimestamp(*item.SitbUpdatedAt)
+	if err != nil {
+		return false, ""
+	}
+	storedAt, err := parseSitbTimestamp(*stored.SitbUpdatedAt)
+	if err != nil {
+		slog.Warn("sitb_updated_at status tersimpan tidak valid", "sitb_updated_at", *stored.SitbUpdatedAt, "error", err)
+		return false, ""
+	}
+
+	return !itemAt.After(storedAt), *stored.SitbUpdatedAt
+}
+
+// sitbLocation adalah zona waktu SITB (WIB, tanpa daylight saving). Dipakai untuk updated_at tanpa
+// offset, FixedZone dipakai agar tidak bergantung pada tzdata di image container.
+var sitbLocation = time.FixedZone("Asia/Jakarta", 7*60*60)
+
+// sitbTimestampLayout adalah format sitb_updated_at tersimpan: UTC dengan lebar tetap sehingga urutan
+// string sama dengan urutan waktu dan bisa dibandingkan langsung di filter update
+const sitbTimestampLayout = "2006-01-02T15:04:05.000000Z"
+
+// parseSitbTimestamp membaca updated_at dari SITB dalam format RFC3339, atau YYYY-MM-DD HH:MM:SS
+// tanpa offset yang dianggap sebagai waktu Asia/Jakarta
+func parseSitbTimestamp(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, sitbLocation); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("format waktu tidak dikenal: %s", value)
+}
+
+// normalizeSitbTimestamp mengubah updated_at SITB ke format tersimpan (sitbTimestampLayout)
+func normalizeSitbTimestamp(value string) (string, error) {
+	t, err := parseSitbTimestamp(value)
+	if err != nil {
+		return "", err
+	}
+	return t.UTC().Format(sitbTimestampLayout), nil
+}
+
+// saveStatusHistory mencatat perubahan dari previous ke current pada riwayat status.
+// Status pasien sudah tersimpan, sehingga kegagalan menulis riwayat hanya dicatat di log.
+func (r *CKGTBRepository) saveStatusHistory(previous *models.StatusPasien, current models.StatusPasien, messageID string) {
+	changedAt := time.Now().Format(time.RFC3339)
+	for _, history := range models.NewStatusPasienHistory(previous, current, messageID, changedAt) {
+		if _, err := r.Connnection.InsertOne(r.Context, r.Configurations.CKG.TableStatusHistory, history); err != nil {
+			slog.Error("Gagal menyimpan riwayat status pasien", "message_id", messageID, "field", history.Field, "error", err)
+		}
+	}
+}
+
+// FindStatusHistory mengembalikan riwayat status pasien urut dari perubahan paling lama.
+// pasienCkgID atau pasienNIK boleh kosong, minimal salah satu harus diisi.
+func (r *CKGTBRepository) FindStatusHistory(pasienCkgID string, pasienNIK string, limit int64) ([]models.StatusPasienHistory, error) {
+	filter := dbtypes.M{}
+	if pasienCkgID != "" {
+		filter["pasien_ckg_id"] = pasienCkgID
+	}
+	if pasienNIK != "" {
+		filter["pasien_nik"] = pasienNIK
+	}
+	if len(filter) == 0 {
+		return nil, fmt.Errorf("pasien_ckg_id atau pasien_nik harus diisi")
+	}
+
+	sort := map[string]int{
+		"changed_at": 1,
+	}
+	ret, err := r.Connnection.Find(r.Context, r.Configurations.CKG.TableStatusHistory, nil, filter, sort, limit, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.StatusPasienHistory{}
+	for _, entry := range ret.([]dbtypes.M) {
+		history := models.StatusPasienHistory{}
+		history.FromMap(entry)
+		result = append(result, history)
+	}
+
+	return result, nil
 }
 
 func (r *CKGTBRepository) _MappingMasterData(ctxMasterWilayah context.Context, ctxMasterFaskes context.Context, raw models.SkriningCKGRaw, res *models.SkriningCKGResult) {
@@ -367,6 +569,12 @@ func (r *CKGTBRepository) _ValidateSkriningData(item models.StatusPasien, i int)
 		return fmt.Errorf("validation error at index %d: hasil_akhir must be one of %v", i, statusAkhir)
 	}
 
+	if utils.IsNotEmptyString(item.SitbUpdatedAt) {
+		if _, err := parseSitbTimestamp(*item.SitbUpdatedAt); err != nil {
+			return fmt.Errorf("validation error at index %d: sitb_updated_at must be RFC3339 or YYYY-MM-DD HH:MM:SS", i)
+		}
+	}
+
 	return nil
 }
 
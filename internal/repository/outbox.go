@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"pubsub-ckg-tb/internal/config"
+	"pubsub-ckg-tb/internal/db/connection"
+	"pubsub-ckg-tb/internal/db/dbtypes"
+	"pubsub-ckg-tb/internal/models"
+)
+
+type Outbox interface {
+	SaveOutbox(outbox models.OutboxMessage) error
+	GetRelayableOutbox(maxAttempts int, staleBefore string, limit int64) ([]models.OutboxMessage, error)
+	ClaimOutbox(outbox models.OutboxMessage, claimedAt string) (bool, error)
+	MarkOutboxPublished(id string, messageID string, publishedAt string) error
+	MarkOutboxFailed(id string, lastError string, failedAt string) error
+}
+
+type OutboxRepository struct {
+	Configurations *config.Configurations
+	Context        context.Context
+	Connnection    connection.DatabaseConnection
+}
+
+func NewOutboxRepository(ctx context.Context, config *config.Configurations, conn connection.DatabaseConnection) *OutboxRepository {
+	return &OutboxRepository{
+		Configurations: config,
+		Context:        ctx,
+		Connnection:    conn,
+	}
+}
+
+func (r *OutboxRepository) SaveOutbox(outbox models.OutboxMessage) error {
+	_, err := r.Connnection.InsertOne(r.Context, r.Configurations.CKG.TableOutbox, outbox)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetRelayableOutbox returns outbox messages that should be (re)published, oldest first:
+// pending messages, failed messages below maxAttempts and publishing messages whose
+// claim is older than staleBefore (the relay holding them crashed)
+func (r *OutboxRepository) GetRelayableOutbox(maxAttempts int, staleBefore string, limit int64) ([]models.OutboxMessage, error) {
+	filter := dbtypes.M{
+		"$or": []dbtypes.M{
+			{"state": models.OutboxStatePending},
+			{"state": models.OutboxStateFailed, "attempts": dbtypes.M{"$lt": maxAttempts}},
+			{"state": models.OutboxStatePublishing, "updated_at": dbtypes.M{"$lt": staleBefore}},
+		},
+	}
+	sort := map[string]int{
+		"created_at": 1,
+	}
+
+	ret, err := r.Connnection.Find(r.Context, r.Configurations.CKG.TableOutbox, nil, filter, sort, limit, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.OutboxMessage{}
+	for _, entry := range ret.([]dbtypes.M) {
+		outbox := models.OutboxMessage{}
+		outbox.FromMap(entry)
+		result = append(result, outbox)
+	}
+
+	return result, nil
+}
+
+// ClaimOutbox moves an outbox message to publishing and counts the attempt.
+// The update only matches while state and updated_at are unchanged, so when several
+// relays run at once only one of them gets true.
+func (r *OutboxRepository) ClaimOutbox(outbox models.OutboxMessage, claimedAt string) (bool, error) {
+	filter := dbtypes.M{
+		"id":         outbox.ID,
+		"state":      outbox.State,
+		"updated_at": outbox.UpdatedAt,
+	}
+	update := dbtypes.M{
+		"state":      models.OutboxStatePublishing,
+		"attempts":   outbox.Attempts + 1,
+		"updated_at": claimedAt,
+	}
+
+	matched, err := r.Connnection.UpdateOne(r.Context, r.Configurations.CKG.TableOutbox, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return matched > 0, nil
+}
+
+func (r *OutboxRepository) MarkOutboxPublished(id string, messageID string, publishedAt string) error {
+	filter := dbtypes.M{
+		"id": id,
+	}
+	update := dbtypes.M{
+		"state":        models.OutboxStatePublished,
+		"message_id":   messageID,
+		"last_error":   nil,
+		"published_at": publishedAt,
+		"updated_at":   publishedAt,
+	}
+
+	_, err := r.Connnection.UpdateOne(r.Context, r.Configurations.CKG.TableOutbox, filter, update)
+	return err
+}
+
+func (r *OutboxRepository) MarkOutboxFailed(id string, lastError string, failedAt string) error {
+	filter := dbtypes.M{
+		"id": id,
+	}
+	update := dbtypes.M{
+		"state":      models.OutboxStateFailed,
+		"last_error": lastError,
+		"updated_at": failedAt,
+	}
+
+	_, err := r.Connnection.UpdateOne(r.Context, r.Configurations.CKG.TableOutbox, filter, update)
+	return err
+}
@@ -2,20 +2,58 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	"pubsub-ckg-tb/internal/config"
 	"pubsub-ckg-tb/internal/db/connection"
+	"pubsub-ckg-tb/internal/db/dbtypes"
 	"pubsub-ckg-tb/internal/models"
+	"time"
 )
 
 type PubSub interface {
 	GetIncomingIDs(messageIDs []string) ([]string, error)
+	GetProcessedIncomingIDs(messageIDs []string) ([]string, error)
+	FindIncoming(filter IncomingFilter, limit int64, skip int64) ([]models.IncomingMessageStatusTB, error)
 	SaveNewIncoming(incoming models.IncomingMessageStatusTB) error
-	UpdateIncoming(messageID string, processedAt *string) error
-	DeleteIncomingMessage(dateExpired string)
+	StartIncomingAttempt(messageID string) (int, error)
+	FinishIncoming(messageID string, state string, processedAt *string, lastError *string, items []models.IncomingItemStatusTB) error
+	FindIncomingItems(filter IncomingItemFilter, limit int64) ([]models.IncomingItemStatusTB, error)
 
 	GetOutgoingIDs(messageIDs []string) ([]string, error)
 	GetLastOutgoingTimestamp() (string, error)
-	SaveOutgoing(outgoing models.OutgoingMessageSkriningTB) error
+	SaveOutgoing(outgoing models.OutgoingMessageSkriningTB, records []models.OutgoingRecordSkriningTB) error
+	FindOutgoingByPatient(pasienCkgID string, pasienNIK string, limit int64) ([]models.OutgoingRecordSkriningTB, error)
+	QueueLatestOutgoing(latest []models.OutgoingLatestSkriningTB) error
+	ReleaseLatestOutgoing(outboxID string) error
+	FindLatestOutgoing(pasienCkgIDs []string) (map[string]models.OutgoingLatestSkriningTB, error)
+
+	SaveQuarantine(quarantine models.QuarantineMessage) error
+	GetQuarantine(filter QuarantineFilter, limit int64, skip int64) ([]models.QuarantineMessage, error)
+}
+
+// IncomingFilter membatasi pencarian log incoming, field kosong diabaikan
+type IncomingFilter struct {
+	IDs       []string
+	Start     string // received_at >= Start
+	End       string // received_at <= End
+	Processed *bool  // nil = semua, true = sudah diproses, false = belum diproses
+	State     string // state proses, lihat models.IncomingState*
+}
+
+// IncomingItemFilter membatasi pencarian hasil proses per item, minimal satu field identitas pasien harus diisi
+type IncomingItemFilter struct {
+	PasienNIK   string
+	TerdugaID   string
+	PasienCkgID string
+	FailedOnly  bool
+}
+
+// QuarantineFilter membatasi pencarian tabel karantina, field kosong diabaikan
+type QuarantineFilter struct {
+	IDs    []string
+	Start  string // quarantined_at >= Start
+	End    string // quarantined_at <= End
+	Reason string // alasan karantina, lihat ckg.QuarantineReason*
 }
 
 type PubSubRepository struct {
@@ -44,15 +82,94 @@ func (r *PubSubRepository) GetIncomingIDs(messageIDs []string) ([]string, error)
 	}
 
 	result := []string{}
-	for _, entry := range ids.([]any) {
-		id := entry.(map[string]any)["id"]
-		result = append(result, id.(string))
+	for _, entry := range ids.([]dbtypes.M) {
+		if id, ok := entry["id"].(string); ok {
+			result = append(result, id)
+		}
+	}
+
+	return result, nil
+}
+
+// GetProcessedIncomingIDs returns only message IDs that already finished processing
+func (r *PubSubRepository) GetProcessedIncomingIDs(messageIDs []string) ([]string, error) {
+	filter := map[string]any{
+		"id": map[string]any{
+			"$in": messageIDs,
+		},
+	}
+	ids, err := r.Connnection.Find(r.Context, r.Configurations.CKG.TableIncoming, []string{"id", "processed_at"}, filter, nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for _, entry := range ids.([]dbtypes.M) {
+		id, ok := entry["id"].(string)
+		if !ok || entry["processed_at"] == nil || entry["processed_at"] == "" {
+			continue
+		}
+		result = append(result, id)
+	}
+
+	return result, nil
+}
+
+// FindIncoming returns incoming messages matching filter ordered by received_at
+func (r *PubSubRepository) FindIncoming(filter IncomingFilter, limit int64, skip int64) ([]models.IncomingMessageStatusTB, error) {
+	query := dbtypes.M{}
+	if len(filter.IDs) > 0 {
+		query["id"] = dbtypes.M{"$in": filter.IDs}
+	}
+
+	period := dbtypes.M{}
+	if filter.Start != "" {
+		period["$gte"] = filter.Start
+	}
+	if filter.End != "" {
+		period["$lte"] = filter.End
+	}
+	if len(period) > 0 {
+		query["received_at"] = period
+	}
+
+	if filter.Processed != nil {
+		if *filter.Processed {
+			query["processed_at"] = dbtypes.M{"$ne": nil}
+		} else {
+			query["processed_at"] = nil
+		}
+	}
+
+	if filter.State != "" {
+		query["state"] = filter.State
+	}
+
+	sort := map[string]int{
+		"received_at": 1,
+	}
+	ret, err := r.Connnection.Find(r.Context, r.Configurations.CKG.TableIncoming, nil, query, sort, limit, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.IncomingMessageStatusTB{}
+	for _, entry := range ret.([]dbtypes.M) {
+		incoming := models.IncomingMessageStatusTB{}
+		incoming.FromMap(entry)
+		result = append(result, incoming)
 	}
 
 	return result, nil
 }
 
 func (r *PubSubRepository) SaveNewIncoming(incoming models.IncomingMessageStatusTB) error {
+	if incoming.State == "" {
+		incoming.State = models.IncomingStateReceived
+	}
+	if incoming.UpdatedAt == "" {
+		incoming.UpdatedAt = incoming.ReceivedAt
+	}
 	_, err := r.Connnection.InsertOne(r.Context, r.Configurations.CKG.TableIncoming, incoming)
 	if err != nil {
 		return err
@@ -61,28 +178,112 @@ func (r *PubSubRepository) SaveNewIncoming(incoming models.IncomingMessageStatus
 	return nil
 }
 
-func (r *PubSubRepository) UpdateIncoming(messageID string, processedAt *string) error {
+// StartIncomingAttempt marks the incoming message as processing and returns the attempt number
+func (r *PubSubRepository) StartIncomingAttempt(messageID string) (int, error) {
+	var incoming models.IncomingMessageStatusTB
+	filter := map[string]any{
+		"id": messageID,
+	}
+	if err := r.Connnection.FindOne(r.Context, &incoming, r.Configurations.CKG.TableIncoming, []string{"id", "attempts"}, filter, nil); err != nil {
+		return 0, err
+	}
+
+	attempt := incoming.Attempts + 1
+	update := map[string]any{
+		"state":      models.IncomingStateProcessing,
+		"attempts":   attempt,
+		"updated_at": time.Now().Format(time.RFC3339),
+	}
+	if _, err := r.Connnection.UpdateOne(r.Context, r.Configurations.CKG.TableIncoming, filter, update); err != nil {
+		return 0, err
+	}
+
+	return attempt, nil
+}
+
+// FinishIncoming records the outcome of a processing attempt. processedAt stays nil when the
+// message will be delivered again. Item results replace those of a previous attempt at the same index.
+func (r *PubSubRepository) FinishIncoming(messageID string, state string, processedAt *string, lastError *string, items []models.IncomingItemStatusTB) error {
 	filter := map[string]any{
 		"id": messageID,
 	}
 	update := map[string]any{
+		"state":        state,
+		"last_error":   lastError,
 		"processed_at": processedAt,
+		"updated_at":   time.Now().Format(time.RFC3339),
 	}
-	_, err := r.Connnection.UpdateOne(r.Context, r.Configurations.CKG.TableIncoming, filter, update)
-	if err != nil {
+	if _, err := r.Connnection.UpdateOne(r.Context, r.Configurations.CKG.TableIncoming, filter, update); err != nil {
 		return err
 	}
 
+	for _, item := range items {
+		var existing models.IncomingItemStatusTB
+		filter := map[string]any{
+			"message_id": item.MessageID,
+			"item_index": item.ItemIndex,
+		}
+		err := r.Connnection.FindOne(r.Context, &existing, r.Configurations.CKG.TableIncomingItem, []string{"message_id"}, filter, nil)
+		if err == nil && existing.MessageID != "" {
+			update := map[string]any{
+				"pasien_ckg_id": item.PasienCkgID,
+				"terduga_id":    item.TerdugaID,
+				"pasien_tb_id":  item.PasienTbID,
+				"pasien_nik":    item.PasienNIK,
+				"is_error":      item.IsError,
+				"respons":       item.Respons,
+				"attempt":       item.Attempt,
+				"processed_at":  item.ProcessedAt,
+			}
+			if _, err := r.Connnection.UpdateOne(r.Context, r.Configurations.CKG.TableIncomingItem, filter, update); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := r.Connnection.InsertOne(r.Context, r.Configurations.CKG.TableIncomingItem, item); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (r *PubSubRepository) DeleteIncomingMessage(dateExpired string) {
-	filter := map[string]any{
-		"received_at": map[string]any{
-			"$lt": dateExpired,
-		},
+// FindIncomingItems returns the per item processing results of a patient, newest first
+func (r *PubSubRepository) FindIncomingItems(filter IncomingItemFilter, limit int64) ([]models.IncomingItemStatusTB, error) {
+	query := dbtypes.M{}
+	if filter.PasienNIK != "" {
+		query["pasien_nik"] = filter.PasienNIK
+	}
+	if filter.TerdugaID != "" {
+		query["terduga_id"] = filter.TerdugaID
+	}
+	if filter.PasienCkgID != "" {
+		query["pasien_ckg_id"] = filter.PasienCkgID
+	}
+	if len(query) == 0 {
+		return nil, fmt.Errorf("pasien_nik, terduga_id atau pasien_ckg_id harus diisi")
+	}
+	if filter.FailedOnly {
+		query["is_error"] = true
 	}
-	r.Connnection.DeleteOne(r.Context, r.Configurations.CKG.TableIncoming, filter)
+
+	sort := map[string]int{
+		"processed_at": -1,
+	}
+	ret, err := r.Connnection.Find(r.Context, r.Configurations.CKG.TableIncomingItem, nil, query, sort, limit, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.IncomingItemStatusTB{}
+	for _, entry := range ret.([]dbtypes.M) {
+		item := models.IncomingItemStatusTB{}
+		item.FromMap(entry)
+		result = append(result, item)
+	}
+
+	return result, nil
 }
 
 func (r *PubSubRepository) GetOutgoingIDs(messageIDs []string) ([]string, error) {
@@ -97,26 +298,34 @@ func (r *PubSubRepository) GetOutgoingIDs(messageIDs []string) ([]string, error)
 	}
 
 	result := []string{}
-	for _, entry := range ids.([]any) {
-		id := entry.(map[string]any)["id"]
-		result = append(result, id.(string))
+	for _, entry := range ids.([]dbtypes.M) {
+		if id, ok := entry["id"].(string); ok {
+			result = append(result, id)
+		}
 	}
 	return result, nil
 }
 
 func (r *PubSubRepository) GetLastOutgoingTimestamp() (string, error) {
+	// Publish yang gagal tidak dihitung sebagai data yang sudah terkirim
+	filter := map[string]any{
+		"status": map[string]any{
+			"$ne": models.OutgoingStatusFailed,
+		},
+	}
 	sort := map[string]int{
 		"created_at": -1,
 	}
 	var outgoing models.OutgoingMessageSkriningTB
-	err := r.Connnection.FindOne(r.Context, &outgoing, r.Configurations.CKG.TableOutgoing, nil, nil, sort)
+	err := r.Connnection.FindOne(r.Context, &outgoing, r.Configurations.CKG.TableOutgoing, nil, filter, sort)
 	if err != nil {
 		return "", err
 	}
 	return outgoing.CreatedAt, nil
 }
 
-func (r *PubSubRepository) SaveOutgoing(outgoing models.OutgoingMessageSkriningTB) error {
+// SaveOutgoing saves the outgoing message log together with the records carried by the message
+func (r *PubSubRepository) SaveOutgoing(outgoing models.OutgoingMessageSkriningTB, records []models.OutgoingRecordSkriningTB) error {
 	var out models.OutgoingMessageSkriningTB
 	filter := map[string]any{
 		"id": outgoing.ID,
@@ -127,12 +336,270 @@ func (r *PubSubRepository) SaveOutgoing(outgoing models.OutgoingMessageSkriningT
 			"id": out.ID,
 		}
 		update := map[string]any{
-			"updated_at": out.UpdatedAt,
+			"updated_at": outgoing.UpdatedAt,
+		}
+		_, err = r.Connnection.UpdateOne(r.Context, r.Configurations.CKG.TableOutgoing, filter, update)
+		return err
+	}
+
+	if _, err := r.Connnection.InsertOne(r.Context, r.Configurations.CKG.TableOutgoing, outgoing); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		record.MessageID = outgoing.ID
+		if _, err := r.Connnection.InsertOne(r.Context, r.Configurations.CKG.TableOutgoingItem, record); err != nil {
+			return err
+		}
+		if err := r.saveLatestOutgoing(outgoing.OutboxID, record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// QueueLatestOutgoing replaces the latest record of each patient with a record that was just put in the outbox.
+// Unlike the outgoing item log the latest table is never purged by retention, change detection and
+// retraction rely on it.
+func (r *PubSubRepository) QueueLatestOutgoing(latest []models.OutgoingLatestSkriningTB) error {
+	for _, record := range latest {
+		if record.PasienCkgID == "" {
+			continue
+		}
+
+		filter := dbtypes.M{
+			"pasien_ckg_id": record.PasienCkgID,
+		}
+		update := dbtypes.M{
+			"outbox_id":    record.OutboxID,
+			"message_id":   record.MessageID,
+			"pasien_nik":   record.PasienNIK,
+			"record_hash":  record.RecordHash,
+			"terduga":      record.Terduga,
+			"attempt":      record.Attempt,
+			"queued_at":    record.QueuedAt,
+			"published_at": record.PublishedAt,
+		}
+		updated, err := r.Connnection.UpdateOne(r.Context, r.Configurations.CKG.TableOutgoingLatest, filter, update)
+		if err != nil {
+			return err
+		}
+		if updated > 0 {
+			continue
+		}
+
+		if _, err := r.Connnection.InsertOne(r.Context, r.Configurations.CKG.TableOutgoingLatest, record); err != nil {
+			return err
 		}
-		r.Connnection.UpdateOne(r.Context, r.Configurations.CKG.TableOutgoing, filter, update)
-	} else {
-		r.Connnection.InsertOne(r.Context, r.Configurations.CKG.TableOutgoing, outgoing)
 	}
 
 	return nil
 }
+
+// saveLatestOutgoing marks the latest record of the patient as published. A record queued by a newer
+// outbox message is left as it is, rows written before the outbox id was stored are replaced.
+func (r *PubSubRepository) saveLatestOutgoing(outboxID string, record models.OutgoingRecordSkriningTB) error {
+	if record.PasienCkgID == "" {
+		return nil
+	}
+
+	filter := dbtypes.M{
+		"pasien_ckg_id": record.PasienCkgID,
+	}
+	if outboxID != "" {
+		filter["$or"] = []dbtypes.M{
+			{"outbox_id": outboxID},
+			{"outbox_id": nil},
+		}
+	}
+	update := dbtypes.M{
+		"message_id":   record.MessageID,
+		"pasien_nik":   record.PasienNIK,
+		"record_hash":  record.RecordHash,
+		"terduga":      record.Terduga,
+		"attempt":      record.Attempt,
+		"published_at": record.PublishedAt,
+	}
+	updated, err := r.Connnection.UpdateOne(r.Context, r.Configurations.CKG.TableOutgoingLatest, filter, update)
+	if err != nil || updated > 0 {
+		return err
+	}
+
+	// Baris pasien sudah ada (data yang lebih baru di outbox atau tidak ada perubahan), tidak ditimpa
+	exists, err := r.Connnection.Find(r.Context, r.Configurations.CKG.TableOutgoingLatest, []string{"pasien_ckg_id"}, dbtypes.M{"pasien_ckg_id": record.PasienCkgID}, nil, 1, 0)
+	if err != nil || len(exists.([]dbtypes.M)) > 0 {
+		return err
+	}
+
+	latest := models.OutgoingLatestSkriningTB{
+		PasienCkgID: record.PasienCkgID,
+		MessageID:   &record.MessageID,
+		PasienNIK:   record.PasienNIK,
+		RecordHash:  record.RecordHash,
+		Terduga:     record.Terduga,
+		Attempt:     record.Attempt,
+		QueuedAt:    &record.PublishedAt,
+		PublishedAt: &record.PublishedAt,
+	}
+	if outboxID != "" {
+		latest.OutboxID = &outboxID
+	}
+	_, err = r.Connnection.InsertOne(r.Context, r.Configurations.CKG.TableOutgoingLatest, latest)
+	return err
+}
+
+// ReleaseLatestOutgoing removes the latest records queued by an outbox message that will not be published
+// anymore, the patients fall back to the last record in the outgoing item log
+func (r *PubSubRepository) ReleaseLatestOutgoing(outboxID string) error {
+	filter := dbtypes.M{
+		"outbox_id":    outboxID,
+		"published_at": nil,
+	}
+	_, err := r.Connnection.DeleteMany(r.Context, r.Configurations.CKG.TableOutgoingLatest, filter)
+	return err
+}
+
+// FindOutgoingByPatient returns the sent records of a patient, newest first.
+// Either pasienCkgID or pasienNIK may be empty, at least one must be given.
+func (r *PubSubRepository) FindOutgoingByPatient(pasienCkgID string, pasienNIK string, limit int64) ([]models.OutgoingRecordSkriningTB, error) {
+	filter := dbtypes.M{}
+	if pasienCkgID != "" {
+		filter["pasien_ckg_id"] = pasienCkgID
+	}
+	if pasienNIK != "" {
+		filter["pasien_nik"] = pasienNIK
+	}
+	if len(filter) == 0 {
+		return nil, fmt.Errorf("pasien_ckg_id atau pasien_nik harus diisi")
+	}
+
+	sort := map[string]int{
+		"published_at": -1,
+	}
+	ret, err := r.Connnection.Find(r.Context, r.Configurations.CKG.TableOutgoingItem, nil, filter, sort, limit, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.OutgoingRecordSkriningTB{}
+	for _, entry := range ret.([]dbtypes.M) {
+		record := models.OutgoingRecordSkriningTB{}
+		record.FromMap(entry)
+		result = append(result, record)
+	}
+
+	return result, nil
+}
+
+// FindLatestOutgoing returns the latest record per patient for the given patients, patients that
+// were never sent are left out. Patients sent before the latest table existed are looked up in the
+// outgoing item log.
+func (r *PubSubRepository) FindLatestOutgoing(pasienCkgIDs []string) (map[string]models.OutgoingLatestSkriningTB, error) {
+	result := map[string]models.OutgoingLatestSkriningTB{}
+	if len(pasienCkgIDs) == 0 {
+		return result, nil
+	}
+
+	filter := dbtypes.M{
+		"pasien_ckg_id": dbtypes.M{"$in": pasienCkgIDs},
+	}
+	ret, err := r.Connnection.Find(r.Context, r.Configurations.CKG.TableOutgoingLatest, nil, filter, nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range ret.([]dbtypes.M) {
+		latest := models.OutgoingLatestSkriningTB{}
+		latest.FromMap(entry)
+		result[latest.PasienCkgID] = latest
+	}
+
+	missing := []string{}
+	for _, id := range pasienCkgIDs {
+		if _, ok := result[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	filter = dbtypes.M{
+		"pasien_ckg_id": dbtypes.M{"$in": missing},
+	}
+	sort := map[string]int{
+		"published_at": -1,
+	}
+	ret, err = r.Connnection.Find(r.Context, r.Configurations.CKG.TableOutgoingItem, nil, filter, sort, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range ret.([]dbtypes.M) {
+		record := models.OutgoingRecordSkriningTB{}
+		record.FromMap(entry)
+		if _, ok := result[record.PasienCkgID]; ok {
+			continue
+		}
+		result[record.PasienCkgID] = models.OutgoingLatestSkriningTB{
+			PasienCkgID: record.PasienCkgID,
+			MessageID:   &record.MessageID,
+			PasienNIK:   record.PasienNIK,
+			RecordHash:  record.RecordHash,
+			Terduga:     record.Terduga,
+			Attempt:     record.Attempt,
+			PublishedAt: &record.PublishedAt,
+		}
+	}
+
+	return result, nil
+}
+
+func (r *PubSubRepository) SaveQuarantine(quarantine models.QuarantineMessage) error {
+	_, err := r.Connnection.InsertOne(r.Context, r.Configurations.CKG.TableQuarantine, quarantine)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetQuarantine returns quarantined messages matching filter, newest first
+func (r *PubSubRepository) GetQuarantine(filter QuarantineFilter, limit int64, skip int64) ([]models.QuarantineMessage, error) {
+	query := dbtypes.M{}
+	if len(filter.IDs) > 0 {
+		query["id"] = dbtypes.M{"$in": filter.IDs}
+	}
+
+	period := dbtypes.M{}
+	if filter.Start != "" {
+		period["$gte"] = filter.Start
+	}
+	if filter.End != "" {
+		period["$lte"] = filter.End
+	}
+	if len(period) > 0 {
+		query["quarantined_at"] = period
+	}
+
+	if filter.Reason != "" {
+		query["reason"] = filter.Reason
+	}
+
+	sort := map[string]int{
+		"quarantined_at": -1,
+	}
+
+	ret, err := r.Connnection.Find(r.Context, r.Configurations.CKG.TableQuarantine, nil, query, sort, limit, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.QuarantineMessage{}
+	for _, entry := range ret.([]dbtypes.M) {
+		quarantine := models.QuarantineMessage{}
+		quarantine.FromMap(entry)
+		result = append(result, quarantine)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"pubsub-ckg-tb/internal/config"
+	"pubsub-ckg-tb/internal/db/connection"
+	"pubsub-ckg-tb/internal/db/dbtypes"
+	"pubsub-ckg-tb/internal/db/utils"
+)
+
+type Retention interface {
+	FindExpired(table string, timeColumn string, before string, limit int64) ([]dbtypes.M, error)
+	FindByKeys(table string, keyColumn string, keys []string) ([]dbtypes.M, error)
+	DeleteByKeys(table string, keyColumn string, keys []string) (int64, error)
+}
+
+type RetentionRepository struct {
+	Configurations *config.Configurations
+	Context        context.Context
+	Connnection    connection.DatabaseConnection
+}
+
+func NewRetentionRepository(ctx context.Context, config *config.Configurations, conn connection.DatabaseConnection) *RetentionRepository {
+	return &RetentionRepository{
+		Configurations: config,
+		Context:        ctx,
+		Connnection:    conn,
+	}
+}
+
+// FindExpired returns up to limit rows of table with timeColumn before the given timestamp, oldest first
+func (r *RetentionRepository) FindExpired(table string, timeColumn string, before string, limit int64) ([]dbtypes.M, error) {
+	filter := dbtypes.M{
+		timeColumn: dbtypes.M{
+			"$lt": before,
+		},
+	}
+	sort := map[string]int{
+		timeColumn: 1,
+	}
+	return r.find(table, filter, sort, limit)
+}
+
+// FindByKeys returns every row of table whose keyColumn is one of keys
+func (r *RetentionRepository) FindByKeys(table string, keyColumn string, keys []string) ([]dbtypes.M, error) {
+	if len(keys) == 0 {
+		return []dbtypes.M{}, nil
+	}
+
+	filter := dbtypes.M{
+		keyColumn: dbtypes.M{
+			"$in": keys,
+		},
+	}
+	return r.find(table, filter, nil, 0)
+}
+
+// DeleteByKeys deletes every row of table whose keyColumn is one of keys
+func (r *RetentionRepository) DeleteByKeys(table string, keyColumn string, keys []string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	filter := dbtypes.M{
+		keyColumn: dbtypes.M{
+			"$in": keys,
+		},
+	}
+	return r.Connnection.DeleteMany(r.Context, table, filter)
+}
+
+func (r *RetentionRepository) find(table string, filter dbtypes.M, sort map[string]int, limit int64) ([]dbtypes.M, error) {
+	ret, err := r.Connnection.Find(r.Context, table, nil, filter, sort, limit, 0)
+	if err != nil {
+		if utils.IsNoDocuments(err) {
+			return []dbtypes.M{}, nil
+		}
+		return nil, err
+	}
+
+	rows, ok := ret.([]dbtypes.M)
+	if !ok {
+		return []dbtypes.M{}, nil
+	}
+	return rows, nil
+}
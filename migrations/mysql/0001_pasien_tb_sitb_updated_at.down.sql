@@ -0,0 +1 @@
+ALTER TABLE `pasien_tb` DROP COLUMN `sitb_updated_at`;
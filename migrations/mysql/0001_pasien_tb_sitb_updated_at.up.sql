@@ -0,0 +1,5 @@
+-- Kolom updated_at SITB pada tabel status pasien (CKG_TABLE_STATUS). Status yang updated_at-nya tidak
+-- lebih baru dari nilai tersimpan ditolak. Nilai disimpan dalam UTC dengan format tetap
+-- 2006-01-02T15:04:05.000000Z sehingga bisa dibandingkan sebagai string.
+ALTER TABLE `pasien_tb`
+  ADD COLUMN `sitb_updated_at` VARCHAR(32) NULL COMMENT 'SITB status timestamp (UTC)';
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS `ckg_pubsub_incoming_item`;
+
+UPDATE `ckg_pubsub_incoming` SET `processed_at` = `received_at` WHERE `processed_at` IS NULL;
+
+ALTER TABLE `ckg_pubsub_incoming`
+  DROP INDEX `idx_state`,
+  DROP COLUMN `state`,
+  DROP COLUMN `attempts`,
+  DROP COLUMN `last_error`,
+  DROP COLUMN `updated_at`,
+  MODIFY COLUMN `processed_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT 'Message received timestamp';
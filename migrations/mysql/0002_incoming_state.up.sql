@@ -0,0 +1,29 @@
+-- State proses message incoming (CKG_TABLE_INCOMING) dan hasil proses per item (CKG_TABLE_INCOMING_ITEM).
+-- processed_at tidak lagi diisi otomatis: NULL berarti message belum selesai diproses. Baris lama
+-- dianggap sudah berhasil diproses.
+ALTER TABLE `ckg_pubsub_incoming`
+  ADD COLUMN `state` VARCHAR(20) NOT NULL DEFAULT 'received' COMMENT 'received, processing, succeeded, partially_failed, failed' AFTER `data`,
+  ADD COLUMN `attempts` INT NOT NULL DEFAULT 0 COMMENT 'Number of processing attempts' AFTER `state`,
+  ADD COLUMN `last_error` TEXT NULL COMMENT 'Error of the last processing attempt' AFTER `attempts`,
+  ADD COLUMN `updated_at` TIMESTAMP NULL DEFAULT NULL COMMENT 'Last state change timestamp' AFTER `processed_at`,
+  MODIFY COLUMN `processed_at` TIMESTAMP NULL DEFAULT NULL COMMENT 'Message processed timestamp, NULL jika belum diproses',
+  ADD INDEX `idx_state` (`state`);
+
+UPDATE `ckg_pubsub_incoming` SET `state` = 'succeeded', `attempts` = 1 WHERE `processed_at` IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS `ckg_pubsub_incoming_item` (
+    `message_id` VARCHAR(100) NOT NULL COMMENT 'Message ID from Pub/Sub',
+    `item_index` INT NOT NULL COMMENT 'Position of the status in the message data',
+    `pasien_ckg_id` VARCHAR(100) NULL COMMENT 'Patient CKG ID',
+    `terduga_id` VARCHAR(100) NULL COMMENT 'SITB terduga ID',
+    `pasien_tb_id` VARCHAR(100) NULL COMMENT 'SITB patient ID',
+    `pasien_nik` VARCHAR(20) NULL COMMENT 'Patient NIK',
+    `is_error` TINYINT(1) NOT NULL DEFAULT 0 COMMENT 'Whether the status was rejected',
+    `respons` TEXT NULL COMMENT 'Processing result or rejection reason',
+    `attempt` INT NOT NULL DEFAULT 1 COMMENT 'Processing attempt that produced the result',
+    `processed_at` VARCHAR(40) NOT NULL COMMENT 'Processing timestamp (RFC3339)',
+    PRIMARY KEY (`message_id`, `item_index`),
+    INDEX `idx_pasien_nik` (`pasien_nik`, `is_error`),
+    INDEX `idx_terduga_id` (`terduga_id`, `is_error`),
+    INDEX `idx_pasien_ckg_id` (`pasien_ckg_id`, `is_error`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Pub/Sub Incoming Records Table';
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS `ckg_pubsub_outgoing_item`;
+
+ALTER TABLE `ckg_pubsu_outgoing`
+  DROP INDEX `idx_outbox_id`,
+  DROP INDEX `idx_status_created_at`,
+  DROP COLUMN `outbox_id`,
+  DROP COLUMN `payload_hash`,
+  DROP COLUMN `ordering_key`,
+  DROP COLUMN `status`,
+  DROP COLUMN `error`,
+  DROP COLUMN `attempt`,
+  DROP COLUMN `record_count`;
@@ -0,0 +1,24 @@
+-- Log outgoing per percobaan publish (CKG_TABLE_OUTGOING) dan data skrining per message
+-- (CKG_TABLE_OUTGOING_ITEM). Baris lama dianggap message yang berhasil terkirim.
+ALTER TABLE `ckg_pubsu_outgoing`
+  ADD COLUMN `outbox_id` VARCHAR(36) NULL COMMENT 'Outbox ID the message was published from' AFTER `id`,
+  ADD COLUMN `payload_hash` CHAR(64) NULL COMMENT 'SHA-256 of the published payload' AFTER `outbox_id`,
+  ADD COLUMN `ordering_key` VARCHAR(100) NULL COMMENT 'Ordering key (pasien_ckg_id) of the message' AFTER `payload_hash`,
+  ADD COLUMN `status` VARCHAR(20) NOT NULL DEFAULT 'published' COMMENT 'published, failed' AFTER `ordering_key`,
+  ADD COLUMN `error` TEXT NULL COMMENT 'Publish error of a failed attempt' AFTER `status`,
+  ADD COLUMN `attempt` INT NOT NULL DEFAULT 1 COMMENT 'Publish attempt' AFTER `error`,
+  ADD COLUMN `record_count` INT NOT NULL DEFAULT 0 COMMENT 'Number of screening records in the message' AFTER `attempt`,
+  ADD INDEX `idx_outbox_id` (`outbox_id`),
+  ADD INDEX `idx_status_created_at` (`status`, `created_at`);
+
+CREATE TABLE IF NOT EXISTS `ckg_pubsub_outgoing_item` (
+    `message_id` VARCHAR(100) NOT NULL COMMENT 'Message ID from Pub/Sub',
+    `pasien_ckg_id` VARCHAR(100) NOT NULL COMMENT 'Patient CKG ID',
+    `pasien_nik` VARCHAR(20) NULL COMMENT 'Patient NIK',
+    `record_hash` CHAR(64) NOT NULL COMMENT 'SHA-256 of the screening record',
+    `attempt` INT NOT NULL DEFAULT 1 COMMENT 'Publish attempt that succeeded',
+    `published_at` VARCHAR(40) NOT NULL COMMENT 'Publish timestamp (RFC3339)',
+    PRIMARY KEY (`message_id`, `pasien_ckg_id`),
+    INDEX `idx_pasien_ckg_id_published_at` (`pasien_ckg_id`, `published_at`),
+    INDEX `idx_pasien_nik` (`pasien_nik`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Pub/Sub Outgoing Records Table';
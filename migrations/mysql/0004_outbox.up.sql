@@ -0,0 +1,18 @@
+-- Outbox producer (CKG_TABLE_OUTBOX). Batch skrining disimpan di sini lalu dikirim relay ke broker.
+CREATE TABLE IF NOT EXISTS `ckg_pubsub_outbox` (
+    `id` VARCHAR(36) NOT NULL COMMENT 'Outbox ID (UUID)',
+    `topic` VARCHAR(255) NOT NULL COMMENT 'Destination topic',
+    `data` LONGTEXT NOT NULL COMMENT 'Message data in JSON format',
+    `attributes` JSON NULL COMMENT 'Message attributes in JSON format',
+    `records` JSON NULL COMMENT 'Screening records carried by the message',
+    `state` VARCHAR(20) NOT NULL DEFAULT 'pending' COMMENT 'pending, publishing, published, failed',
+    `attempts` INT NOT NULL DEFAULT 0 COMMENT 'Publish attempts',
+    `last_error` TEXT NULL COMMENT 'Last publish error',
+    `message_id` VARCHAR(100) NULL COMMENT 'Message ID from Pub/Sub once published',
+    `created_at` VARCHAR(40) NOT NULL COMMENT 'Enqueue timestamp (RFC3339)',
+    `updated_at` VARCHAR(40) NOT NULL COMMENT 'Last state change timestamp (RFC3339)',
+    `published_at` VARCHAR(40) NULL COMMENT 'Publish timestamp (RFC3339)',
+    PRIMARY KEY (`id`),
+    INDEX `idx_state_created_at` (`state`, `created_at`),
+    INDEX `idx_message_id` (`message_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Pub/Sub Outbox Messages Table';
@@ -0,0 +1,15 @@
+-- Message yang tidak bisa diproses (CKG_TABLE_QUARANTINE), dicatat sebelum di-ack atau dikirim ke dead-letter topic.
+CREATE TABLE IF NOT EXISTS `ckg_pubsub_quarantine` (
+    `id` VARCHAR(100) NOT NULL COMMENT 'Message ID from Pub/Sub',
+    `data` LONGTEXT NULL COMMENT 'Original message data',
+    `attributes` JSON NULL COMMENT 'Original message attributes in JSON format',
+    `reason` VARCHAR(50) NOT NULL COMMENT 'parse_error, permanent_error, retry_exhausted',
+    `error` TEXT NULL COMMENT 'Error message',
+    `attempts` INT NOT NULL DEFAULT 0 COMMENT 'Processing attempts',
+    `delivery_attempt` INT NULL COMMENT 'Delivery attempt reported by the broker',
+    `dead_letter_id` VARCHAR(100) NULL COMMENT 'Message ID on the dead-letter topic',
+    `quarantined_at` VARCHAR(40) NOT NULL COMMENT 'Quarantine timestamp (RFC3339)',
+    INDEX `idx_quarantine_id` (`id`),
+    INDEX `idx_quarantined_at` (`quarantined_at`),
+    INDEX `idx_reason` (`reason`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Pub/Sub Quarantine Messages Table';
@@ -0,0 +1,9 @@
+-- Posisi terakhir sumber perubahan data producer (CKG_TABLE_CHECKPOINT): resume token change stream,
+-- cursor polling, LSN logical replication atau posisi binlog.
+CREATE TABLE IF NOT EXISTS `ckg_pubsub_checkpoint` (
+    `id` VARCHAR(100) NOT NULL COMMENT 'Checkpoint name, e.g. watch:skrining_tb',
+    `position` TEXT NULL COMMENT 'Resume token, cursor, LSN or binlog position',
+    `checkpoint_at` VARCHAR(40) NULL COMMENT 'Timestamp of the last processed change (RFC3339)',
+    `updated_at` VARCHAR(40) NOT NULL COMMENT 'Last update timestamp (RFC3339)',
+    PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Pub/Sub Producer Checkpoint Table';
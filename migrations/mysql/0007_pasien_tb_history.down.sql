@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `pasien_tb_history`;
@@ -0,0 +1,17 @@
+-- Riwayat perubahan status pasien dari SITB (CKG_TABLE_STATUS_HISTORY), satu baris per field yang berubah.
+CREATE TABLE IF NOT EXISTS `pasien_tb_history` (
+    `id` BIGINT NOT NULL AUTO_INCREMENT,
+    `pasien_ckg_id` VARCHAR(100) NULL COMMENT 'Patient CKG ID',
+    `terduga_id` VARCHAR(100) NULL COMMENT 'SITB terduga ID',
+    `pasien_tb_id` VARCHAR(100) NULL COMMENT 'SITB patient ID',
+    `pasien_nik` VARCHAR(20) NULL COMMENT 'Patient NIK',
+    `field` VARCHAR(50) NOT NULL COMMENT 'Changed status field, e.g. status_diagnosa or hasil_akhir',
+    `previous_value` VARCHAR(255) NULL COMMENT 'Value before the change, NULL for a new status',
+    `new_value` VARCHAR(255) NULL COMMENT 'Value after the change',
+    `message_id` VARCHAR(100) NOT NULL COMMENT 'Source Pub/Sub message ID',
+    `changed_at` VARCHAR(40) NOT NULL COMMENT 'Change timestamp (RFC3339)',
+    PRIMARY KEY (`id`),
+    INDEX `idx_pasien_ckg_id_changed_at` (`pasien_ckg_id`, `changed_at`),
+    INDEX `idx_pasien_nik_changed_at` (`pasien_nik`, `changed_at`),
+    INDEX `idx_message_id` (`message_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='TB Patient Status History Table';
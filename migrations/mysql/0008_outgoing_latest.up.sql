@@ -0,0 +1,21 @@
+-- Data terakhir yang terkirim per pasien (CKG_TABLE_OUTGOING_LATEST). Deteksi perubahan dan retraksi
+-- membaca tabel ini sehingga tetap bekerja setelah log outgoing dihapus retention.
+CREATE TABLE IF NOT EXISTS `ckg_pubsub_outgoing_latest` (
+    `pasien_ckg_id` VARCHAR(100) NOT NULL COMMENT 'Patient CKG ID',
+    `message_id` VARCHAR(100) NOT NULL COMMENT 'Message ID from Pub/Sub',
+    `pasien_nik` VARCHAR(20) NULL COMMENT 'Patient NIK',
+    `record_hash` CHAR(64) NOT NULL COMMENT 'SHA-256 of the screening record',
+    `attempt` INT NOT NULL DEFAULT 1 COMMENT 'Publish attempt that succeeded',
+    `published_at` VARCHAR(40) NOT NULL COMMENT 'Publish timestamp (RFC3339)',
+    PRIMARY KEY (`pasien_ckg_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Pub/Sub Latest Outgoing Record per Patient';
+
+-- Isi dari log outgoing yang masih ada, satu baris terbaru per pasien
+INSERT IGNORE INTO `ckg_pubsub_outgoing_latest`
+    (`pasien_ckg_id`, `message_id`, `pasien_nik`, `record_hash`, `attempt`, `published_at`)
+SELECT `pasien_ckg_id`, `message_id`, `pasien_nik`, `record_hash`, `attempt`, `published_at`
+FROM (
+    SELECT i.*, ROW_NUMBER() OVER (PARTITION BY `pasien_ckg_id` ORDER BY `published_at` DESC) AS `rn`
+    FROM `ckg_pubsub_outgoing_item` i
+) latest
+WHERE `rn` = 1;
@@ -0,0 +1,10 @@
+-- Baris yang belum terkirim tidak bisa disimpan pada struktur lama
+DELETE FROM `ckg_pubsub_outgoing_latest` WHERE `published_at` IS NULL;
+
+ALTER TABLE `ckg_pubsub_outgoing_latest`
+  DROP INDEX `idx_outbox_id`,
+  DROP COLUMN `outbox_id`,
+  DROP COLUMN `queued_at`,
+  MODIFY COLUMN `message_id` VARCHAR(100) NOT NULL COMMENT 'Message ID from Pub/Sub',
+  MODIFY COLUMN `attempt` INT NOT NULL DEFAULT 1 COMMENT 'Publish attempt that succeeded',
+  MODIFY COLUMN `published_at` VARCHAR(40) NOT NULL COMMENT 'Publish timestamp (RFC3339)';
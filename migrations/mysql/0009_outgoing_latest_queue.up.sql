@@ -0,0 +1,8 @@
+-- Data terakhir per pasien ditulis saat data masuk outbox, message_id dan published_at diisi setelah terkirim
+ALTER TABLE `ckg_pubsub_outgoing_latest`
+  ADD COLUMN `outbox_id` VARCHAR(36) NULL COMMENT 'Outbox ID that carries the record' AFTER `pasien_ckg_id`,
+  ADD COLUMN `queued_at` VARCHAR(40) NULL COMMENT 'Enqueue timestamp (RFC3339)' AFTER `attempt`,
+  MODIFY COLUMN `message_id` VARCHAR(100) NULL COMMENT 'Message ID from Pub/Sub once published',
+  MODIFY COLUMN `attempt` INT NOT NULL DEFAULT 0 COMMENT 'Publish attempt that succeeded',
+  MODIFY COLUMN `published_at` VARCHAR(40) NULL COMMENT 'Publish timestamp (RFC3339)',
+  ADD INDEX `idx_outbox_id` (`outbox_id`);
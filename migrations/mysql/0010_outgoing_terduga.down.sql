@@ -0,0 +1,2 @@
+ALTER TABLE `ckg_pubsub_outgoing_latest` DROP COLUMN `terduga`;
+ALTER TABLE `ckg_pubsub_outgoing_item` DROP COLUMN `terduga`;
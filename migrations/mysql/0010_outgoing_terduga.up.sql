@@ -0,0 +1,7 @@
+-- Flag terduga TB per data yang dikirim, retraksi hanya dikirim untuk pasien yang data terakhirnya terduga.
+-- Data lama dibiarkan NULL dan dianggap terduga kecuali berupa retraksi.
+ALTER TABLE `ckg_pubsub_outgoing_item`
+  ADD COLUMN `terduga` TINYINT(1) NULL COMMENT 'Sent as terduga TB, NULL for records sent before the flag was stored' AFTER `record_hash`;
+
+ALTER TABLE `ckg_pubsub_outgoing_latest`
+  ADD COLUMN `terduga` TINYINT(1) NULL COMMENT 'Sent as terduga TB, NULL for records sent before the flag was stored' AFTER `record_hash`;
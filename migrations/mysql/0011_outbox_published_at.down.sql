@@ -0,0 +1 @@
+ALTER TABLE `ckg_pubsub_outbox` DROP INDEX `idx_published_at`;
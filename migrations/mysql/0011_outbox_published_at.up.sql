@@ -0,0 +1,2 @@
+-- Retention outbox membaca outbox yang sudah terkirim berdasarkan published_at
+ALTER TABLE `ckg_pubsub_outbox` ADD INDEX `idx_published_at` (`published_at`);
@@ -0,0 +1 @@
+ALTER TABLE pasien_tb DROP COLUMN IF EXISTS sitb_updated_at;
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS ckg_pubsub_incoming_item;
+
+UPDATE ckg_pubsub_incoming SET processed_at = received_at WHERE processed_at IS NULL;
+
+DROP INDEX IF EXISTS idx_ckg_pubsub_incoming_state;
+ALTER TABLE ckg_pubsub_incoming
+  DROP COLUMN IF EXISTS state,
+  DROP COLUMN IF EXISTS attempts,
+  DROP COLUMN IF EXISTS last_error,
+  DROP COLUMN IF EXISTS updated_at,
+  ALTER COLUMN processed_at SET DEFAULT CURRENT_TIMESTAMP,
+  ALTER COLUMN processed_at SET NOT NULL;
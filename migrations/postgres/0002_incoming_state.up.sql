@@ -0,0 +1,32 @@
+-- State proses message incoming (CKG_TABLE_INCOMING) dan hasil proses per item (CKG_TABLE_INCOMING_ITEM).
+-- processed_at tidak lagi diisi otomatis: NULL berarti message belum selesai diproses. Baris lama
+-- dianggap sudah berhasil diproses.
+ALTER TABLE ckg_pubsub_incoming
+  ADD COLUMN IF NOT EXISTS state VARCHAR(20) NOT NULL DEFAULT 'received',
+  ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS last_error TEXT NULL,
+  ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NULL DEFAULT NULL,
+  ALTER COLUMN processed_at DROP NOT NULL,
+  ALTER COLUMN processed_at SET DEFAULT NULL;
+COMMENT ON COLUMN ckg_pubsub_incoming.state IS 'received, processing, succeeded, partially_failed, failed';
+COMMENT ON COLUMN ckg_pubsub_incoming.processed_at IS 'Message processed timestamp, NULL jika belum diproses';
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsub_incoming_state ON ckg_pubsub_incoming (state);
+
+UPDATE ckg_pubsub_incoming SET state = 'succeeded', attempts = 1 WHERE processed_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS ckg_pubsub_incoming_item (
+    message_id VARCHAR(100) NOT NULL,
+    item_index INT NOT NULL,
+    pasien_ckg_id VARCHAR(100) NULL,
+    terduga_id VARCHAR(100) NULL,
+    pasien_tb_id VARCHAR(100) NULL,
+    pasien_nik VARCHAR(20) NULL,
+    is_error BOOLEAN NOT NULL DEFAULT FALSE,
+    respons TEXT NULL,
+    attempt INT NOT NULL DEFAULT 1,
+    processed_at VARCHAR(40) NOT NULL,
+    PRIMARY KEY (message_id, item_index)
+);
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsub_incoming_item_pasien_nik ON ckg_pubsub_incoming_item (pasien_nik, is_error);
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsub_incoming_item_terduga_id ON ckg_pubsub_incoming_item (terduga_id, is_error);
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsub_incoming_item_pasien_ckg_id ON ckg_pubsub_incoming_item (pasien_ckg_id, is_error);
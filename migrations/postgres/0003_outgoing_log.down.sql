@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS ckg_pubsub_outgoing_item;
+
+DROP INDEX IF EXISTS idx_ckg_pubsu_outgoing_outbox_id;
+DROP INDEX IF EXISTS idx_ckg_pubsu_outgoing_status_created_at;
+ALTER TABLE ckg_pubsu_outgoing
+  DROP COLUMN IF EXISTS outbox_id,
+  DROP COLUMN IF EXISTS payload_hash,
+  DROP COLUMN IF EXISTS ordering_key,
+  DROP COLUMN IF EXISTS status,
+  DROP COLUMN IF EXISTS error,
+  DROP COLUMN IF EXISTS attempt,
+  DROP COLUMN IF EXISTS record_count;
@@ -0,0 +1,25 @@
+-- Log outgoing per percobaan publish (CKG_TABLE_OUTGOING) dan data skrining per message
+-- (CKG_TABLE_OUTGOING_ITEM). Baris lama dianggap message yang berhasil terkirim.
+ALTER TABLE ckg_pubsu_outgoing
+  ADD COLUMN IF NOT EXISTS outbox_id VARCHAR(36) NULL,
+  ADD COLUMN IF NOT EXISTS payload_hash CHAR(64) NULL,
+  ADD COLUMN IF NOT EXISTS ordering_key VARCHAR(100) NULL,
+  ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'published',
+  ADD COLUMN IF NOT EXISTS error TEXT NULL,
+  ADD COLUMN IF NOT EXISTS attempt INT NOT NULL DEFAULT 1,
+  ADD COLUMN IF NOT EXISTS record_count INT NOT NULL DEFAULT 0;
+COMMENT ON COLUMN ckg_pubsu_outgoing.status IS 'published, failed';
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsu_outgoing_outbox_id ON ckg_pubsu_outgoing (outbox_id);
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsu_outgoing_status_created_at ON ckg_pubsu_outgoing (status, created_at);
+
+CREATE TABLE IF NOT EXISTS ckg_pubsub_outgoing_item (
+    message_id VARCHAR(100) NOT NULL,
+    pasien_ckg_id VARCHAR(100) NOT NULL,
+    pasien_nik VARCHAR(20) NULL,
+    record_hash CHAR(64) NOT NULL,
+    attempt INT NOT NULL DEFAULT 1,
+    published_at VARCHAR(40) NOT NULL,
+    PRIMARY KEY (message_id, pasien_ckg_id)
+);
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsub_outgoing_item_pasien_ckg_id_published_at ON ckg_pubsub_outgoing_item (pasien_ckg_id, published_at);
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsub_outgoing_item_pasien_nik ON ckg_pubsub_outgoing_item (pasien_nik);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS ckg_pubsub_outbox;
@@ -0,0 +1,18 @@
+-- Outbox producer (CKG_TABLE_OUTBOX). Batch skrining disimpan di sini lalu dikirim relay ke broker.
+CREATE TABLE IF NOT EXISTS ckg_pubsub_outbox (
+    id VARCHAR(36) NOT NULL PRIMARY KEY,
+    topic VARCHAR(255) NOT NULL,
+    data TEXT NOT NULL,
+    attributes JSONB NULL,
+    records JSONB NULL,
+    state VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NULL,
+    message_id VARCHAR(100) NULL,
+    created_at VARCHAR(40) NOT NULL,
+    updated_at VARCHAR(40) NOT NULL,
+    published_at VARCHAR(40) NULL
+);
+COMMENT ON COLUMN ckg_pubsub_outbox.state IS 'pending, publishing, published, failed';
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsub_outbox_state_created_at ON ckg_pubsub_outbox (state, created_at);
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsub_outbox_message_id ON ckg_pubsub_outbox (message_id);
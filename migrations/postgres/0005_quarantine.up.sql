@@ -0,0 +1,16 @@
+-- Message yang tidak bisa diproses (CKG_TABLE_QUARANTINE), dicatat sebelum di-ack atau dikirim ke dead-letter topic.
+CREATE TABLE IF NOT EXISTS ckg_pubsub_quarantine (
+    id VARCHAR(100) NOT NULL,
+    data TEXT NULL,
+    attributes JSONB NULL,
+    reason VARCHAR(50) NOT NULL,
+    error TEXT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    delivery_attempt INT NULL,
+    dead_letter_id VARCHAR(100) NULL,
+    quarantined_at VARCHAR(40) NOT NULL
+);
+COMMENT ON COLUMN ckg_pubsub_quarantine.reason IS 'parse_error, permanent_error, retry_exhausted';
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsub_quarantine_id ON ckg_pubsub_quarantine (id);
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsub_quarantine_quarantined_at ON ckg_pubsub_quarantine (quarantined_at);
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsub_quarantine_reason ON ckg_pubsub_quarantine (reason);
@@ -0,0 +1,8 @@
+-- Posisi terakhir sumber perubahan data producer (CKG_TABLE_CHECKPOINT): resume token change stream,
+-- cursor polling, LSN logical replication atau posisi binlog.
+CREATE TABLE IF NOT EXISTS ckg_pubsub_checkpoint (
+    id VARCHAR(100) NOT NULL PRIMARY KEY,
+    position TEXT NULL,
+    checkpoint_at VARCHAR(40) NULL,
+    updated_at VARCHAR(40) NOT NULL
+);
@@ -0,0 +1,16 @@
+-- Riwayat perubahan status pasien dari SITB (CKG_TABLE_STATUS_HISTORY), satu baris per field yang berubah.
+CREATE TABLE IF NOT EXISTS pasien_tb_history (
+    id BIGSERIAL PRIMARY KEY,
+    pasien_ckg_id VARCHAR(100) NULL,
+    terduga_id VARCHAR(100) NULL,
+    pasien_tb_id VARCHAR(100) NULL,
+    pasien_nik VARCHAR(20) NULL,
+    field VARCHAR(50) NOT NULL,
+    previous_value VARCHAR(255) NULL,
+    new_value VARCHAR(255) NULL,
+    message_id VARCHAR(100) NOT NULL,
+    changed_at VARCHAR(40) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_pasien_tb_history_pasien_ckg_id_changed_at ON pasien_tb_history (pasien_ckg_id, changed_at);
+CREATE INDEX IF NOT EXISTS idx_pasien_tb_history_pasien_nik_changed_at ON pasien_tb_history (pasien_nik, changed_at);
+CREATE INDEX IF NOT EXISTS idx_pasien_tb_history_message_id ON pasien_tb_history (message_id);
@@ -0,0 +1,17 @@
+-- Data terakhir yang terkirim per pasien (CKG_TABLE_OUTGOING_LATEST). Deteksi perubahan dan retraksi
+-- membaca tabel ini sehingga tetap bekerja setelah log outgoing dihapus retention.
+CREATE TABLE IF NOT EXISTS ckg_pubsub_outgoing_latest (
+    pasien_ckg_id VARCHAR(100) NOT NULL PRIMARY KEY,
+    message_id VARCHAR(100) NOT NULL,
+    pasien_nik VARCHAR(20) NULL,
+    record_hash CHAR(64) NOT NULL,
+    attempt INT NOT NULL DEFAULT 1,
+    published_at VARCHAR(40) NOT NULL
+);
+
+-- Isi dari log outgoing yang masih ada, satu baris terbaru per pasien
+INSERT INTO ckg_pubsub_outgoing_latest (pasien_ckg_id, message_id, pasien_nik, record_hash, attempt, published_at)
+SELECT DISTINCT ON (pasien_ckg_id) pasien_ckg_id, message_id, pasien_nik, record_hash, attempt, published_at
+FROM ckg_pubsub_outgoing_item
+ORDER BY pasien_ckg_id, published_at DESC
+ON CONFLICT (pasien_ckg_id) DO NOTHING;
@@ -0,0 +1,10 @@
+-- Baris yang belum terkirim tidak bisa disimpan pada struktur lama
+DELETE FROM ckg_pubsub_outgoing_latest WHERE published_at IS NULL;
+
+DROP INDEX IF EXISTS idx_ckg_pubsub_outgoing_latest_outbox_id;
+ALTER TABLE ckg_pubsub_outgoing_latest
+  DROP COLUMN IF EXISTS outbox_id,
+  DROP COLUMN IF EXISTS queued_at,
+  ALTER COLUMN message_id SET NOT NULL,
+  ALTER COLUMN attempt SET DEFAULT 1,
+  ALTER COLUMN published_at SET NOT NULL;
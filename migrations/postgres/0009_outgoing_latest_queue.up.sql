@@ -0,0 +1,8 @@
+-- Data terakhir per pasien ditulis saat data masuk outbox, message_id dan published_at diisi setelah terkirim
+ALTER TABLE ckg_pubsub_outgoing_latest
+  ADD COLUMN IF NOT EXISTS outbox_id VARCHAR(36) NULL,
+  ADD COLUMN IF NOT EXISTS queued_at VARCHAR(40) NULL,
+  ALTER COLUMN message_id DROP NOT NULL,
+  ALTER COLUMN attempt SET DEFAULT 0,
+  ALTER COLUMN published_at DROP NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsub_outgoing_latest_outbox_id ON ckg_pubsub_outgoing_latest (outbox_id);
@@ -0,0 +1,4 @@
+-- Flag terduga TB per data yang dikirim, retraksi hanya dikirim untuk pasien yang data terakhirnya terduga.
+-- Data lama dibiarkan NULL dan dianggap terduga kecuali berupa retraksi.
+ALTER TABLE ckg_pubsub_outgoing_item ADD COLUMN IF NOT EXISTS terduga BOOLEAN NULL;
+ALTER TABLE ckg_pubsub_outgoing_latest ADD COLUMN IF NOT EXISTS terduga BOOLEAN NULL;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_ckg_pubsub_outbox_published_at;
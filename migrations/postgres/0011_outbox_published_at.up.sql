@@ -0,0 +1,2 @@
+-- Retention outbox membaca outbox yang sudah terkirim berdasarkan published_at
+CREATE INDEX IF NOT EXISTS idx_ckg_pubsub_outbox_published_at ON ckg_pubsub_outbox (published_at);
@@ -37,13 +37,56 @@ CREATE TABLE `tmp_ckg_incoming` (
 CREATE TABLE `ckg_pubsub_incoming` (
     `id` VARCHAR(100) NOT NULL COMMENT 'Message ID from Pub/Sub',
     `data` JSON NOT NULL COMMENT 'Message data in JSON format',
+    `state` VARCHAR(20) NOT NULL DEFAULT 'received' COMMENT 'received, processing, succeeded, partially_failed, failed',
+    `attempts` INT NOT NULL DEFAULT 0 COMMENT 'Number of processing attempts',
+    `last_error` TEXT NULL COMMENT 'Error of the last processing attempt',
     `received_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT 'Message received timestamp',
-    `processed_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT 'Message received timestamp',
+    `processed_at` TIMESTAMP NULL DEFAULT NULL COMMENT 'Message processed timestamp, NULL jika belum diproses',
+    `updated_at` TIMESTAMP NULL DEFAULT NULL COMMENT 'Last state change timestamp',
     PRIMARY KEY (`id`),
     INDEX `idx_received_at` (`received_at`),
-    INDEX `idx_processed_at` (`processed_at`)
+    INDEX `idx_processed_at` (`processed_at`),
+    INDEX `idx_state` (`state`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Pub/Sub Incoming Messages Table';
 
+-- =============================================
+-- TABLE: ckg_pubsub_incoming_item (Hasil proses status pasien per incoming message - untuk CKG)
+-- =============================================
+CREATE TABLE `ckg_pubsub_incoming_item` (
+    `message_id` VARCHAR(100) NOT NULL COMMENT 'Message ID from Pub/Sub',
+    `item_index` INT NOT NULL COMMENT 'Position of the status in the message data',
+    `pasien_ckg_id` VARCHAR(100) NULL COMMENT 'Patient CKG ID',
+    `terduga_id` VARCHAR(100) NULL COMMENT 'SITB terduga ID',
+    `pasien_tb_id` VARCHAR(100) NULL COMMENT 'SITB patient ID',
+    `pasien_nik` VARCHAR(20) NULL COMMENT 'Patient NIK',
+    `is_error` TINYINT(1) NOT NULL DEFAULT 0 COMMENT 'Whether the status was rejected',
+    `respons` TEXT NULL COMMENT 'Processing result or rejection reason',
+    `attempt` INT NOT NULL DEFAULT 1 COMMENT 'Processing attempt that produced the result',
+    `processed_at` VARCHAR(40) NOT NULL COMMENT 'Processing timestamp (RFC3339)',
+    PRIMARY KEY (`message_id`, `item_index`),
+    INDEX `idx_pasien_nik` (`pasien_nik`, `is_error`),
+    INDEX `idx_terduga_id` (`terduga_id`, `is_error`),
+    INDEX `idx_pasien_ckg_id` (`pasien_ckg_id`, `is_error`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Pub/Sub Incoming Records Table';
+
+-- =============================================
+-- TABLE: ckg_pubsub_quarantine (Poison messages - untuk CKG)
+-- =============================================
+CREATE TABLE `ckg_pubsub_quarantine` (
+    `id` VARCHAR(100) NOT NULL COMMENT 'Message ID from Pub/Sub',
+    `data` LONGTEXT NULL COMMENT 'Original message data',
+    `attributes` JSON NULL COMMENT 'Original message attributes in JSON format',
+    `reason` VARCHAR(50) NOT NULL COMMENT 'parse_error, permanent_error, retry_exhausted',
+    `error` TEXT NULL COMMENT 'Error message',
+    `attempts` INT NOT NULL DEFAULT 0 COMMENT 'Processing attempts',
+    `delivery_attempt` INT NULL COMMENT 'Delivery attempt reported by the broker',
+    `dead_letter_id` VARCHAR(100) NULL COMMENT 'Message ID on the dead-letter topic',
+    `quarantined_at` VARCHAR(40) NOT NULL COMMENT 'Quarantine timestamp (RFC3339)',
+    INDEX `idx_quarantine_id` (`id`),
+    INDEX `idx_quarantined_at` (`quarantined_at`),
+    INDEX `idx_reason` (`reason`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Pub/Sub Quarantine Messages Table';
+
 -- =============================================
 -- TABLE: tmp_ckg_outgoing (API outgoing messages - untuk SITB)
 -- =============================================
@@ -59,13 +102,114 @@ CREATE TABLE `tmp_ckg_outgoing` (
 -- =============================================
 CREATE TABLE `ckg_pubsu_outgoing` (
     `id` VARCHAR(100) NOT NULL COMMENT 'Message ID from Pub/Sub',
+    `outbox_id` VARCHAR(36) NULL COMMENT 'Outbox ID the message was published from',
+    `payload_hash` CHAR(64) NULL COMMENT 'SHA-256 of the published payload',
+    `ordering_key` VARCHAR(100) NULL COMMENT 'Ordering key (pasien_ckg_id) of the message',
+    `status` VARCHAR(20) NOT NULL DEFAULT 'published' COMMENT 'published, failed',
+    `error` TEXT NULL COMMENT 'Publish error of a failed attempt',
+    `attempt` INT NOT NULL DEFAULT 1 COMMENT 'Publish attempt',
+    `record_count` INT NOT NULL DEFAULT 0 COMMENT 'Number of screening records in the message',
     `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT 'Record create timestamp',
     `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT 'Record update timestamp',
     PRIMARY KEY (`id`),
     INDEX `idx_created_at` (`created_at`),
-    INDEX `idx_updated_at` (`updated_at`)
+    INDEX `idx_updated_at` (`updated_at`),
+    INDEX `idx_outbox_id` (`outbox_id`),
+    INDEX `idx_status_created_at` (`status`, `created_at`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='API Outgoing Messages Table';
 
+-- =============================================
+-- TABLE: ckg_pubsub_outgoing_item (Data skrining per outgoing message - untuk CKG)
+-- =============================================
+CREATE TABLE `ckg_pubsub_outgoing_item` (
+    `message_id` VARCHAR(100) NOT NULL COMMENT 'Message ID from Pub/Sub',
+    `pasien_ckg_id` VARCHAR(100) NOT NULL COMMENT 'Patient CKG ID',
+    `pasien_nik` VARCHAR(20) NULL COMMENT 'Patient NIK',
+    `record_hash` CHAR(64) NOT NULL COMMENT 'SHA-256 of the screening record',
+    `terduga` TINYINT(1) NULL COMMENT 'Sent as terduga TB, NULL for records sent before the flag was stored',
+    `attempt` INT NOT NULL DEFAULT 1 COMMENT 'Publish attempt that succeeded',
+    `published_at` VARCHAR(40) NOT NULL COMMENT 'Publish timestamp (RFC3339)',
+    PRIMARY KEY (`message_id`, `pasien_ckg_id`),
+    INDEX `idx_pasien_ckg_id_published_at` (`pasien_ckg_id`, `published_at`),
+    INDEX `idx_pasien_nik` (`pasien_nik`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Pub/Sub Outgoing Records Table';
+
+-- =============================================
+-- TABLE: ckg_pubsub_outgoing_latest (Data terakhir yang terkirim atau menunggu di outbox per pasien - untuk CKG)
+-- Tidak dihapus retention, dipakai deteksi perubahan dan retraksi
+-- =============================================
+CREATE TABLE `ckg_pubsub_outgoing_latest` (
+    `pasien_ckg_id` VARCHAR(100) NOT NULL COMMENT 'Patient CKG ID',
+    `outbox_id` VARCHAR(36) NULL COMMENT 'Outbox ID that carries the record',
+    `message_id` VARCHAR(100) NULL COMMENT 'Message ID from Pub/Sub once published',
+    `pasien_nik` VARCHAR(20) NULL COMMENT 'Patient NIK',
+    `record_hash` CHAR(64) NOT NULL COMMENT 'SHA-256 of the screening record',
+    `terduga` TINYINT(1) NULL COMMENT 'Sent as terduga TB, NULL for records sent before the flag was stored',
+    `attempt` INT NOT NULL DEFAULT 0 COMMENT 'Publish attempt that succeeded',
+    `queued_at` VARCHAR(40) NULL COMMENT 'Enqueue timestamp (RFC3339)',
+    `published_at` VARCHAR(40) NULL COMMENT 'Publish timestamp (RFC3339)',
+    PRIMARY KEY (`pasien_ckg_id`),
+    INDEX `idx_outbox_id` (`outbox_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Pub/Sub Latest Outgoing Record per Patient';
+
+-- =============================================
+-- TABLE: ckg_pubsub_outbox (Transactional outbox producer - untuk CKG)
+-- =============================================
+CREATE TABLE `ckg_pubsub_outbox` (
+    `id` VARCHAR(36) NOT NULL COMMENT 'Outbox ID (UUID)',
+    `topic` VARCHAR(255) NOT NULL COMMENT 'Destination topic',
+    `data` LONGTEXT NOT NULL COMMENT 'Message data in JSON format',
+    `attributes` JSON NULL COMMENT 'Message attributes in JSON format',
+    `records` JSON NULL COMMENT 'Screening records carried by the message',
+    `state` VARCHAR(20) NOT NULL DEFAULT 'pending' COMMENT 'pending, publishing, published, failed',
+    `attempts` INT NOT NULL DEFAULT 0 COMMENT 'Publish attempts',
+    `last_error` TEXT NULL COMMENT 'Last publish error',
+    `message_id` VARCHAR(100) NULL COMMENT 'Message ID from Pub/Sub once published',
+    `created_at` VARCHAR(40) NOT NULL COMMENT 'Enqueue timestamp (RFC3339)',
+    `updated_at` VARCHAR(40) NOT NULL COMMENT 'Last state change timestamp (RFC3339)',
+    `published_at` VARCHAR(40) NULL COMMENT 'Publish timestamp (RFC3339)',
+    PRIMARY KEY (`id`),
+    INDEX `idx_state_created_at` (`state`, `created_at`),
+    INDEX `idx_message_id` (`message_id`),
+    INDEX `idx_published_at` (`published_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Pub/Sub Outbox Messages Table';
+
+-- =============================================
+-- TABLE: ckg_pubsub_checkpoint (Posisi terakhir sumber perubahan data - untuk CKG)
+-- =============================================
+CREATE TABLE `ckg_pubsub_checkpoint` (
+    `id` VARCHAR(100) NOT NULL COMMENT 'Checkpoint name, e.g. watch:skrining_tb',
+    `position` TEXT NULL COMMENT 'Resume token, cursor, LSN or binlog position',
+    `checkpoint_at` VARCHAR(40) NULL COMMENT 'Timestamp of the last processed change (RFC3339)',
+    `updated_at` VARCHAR(40) NOT NULL COMMENT 'Last update timestamp (RFC3339)',
+    PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='Pub/Sub Producer Checkpoint Table';
+
+-- =============================================
+-- TABLE: pasien_tb_history (Riwayat perubahan status pasien dari SITB - untuk CKG)
+-- =============================================
+CREATE TABLE `pasien_tb_history` (
+    `id` BIGINT NOT NULL AUTO_INCREMENT,
+    `pasien_ckg_id` VARCHAR(100) NULL COMMENT 'Patient CKG ID',
+    `terduga_id` VARCHAR(100) NULL COMMENT 'SITB terduga ID',
+    `pasien_tb_id` VARCHAR(100) NULL COMMENT 'SITB patient ID',
+    `pasien_nik` VARCHAR(20) NULL COMMENT 'Patient NIK',
+    `field` VARCHAR(50) NOT NULL COMMENT 'Changed status field, e.g. status_diagnosa or hasil_akhir',
+    `previous_value` VARCHAR(255) NULL COMMENT 'Value before the change, NULL for a new status',
+    `new_value` VARCHAR(255) NULL COMMENT 'Value after the change',
+    `message_id` VARCHAR(100) NOT NULL COMMENT 'Source Pub/Sub message ID',
+    `changed_at` VARCHAR(40) NOT NULL COMMENT 'Change timestamp (RFC3339)',
+    PRIMARY KEY (`id`),
+    INDEX `idx_pasien_ckg_id_changed_at` (`pasien_ckg_id`, `changed_at`),
+    INDEX `idx_pasien_nik_changed_at` (`pasien_nik`, `changed_at`),
+    INDEX `idx_message_id` (`message_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='TB Patient Status History Table';
+
+-- =============================================
+-- Tabel status pasien (CKG_TABLE_STATUS) dikelola CKG, kolom sitb_updated_at ditambahkan dengan
+-- migrations/mysql/0001_pasien_tb_sitb_updated_at.up.sql
+-- =============================================
+
 -- =============================================
 -- END OF SCHEMA
 -- =============================================